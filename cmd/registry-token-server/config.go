@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/docker/distribution/registry/auth/acl"
+	"gopkg.in/yaml.v2"
+)
+
+// config describes the token server. It is read from a YAML file:
+//
+//	issuer: registry-token-issuer
+//	service: registry.example.com
+//	expiration: 300
+//	key: /etc/registry-token-server/key.pem
+//	certificate: /etc/registry-token-server/cert.pem
+//	users:
+//	  alice: $2y$05$...
+//	anonymous:
+//	  library/*: pull
+//	acl:
+//	  alice:
+//	    team-a/*: pull,push
+//
+// The acl section uses the same format as the policy file of the acl access
+// controller.
+type config struct {
+	// Issuer is the value of the iss claim. It must match the issuer
+	// configured for the token auth of the registry.
+	Issuer string `yaml:"issuer"`
+
+	// Service is the name of the registry that tokens are issued for, used
+	// as the aud claim. Requests for other services are refused.
+	Service string `yaml:"service"`
+
+	// Expiration is the lifetime of the issued tokens, in seconds.
+	Expiration int `yaml:"expiration"`
+
+	// Key is the path of the libtrust private key, in PEM or JWK format,
+	// used to sign the tokens.
+	Key string `yaml:"key"`
+
+	// Certificate is the optional path of a PEM encoded certificate chain
+	// for the key, starting with the certificate of the key itself. If set,
+	// the chain is included in the tokens. Otherwise the registry must have
+	// a certificate of the key in its root certificate bundle.
+	Certificate string `yaml:"certificate"`
+
+	// Users maps user names to their bcrypt password hashes.
+	Users map[string]string `yaml:"users"`
+
+	// Anonymous maps repository name patterns to the actions granted to
+	// clients that do not authenticate.
+	Anonymous map[string]string `yaml:"anonymous"`
+
+	// ACL maps user name patterns to the actions they are granted on the
+	// repositories matching a name pattern.
+	ACL map[string]map[string]string `yaml:"acl"`
+}
+
+// defaultExpiration is the lifetime of a token in seconds, if none is
+// configured.
+const defaultExpiration = 300
+
+// parseConfig reads and validates the configuration file at filename.
+func parseConfig(filename string) (*config, error) {
+	p, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var c config
+	if err := yaml.Unmarshal(p, &c); err != nil {
+		return nil, err
+	}
+
+	if c.Issuer == "" {
+		return nil, fmt.Errorf("issuer must be configured")
+	}
+
+	if c.Service == "" {
+		return nil, fmt.Errorf("service must be configured")
+	}
+
+	if c.Key == "" {
+		return nil, fmt.Errorf("key must be configured")
+	}
+
+	if c.Expiration < 0 {
+		return nil, fmt.Errorf("invalid expiration: %d", c.Expiration)
+	} else if c.Expiration == 0 {
+		c.Expiration = defaultExpiration
+	}
+
+	if _, _, err := c.policies(); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// policies returns the access policies of anonymous and authenticated
+// clients described by the configuration.
+func (c *config) policies() (anonymous, users *acl.Policy, err error) {
+	anonymous, err = acl.NewPolicy(map[string]map[string]string{"*": c.Anonymous})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	users, err = acl.NewPolicy(c.ACL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return anonymous, users, nil
+}
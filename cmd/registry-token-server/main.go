@@ -0,0 +1,131 @@
+// registry-token-server issues tokens for registries configured with the
+// token auth backend, implementing the token endpoint described in
+// docs/spec/auth/token.md.
+//
+// Clients authenticate with basic auth against the bcrypt password hashes of
+// the configuration file. The access granted in a token is the part of the
+// requested scope allowed by the acl rules of the file. The server is
+// started with:
+//
+//	$ registry-token-server -addr :5001 config.yml
+//
+// and the registry configured with the matching issuer, service and a root
+// certificate bundle containing the certificate of the signing key:
+//
+//	auth:
+//	  token:
+//	    realm: https://auth.example.com:5001/token
+//	    service: registry.example.com
+//	    issuer: registry-token-issuer
+//	    rootcertbundle: /etc/registry/token-server.pem
+package main
+
+import (
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libtrust"
+)
+
+var (
+	addr    string
+	tlsCert string
+	tlsKey  string
+)
+
+func init() {
+	flag.StringVar(&addr, "addr", ":5001", "address to listen on")
+	flag.StringVar(&tlsCert, "tlscert", "", "certificate file to serve tls")
+	flag.StringVar(&tlsKey, "tlskey", "", "key file to serve tls")
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fatalf("please specify a configuration file")
+	}
+
+	c, err := parseConfig(flag.Arg(0))
+	if err != nil {
+		fatalf("configuration error: %v", err)
+	}
+
+	key, err := libtrust.LoadKeyFile(c.Key)
+	if err != nil {
+		fatalf("unable to load signing key: %v", err)
+	}
+
+	var chain [][]byte
+	if c.Certificate != "" {
+		chain, err = loadCertificateChain(c.Certificate)
+		if err != nil {
+			fatalf("unable to load certificate chain: %v", err)
+		}
+	}
+
+	ts, err := newTokenServer(c, key, chain)
+	if err != nil {
+		fatalf("unable to create token server: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/token", ts)
+
+	if tlsCert == "" {
+		log.Infof("listening on %v", addr)
+		err = http.ListenAndServe(addr, mux)
+	} else {
+		log.Infof("listening on %v, tls", addr)
+		err = http.ListenAndServeTLS(addr, tlsCert, tlsKey, mux)
+	}
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// loadCertificateChain returns the DER encoded certificates of the PEM
+// encoded chain in filename.
+func loadCertificateChain(filename string) ([][]byte, error) {
+	p, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var chain [][]byte
+	for {
+		var block *pem.Block
+		block, p = pem.Decode(p)
+		if block == nil {
+			break
+		}
+
+		if block.Type == "CERTIFICATE" {
+			chain = append(chain, block.Bytes)
+		}
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificates found in %q", filename)
+	}
+
+	return chain, nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:", os.Args[0], "[-addr <addr>] [-tlscert <cert> -tlskey <key>] <config>")
+	flag.PrintDefaults()
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	usage()
+	os.Exit(1)
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/v2"
+	_ "github.com/docker/distribution/registry/auth/token"
+	"github.com/docker/distribution/registry/handlers"
+	_ "github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/libtrust"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testIssuer  = "test-issuer"
+	testService = "test-registry"
+)
+
+// testEnv holds a token server and a registry trusting its tokens.
+type testEnv struct {
+	tokenServer *httptest.Server
+	registry    *httptest.Server
+	builder     *v2.URLBuilder
+}
+
+func newTestEnv(t *testing.T, withChain bool) *testEnv {
+	key, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+
+	cert, err := libtrust.GenerateSelfSignedServerCert(key, []string{"localhost"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error generating certificate: %v", err)
+	}
+
+	bundle, err := ioutil.TempFile("", "token-server-bundle")
+	if err != nil {
+		t.Fatalf("unexpected error creating root certificate bundle: %v", err)
+	}
+	defer os.Remove(bundle.Name())
+	defer bundle.Close()
+
+	if err := pem.Encode(bundle, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+		t.Fatalf("unexpected error writing root certificate bundle: %v", err)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("alice-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("unexpected error hashing password: %v", err)
+	}
+
+	c := &config{
+		Issuer:     testIssuer,
+		Service:    testService,
+		Expiration: defaultExpiration,
+		Users: map[string]string{
+			"alice": string(hash),
+		},
+		Anonymous: map[string]string{
+			"library/*": "pull",
+		},
+		ACL: map[string]map[string]string{
+			"alice": {
+				"alice/*": "*",
+			},
+			"*": {
+				"library/*": "pull",
+			},
+		},
+	}
+
+	var chain [][]byte
+	if withChain {
+		chain = append(chain, cert.Raw)
+	}
+
+	ts, err := newTokenServer(c, key, chain)
+	if err != nil {
+		t.Fatalf("unexpected error creating token server: %v", err)
+	}
+
+	tokenServer := httptest.NewServer(ts)
+
+	app := handlers.NewApp(context.Background(), configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+		Auth: configuration.Auth{
+			"token": configuration.Parameters{
+				"realm":          tokenServer.URL + "/token",
+				"service":        testService,
+				"issuer":         testIssuer,
+				"rootcertbundle": bundle.Name(),
+			},
+		},
+	})
+	registry := httptest.NewServer(app)
+
+	builder, err := v2.NewURLBuilderFromString(registry.URL)
+	if err != nil {
+		t.Fatalf("error creating url builder: %v", err)
+	}
+
+	return &testEnv{
+		tokenServer: tokenServer,
+		registry:    registry,
+		builder:     builder,
+	}
+}
+
+func (env *testEnv) shutdown() {
+	env.tokenServer.Close()
+	env.registry.Close()
+}
+
+var challengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// challenge requests u without a token and returns the parameters of the
+// bearer challenge in the response.
+func challenge(t *testing.T, method, u string) map[string]string {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error requesting %s: %v", u, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unexpected status requesting %s without token: %v", u, resp.Status)
+	}
+
+	params := make(map[string]string)
+	for _, match := range challengeParamRegexp.FindAllStringSubmatch(resp.Header.Get("WWW-Authenticate"), -1) {
+		params[match[1]] = match[2]
+	}
+
+	return params
+}
+
+// fetchToken requests a token for the challenge from the realm, as the given
+// user if username is not empty.
+func fetchToken(t *testing.T, params map[string]string, username, password string) (string, int) {
+	u, err := url.Parse(params["realm"])
+	if err != nil {
+		t.Fatalf("unexpected error parsing realm: %v", err)
+	}
+
+	u.RawQuery = url.Values{
+		"service": []string{params["service"]},
+		"scope":   []string{params["scope"]},
+	}.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating token request: %v", err)
+	}
+
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error requesting token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", resp.StatusCode
+	}
+
+	var body struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("unexpected error decoding token response: %v", err)
+	}
+
+	return body.Token, resp.StatusCode
+}
+
+// requestWithToken requests u from the registry with the bearer token and
+// returns the response status code.
+func requestWithToken(t *testing.T, method, u, token string) int {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error requesting %s: %v", u, err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestTokenServer(t *testing.T) {
+	for _, withChain := range []bool{false, true} {
+		env := newTestEnv(t, withChain)
+
+		tagsURL, err := env.builder.BuildTagsURL("alice/app")
+		checkErr(t, err, "building tags url")
+
+		params := challenge(t, "GET", tagsURL)
+		if params["scope"] != "repository:alice/app:pull" {
+			t.Fatalf("unexpected challenge scope: %q", params["scope"])
+		}
+
+		if _, status := fetchToken(t, params, "alice", "wrong-password"); status != http.StatusUnauthorized {
+			t.Fatalf("unexpected status fetching token with a wrong password: %v", status)
+		}
+
+		token, status := fetchToken(t, params, "alice", "alice-password")
+		if status != http.StatusOK {
+			t.Fatalf("unexpected status fetching token: %v", status)
+		}
+
+		// The repository does not exist, but the request got past the
+		// access controller.
+		if status := requestWithToken(t, "GET", tagsURL, token); status != http.StatusNotFound {
+			t.Fatalf("unexpected status fetching tags with token: %v", status)
+		}
+
+		uploadURL, err := env.builder.BuildBlobUploadURL("alice/app")
+		checkErr(t, err, "building upload url")
+
+		// The pull token does not allow pushing.
+		if status := requestWithToken(t, "POST", uploadURL, token); status != http.StatusUnauthorized {
+			t.Fatalf("unexpected status starting upload with pull token: %v", status)
+		}
+
+		pushToken, status := fetchToken(t, challenge(t, "POST", uploadURL), "alice", "alice-password")
+		if status != http.StatusOK {
+			t.Fatalf("unexpected status fetching push token: %v", status)
+		}
+
+		if status := requestWithToken(t, "POST", uploadURL, pushToken); status != http.StatusAccepted {
+			t.Fatalf("unexpected status starting upload with push token: %v", status)
+		}
+
+		// Anonymous clients only get what the anonymous rules grant.
+		anonymousToken, status := fetchToken(t, params, "", "")
+		if status != http.StatusOK {
+			t.Fatalf("unexpected status fetching anonymous token: %v", status)
+		}
+
+		if status := requestWithToken(t, "GET", tagsURL, anonymousToken); status != http.StatusUnauthorized {
+			t.Fatalf("unexpected status fetching tags with anonymous token: %v", status)
+		}
+
+		libraryURL, err := env.builder.BuildTagsURL("library/ubuntu")
+		checkErr(t, err, "building tags url")
+
+		anonymousToken, status = fetchToken(t, challenge(t, "GET", libraryURL), "", "")
+		if status != http.StatusOK {
+			t.Fatalf("unexpected status fetching anonymous token: %v", status)
+		}
+
+		if status := requestWithToken(t, "GET", libraryURL, anonymousToken); status != http.StatusNotFound {
+			t.Fatalf("unexpected status fetching library tags with anonymous token: %v", status)
+		}
+
+		// Tokens are only issued for the configured service.
+		params["service"] = "other-registry"
+		if _, status := fetchToken(t, params, "alice", "alice-password"); status != http.StatusBadRequest {
+			t.Fatalf("unexpected status fetching token for another service: %v", status)
+		}
+
+		env.shutdown()
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	requested, err := parseScopes([]string{"repository:foo/bar:pull,push,pull repository:localhost:5000/baz:*"})
+	if err != nil {
+		t.Fatalf("unexpected error parsing scopes: %v", err)
+	}
+
+	if len(requested) != 2 {
+		t.Fatalf("unexpected number of scopes: %d", len(requested))
+	}
+
+	if requested[0].Type != "repository" || requested[0].Name != "foo/bar" || len(requested[0].Actions) != 2 {
+		t.Fatalf("unexpected first scope: %#v", requested[0])
+	}
+
+	if requested[1].Name != "localhost:5000/baz" || len(requested[1].Actions) != 1 || requested[1].Actions[0] != "*" {
+		t.Fatalf("unexpected second scope: %#v", requested[1])
+	}
+
+	for _, scope := range []string{"repository", "repository:foo", ":foo:pull", "repository:foo:"} {
+		if _, err := parseScopes([]string{scope}); err == nil {
+			t.Fatalf("expected error parsing scope %q", scope)
+		}
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "token-server-config")
+	if err != nil {
+		t.Fatalf("unexpected error creating config file: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(`
+issuer: test-issuer
+service: test-registry
+key: /key.pem
+users:
+  alice: $2y$05$nvxSeDRWdqBUJGJh55RrDOhLIuPxjXUBs0mudsuXmM/2ll3Kr/6oa
+acl:
+  alice:
+    alice/*: "*"
+  "*":
+    library/*: pull
+`); err != nil {
+		t.Fatalf("unexpected error writing config file: %v", err)
+	}
+	f.Close()
+
+	c, err := parseConfig(f.Name())
+	if err != nil {
+		t.Fatalf("unexpected error parsing config: %v", err)
+	}
+
+	if c.Expiration != defaultExpiration {
+		t.Fatalf("unexpected default expiration: %d", c.Expiration)
+	}
+
+	if c.ACL["*"]["library/*"] != "pull" {
+		t.Fatalf("unexpected acl: %v", c.ACL)
+	}
+}
+
+func TestParseConfigInvalidPattern(t *testing.T) {
+	for _, rules := range []string{
+		"anonymous:\n  \"[\": pull\n",
+		"acl:\n  \"[\":\n    library/*: pull\n",
+		"acl:\n  alice:\n    \"[\": pull\n",
+	} {
+		f, err := ioutil.TempFile("", "token-server-config")
+		if err != nil {
+			t.Fatalf("unexpected error creating config file: %v", err)
+		}
+		defer os.Remove(f.Name())
+
+		if _, err := f.WriteString("issuer: test-issuer\nservice: test-registry\nkey: /key.pem\n" + rules); err != nil {
+			t.Fatalf("unexpected error writing config file: %v", err)
+		}
+		f.Close()
+
+		if _, err := parseConfig(f.Name()); err == nil {
+			t.Fatalf("expected error parsing config with rules %q", rules)
+		}
+	}
+}
+
+func checkErr(t *testing.T, err error, msg string) {
+	if err != nil {
+		t.Fatalf("unexpected error %s: %v", msg, err)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/docker/distribution/registry/auth/acl"
+	"github.com/docker/distribution/registry/auth/token"
+	"github.com/docker/libtrust"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// tokenServer implements the token endpoint of the registry token
+// authentication specification. It authenticates the client with basic
+// auth, grants the requested scopes allowed by its configuration and returns
+// a token signed with its key.
+type tokenServer struct {
+	config     *config
+	anonymous  *acl.Policy
+	users      *acl.Policy
+	key        libtrust.PrivateKey
+	signingAlg string
+	x5c        []string
+}
+
+// newTokenServer creates a token server signing with key. The chain, if not
+// empty, holds the DER encoded certificate chain of the key.
+func newTokenServer(c *config, key libtrust.PrivateKey, chain [][]byte) (*tokenServer, error) {
+	// The signature algorithm only depends on the key, so find it out once
+	// rather than signing every token twice.
+	_, alg, err := key.Sign(strings.NewReader(""), crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("unable to sign with key: %v", err)
+	}
+
+	anonymous, users, err := c.policies()
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &tokenServer{
+		config:     c,
+		anonymous:  anonymous,
+		users:      users,
+		key:        key,
+		signingAlg: alg,
+	}
+
+	for _, der := range chain {
+		ts.x5c = append(ts.x5c, base64.StdEncoding.EncodeToString(der))
+	}
+
+	return ts, nil
+}
+
+// grantedActions returns the subset of the requested actions on the resource
+// that the configuration grants to account. The account of an anonymous
+// client is empty.
+func (ts *tokenServer) grantedActions(account string, requested *token.ResourceActions) []string {
+	pol := ts.users
+	if account == "" {
+		pol = ts.anonymous
+	}
+
+	var granted []string
+	for _, action := range requested.Actions {
+		access := auth.Access{
+			Resource: auth.Resource{
+				Type: requested.Type,
+				Name: requested.Name,
+			},
+			Action: action,
+		}
+
+		if pol.Allowed(account, access) {
+			granted = append(granted, action)
+		}
+	}
+	sort.Strings(granted)
+
+	return granted
+}
+
+// ServeHTTP handles a token request.
+func (ts *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+
+	if service := params.Get("service"); service != ts.config.Service {
+		http.Error(w, fmt.Sprintf("unknown service: %q", service), http.StatusBadRequest)
+		return
+	}
+
+	account, ok := ts.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", ts.config.Service))
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	if requested := params.Get("account"); requested != "" && requested != account {
+		http.Error(w, "account does not match the authenticated user", http.StatusForbidden)
+		return
+	}
+
+	requested, err := parseScopes(params["scope"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var access []*token.ResourceActions
+	for _, ra := range requested {
+		actions := ts.grantedActions(account, ra)
+		if len(actions) == 0 {
+			continue
+		}
+
+		access = append(access, &token.ResourceActions{
+			Type:    ra.Type,
+			Name:    ra.Name,
+			Actions: actions,
+		})
+	}
+
+	signed, err := ts.createToken(account, access)
+	if err != nil {
+		log.Errorf("error creating token: %v", err)
+		http.Error(w, "unable to create token", http.StatusInternalServerError)
+		return
+	}
+
+	log.Infof("issued token for %q: %s", account, formatAccess(access))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Token string `json:"token"`
+	}{
+		Token: signed,
+	})
+}
+
+// authenticate checks the basic auth credentials of the request, returning
+// the name of the account. A request without credentials is anonymous, with
+// an empty account name. False is returned if the credentials are invalid.
+func (ts *tokenServer) authenticate(r *http.Request) (string, bool) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return "", true
+	}
+
+	hash, ok := ts.config.Users[username]
+	if !ok || username == "" {
+		// Spend the time of a hash comparison anyway, so that valid user
+		// names cannot be told apart by the response time.
+		bcrypt.CompareHashAndPassword([]byte{}, []byte(password))
+		return "", false
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return "", false
+	}
+
+	return username, true
+}
+
+// createToken returns a signed token, in compact serialization, granting
+// access to account.
+func (ts *tokenServer) createToken(account string, access []*token.ResourceActions) (string, error) {
+	header := token.Header{
+		Type:       "JWT",
+		SigningAlg: ts.signingAlg,
+		KeyID:      ts.key.KeyID(),
+		X5c:        ts.x5c,
+	}
+
+	jti := make([]byte, 15)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("unable to read random bytes for jwt id: %v", err)
+	}
+
+	now := time.Now()
+	claims := token.ClaimSet{
+		Issuer:     ts.config.Issuer,
+		Subject:    account,
+		Audience:   ts.config.Service,
+		Expiration: now.Add(time.Duration(ts.config.Expiration) * time.Second).Unix(),
+		NotBefore:  now.Unix(),
+		IssuedAt:   now.Unix(),
+		JWTID:      base64.URLEncoding.EncodeToString(jti),
+		Access:     access,
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal jose header: %v", err)
+	}
+
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal claim set: %v", err)
+	}
+
+	payload := joseBase64UrlEncode(headerJSON) + token.TokenSeparator + joseBase64UrlEncode(claimsJSON)
+
+	signature, _, err := ts.key.Sign(strings.NewReader(payload), crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("unable to sign jwt payload: %v", err)
+	}
+
+	return payload + token.TokenSeparator + joseBase64UrlEncode(signature), nil
+}
+
+// parseScopes parses the scope parameters of a token request. Each scope has
+// the form "<type>:<name>:<action>[,<action>...]" and several scopes may be
+// given in one parameter, separated by spaces.
+func parseScopes(scopes []string) ([]*token.ResourceActions, error) {
+	var requested []*token.ResourceActions
+	for _, param := range scopes {
+		for _, scope := range strings.Fields(param) {
+			first := strings.Index(scope, ":")
+			last := strings.LastIndex(scope, ":")
+			if first <= 0 || last == first || last == len(scope)-1 {
+				return nil, fmt.Errorf("invalid scope: %q", scope)
+			}
+
+			ra := &token.ResourceActions{
+				Type: scope[:first],
+				Name: scope[first+1 : last],
+			}
+
+			seen := make(map[string]struct{})
+			for _, action := range strings.Split(scope[last+1:], ",") {
+				if _, ok := seen[action]; ok || action == "" {
+					continue
+				}
+				seen[action] = struct{}{}
+
+				ra.Actions = append(ra.Actions, action)
+			}
+
+			requested = append(requested, ra)
+		}
+	}
+
+	return requested, nil
+}
+
+// formatAccess formats the access claims for logging, in the scope syntax.
+func formatAccess(access []*token.ResourceActions) string {
+	scopes := make([]string, 0, len(access))
+	for _, ra := range access {
+		scopes = append(scopes, fmt.Sprintf("%s:%s:%s", ra.Type, ra.Name, strings.Join(ra.Actions, ",")))
+	}
+
+	return strings.Join(scopes, " ")
+}
+
+// joseBase64UrlEncode encodes the given data using the standard base64 url
+// encoding format but with all trailing '=' characters ommitted in accordance
+// with the jose specification.
+// http://tools.ietf.org/html/draft-ietf-jose-json-web-signature-31#section-2
+func joseBase64UrlEncode(b []byte) string {
+	return strings.TrimRight(base64.URLEncoding.EncodeToString(b), "=")
+}
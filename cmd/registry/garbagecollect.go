@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+)
+
+// garbageCollect runs the garbage-collect command, removing every blob in
+// the configured storage backend that is not referenced by any repository.
+// The registry should be stopped, or at least not accepting pushes, while
+// this runs.
+func garbageCollect(args []string) {
+	flags := flag.NewFlagSet("garbage-collect", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "report the blobs that would be deleted without deleting them")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage:", os.Args[0], "garbage-collect [-dry-run] <config>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	config, err := resolveConfiguration(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	ctx, err := configureLogging(context.Background(), config)
+	if err != nil {
+		fatalf("error configuring logger: %v", err)
+	}
+
+	driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+	if err != nil {
+		fatalf("failed to construct %s driver: %v", config.Storage.Type(), err)
+	}
+
+	swept, err := storage.MarkAndSweep(ctx, driver, *dryRun)
+	if err != nil {
+		fatalf("failed to garbage collect: %v", err)
+	}
+
+	verb := "deleted"
+	if *dryRun {
+		verb = "eligible for deletion"
+	}
+
+	for _, dgst := range swept {
+		fmt.Println(dgst)
+	}
+	fmt.Fprintf(os.Stderr, "%d blobs %s\n", len(swept), verb)
+}
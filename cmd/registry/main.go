@@ -17,15 +17,22 @@ import (
 	"github.com/bugsnag/bugsnag-go"
 	"github.com/docker/distribution/configuration"
 	"github.com/docker/distribution/context"
-	_ "github.com/docker/distribution/health"
+	"github.com/docker/distribution/health"
+	_ "github.com/docker/distribution/metrics"
+	_ "github.com/docker/distribution/registry/auth/acl"
+	_ "github.com/docker/distribution/registry/auth/htpasswd"
 	_ "github.com/docker/distribution/registry/auth/silly"
 	_ "github.com/docker/distribution/registry/auth/token"
 	"github.com/docker/distribution/registry/handlers"
+	_ "github.com/docker/distribution/registry/proxy"
 	_ "github.com/docker/distribution/registry/storage/driver/azure"
 	_ "github.com/docker/distribution/registry/storage/driver/filesystem"
+	_ "github.com/docker/distribution/registry/storage/driver/gcs"
 	_ "github.com/docker/distribution/registry/storage/driver/inmemory"
 	_ "github.com/docker/distribution/registry/storage/driver/middleware/cloudfront"
+	_ "github.com/docker/distribution/registry/storage/driver/middleware/instrumentation"
 	_ "github.com/docker/distribution/registry/storage/driver/s3"
+	_ "github.com/docker/distribution/registry/storage/driver/swift"
 	"github.com/docker/distribution/version"
 	gorhandlers "github.com/gorilla/handlers"
 	"github.com/yvasiyarov/gorelic"
@@ -46,9 +53,14 @@ func main() {
 		return
 	}
 
+	if flag.Arg(0) == "garbage-collect" {
+		garbageCollect(flag.Args()[1:])
+		return
+	}
+
 	ctx := context.Background()
 
-	config, err := resolveConfiguration()
+	config, err := resolveConfiguration(flag.Args())
 	if err != nil {
 		fatalf("configuration error: %v", err)
 	}
@@ -59,7 +71,10 @@ func main() {
 	}
 
 	app := handlers.NewApp(ctx, *config)
+	app.RegisterHealthChecks()
+	http.HandleFunc("/debug/maintenance/readonly", app.ReadOnlyHandler)
 	handler := configureReporting(app)
+	handler = health.Handler(handler)
 	handler = gorhandlers.CombinedLoggingHandler(os.Stdout, handler)
 
 	if config.HTTP.Debug.Addr != "" {
@@ -113,6 +128,7 @@ func main() {
 
 func usage() {
 	fmt.Fprintln(os.Stderr, "usage:", os.Args[0], "<config>")
+	fmt.Fprintln(os.Stderr, "      ", os.Args[0], "garbage-collect [-dry-run] <config>")
 	flag.PrintDefaults()
 }
 
@@ -122,11 +138,14 @@ func fatalf(format string, args ...interface{}) {
 	os.Exit(1)
 }
 
-func resolveConfiguration() (*configuration.Configuration, error) {
+// resolveConfiguration parses the configuration file named by the first
+// argument, falling back to the REGISTRY_CONFIGURATION_PATH environment
+// variable.
+func resolveConfiguration(args []string) (*configuration.Configuration, error) {
 	var configurationPath string
 
-	if flag.NArg() > 0 {
-		configurationPath = flag.Arg(0)
+	if len(args) > 0 {
+		configurationPath = args[0]
 	} else if os.Getenv("REGISTRY_CONFIGURATION_PATH") != "" {
 		configurationPath = os.Getenv("REGISTRY_CONFIGURATION_PATH")
 	}
@@ -252,7 +271,7 @@ func logLevel(level configuration.Loglevel) log.Level {
 	return l
 }
 
-// debugServer starts the debug server with pprof, expvar among other
+// debugServer starts the debug server with pprof, expvar, metrics among other
 // endpoints. The addr should not be exposed externally. For most of these to
 // work, tls cannot be enabled on the endpoint, so it is generally separate.
 func debugServer(addr string) {
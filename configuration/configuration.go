@@ -121,6 +121,16 @@ type Configuration struct {
 			IdleTimeout time.Duration `yaml:"idletimeout,omitempty"`
 		} `yaml:"pool,omitempty"`
 	} `yaml:"redis,omitempty"`
+
+	// Proxy configures the registry as a pull through cache of a remote
+	// registry.
+	Proxy Proxy `yaml:"proxy,omitempty"`
+
+	// Health provides the configuration section for health checks.
+	Health Health `yaml:"health,omitempty"`
+
+	// Maintenance configures maintenance operations of the registry.
+	Maintenance Maintenance `yaml:"maintenance,omitempty"`
 }
 
 // v0_1Configuration is a Version 0.1 Configuration struct
@@ -190,6 +200,8 @@ func (storage Storage) Type() string {
 		switch k {
 		case "cache":
 			// allow configuration of caching
+		case "delete":
+			// allow configuration of delete
 		default:
 			return k
 		}
@@ -219,6 +231,8 @@ func (storage *Storage) UnmarshalYAML(unmarshal func(interface{}) error) error {
 				switch k {
 				case "cache":
 					// allow configuration of caching
+				case "delete":
+					// allow configuration of delete
 				default:
 					types = append(types, k)
 				}
@@ -311,24 +325,51 @@ func (auth Auth) MarshalYAML() (interface{}, error) {
 	return map[string]Parameters(auth), nil
 }
 
-// Notifications configures multiple http endpoints.
+// Notifications configures multiple notification endpoints.
 type Notifications struct {
-	// Endpoints is a list of http configurations for endpoints that
-	// respond to webhook notifications. In the future, we may allow other
-	// kinds of endpoints, such as external queues.
+	// Endpoints is a list of configurations for endpoints that respond to
+	// webhook notifications or receive events through other transports,
+	// such as files, syslog or external queues.
 	Endpoints []Endpoint `yaml:"endpoints,omitempty"`
 }
 
-// Endpoint describes the configuration of an http webhook notification
-// endpoint.
+// Endpoint describes the configuration of a notification endpoint.
 type Endpoint struct {
-	Name      string        `yaml:"name"`      // identifies the endpoint in the registry instance.
-	Disabled  bool          `yaml:"disabled"`  // disables the endpoint
-	URL       string        `yaml:"url"`       // post url for the endpoint.
-	Headers   http.Header   `yaml:"headers"`   // static headers that should be added to all requests
-	Timeout   time.Duration `yaml:"timeout"`   // HTTP timeout
-	Threshold int           `yaml:"threshold"` // circuit breaker threshold before backing off on failure
-	Backoff   time.Duration `yaml:"backoff"`   // backoff duration
+	Name         string         `yaml:"name"`                   // identifies the endpoint in the registry instance.
+	Type         string         `yaml:"type,omitempty"`         // http (default), file, syslog or nats
+	Disabled     bool           `yaml:"disabled"`               // disables the endpoint
+	URL          string         `yaml:"url"`                    // post url, file path or server address of the endpoint.
+	Parameters   Parameters     `yaml:"parameters,omitempty"`   // options specific to the type of the endpoint
+	Headers      http.Header    `yaml:"headers"`                // static headers that should be added to all requests
+	Secret       string         `yaml:"secret,omitempty"`       // shared secret signing the requests
+	Timeout      time.Duration  `yaml:"timeout"`                // HTTP or NATS timeout
+	Threshold    int            `yaml:"threshold"`              // circuit breaker threshold before backing off on failure
+	Backoff      time.Duration  `yaml:"backoff"`                // backoff duration
+	Workers      int            `yaml:"workers,omitempty"`      // writes in flight at once
+	MaxBatchSize int            `yaml:"maxbatchsize,omitempty"` // maximum number of events written at once
+	BatchLinger  time.Duration  `yaml:"batchlinger,omitempty"`  // time waited for a batch to fill up
+	Queue        EndpointQueue  `yaml:"queue"`                  // durable queue of the events
+	Filter       EndpointFilter `yaml:"filter"`                 // events sent to the endpoint
+}
+
+// EndpointFilter selects the events sent to an endpoint, by default all of
+// them. An event is sent only if it matches all the criteria set.
+type EndpointFilter struct {
+	Actions           []string `yaml:"actions,omitempty"`           // actions of the events sent, such as push
+	Repositories      []string `yaml:"repositories,omitempty"`      // patterns of the repositories of the events sent, such as library/*
+	IgnoredMediaTypes []string `yaml:"ignoredmediatypes,omitempty"` // media types of the targets of the events not sent
+}
+
+// EndpointQueue configures a durable queue of the events of an endpoint, kept
+// on local disk so that events survive restarts of the registry. Without a
+// path, events are queued in memory.
+type EndpointQueue struct {
+	Path          string        `yaml:"path,omitempty"`          // directory holding the queue
+	Fsync         string        `yaml:"fsync,omitempty"`         // always, interval or never
+	FsyncInterval time.Duration `yaml:"fsyncinterval,omitempty"` // interval between syncs with the interval policy
+	MaxSize       int64         `yaml:"maxsize,omitempty"`       // maximum size of the pending events, in bytes
+	Overflow      string        `yaml:"overflow,omitempty"`      // dropnewest, dropoldest or block, when full
+	SegmentSize   int64         `yaml:"segmentsize,omitempty"`   // size of the files of the queue, in bytes
 }
 
 // Reporting defines error reporting methods.
@@ -358,6 +399,104 @@ type NewRelicReporting struct {
 	Name string `yaml:"name,omitempty"`
 }
 
+// Proxy configures the registry as a pull through cache of a remote
+// registry. Content missing from local storage is fetched from the remote
+// registry and stored locally before being served.
+type Proxy struct {
+	// RemoteURL is the base URL of the remote v2 registry, without the
+	// /v2/ path.
+	RemoteURL string `yaml:"remoteurl"`
+}
+
+// Maintenance configures maintenance operations of the registry.
+type Maintenance struct {
+	// ReadOnly configures the read-only mode of the registry.
+	ReadOnly ReadOnly `yaml:"readonly,omitempty"`
+
+	// UploadPurging configures the background purging of stale uploads.
+	UploadPurging UploadPurging `yaml:"uploadpurging,omitempty"`
+}
+
+// ReadOnly configures the read-only mode, in which the registry refuses all
+// requests modifying repositories while still serving pulls.
+type ReadOnly struct {
+	// Enabled puts the registry in read-only mode when it starts. The mode
+	// can be toggled at runtime through the debug server.
+	Enabled bool `yaml:"enabled,omitempty"`
+}
+
+// UploadPurging configures the background purging of uploads that were
+// abandoned by their clients.
+type UploadPurging struct {
+	// Enabled starts the purging of stale uploads.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Age is the age after which an upload is purged. It defaults to one
+	// week.
+	Age time.Duration `yaml:"age,omitempty"`
+
+	// Interval is the duration between purges. It defaults to 24 hours.
+	Interval time.Duration `yaml:"interval,omitempty"`
+
+	// DryRun only logs the uploads that would be purged.
+	DryRun bool `yaml:"dryrun,omitempty"`
+}
+
+// Health provides the configuration section for health checks. While any
+// check fails, the registry answers every request with 503 Service
+// Unavailable.
+type Health struct {
+	// FileCheckers is a list of paths to check. A check fails while the
+	// file exists, allowing the registry to be taken out of rotation.
+	FileCheckers []FileChecker `yaml:"file,omitempty"`
+
+	// HTTPCheckers is a list of URIs to check with HEAD requests. A check
+	// fails unless the response status is 200 OK.
+	HTTPCheckers []HTTPChecker `yaml:"http,omitempty"`
+
+	// StorageDriver configures a health check on the configured storage
+	// driver.
+	StorageDriver HealthChecker `yaml:"storagedriver,omitempty"`
+
+	// Redis configures a health check on the configured redis instance.
+	Redis HealthChecker `yaml:"redis,omitempty"`
+}
+
+// HealthChecker configures a built-in health check.
+type HealthChecker struct {
+	// Enabled turns the check on.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Interval is the duration between checks. It defaults to 10 seconds.
+	Interval time.Duration `yaml:"interval,omitempty"`
+
+	// Threshold is the number of consecutive failures after which the
+	// check reports an error. If zero, a single failure is reported.
+	Threshold int `yaml:"threshold,omitempty"`
+}
+
+// FileChecker configures a health check on the existence of a file.
+type FileChecker struct {
+	// File is the path of the file to check.
+	File string `yaml:"file"`
+
+	// Interval is the duration between checks. It defaults to 10 seconds.
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// HTTPChecker configures a health check on a URI.
+type HTTPChecker struct {
+	// URI is the URI to request.
+	URI string `yaml:"uri"`
+
+	// Interval is the duration between checks. It defaults to 10 seconds.
+	Interval time.Duration `yaml:"interval,omitempty"`
+
+	// Threshold is the number of consecutive failures after which the
+	// check reports an error. If zero, a single failure is reported.
+	Threshold int `yaml:"threshold,omitempty"`
+}
+
 // Middleware configures named middlewares to be applied at injection points.
 type Middleware struct {
 	// Name the middleware registers itself as
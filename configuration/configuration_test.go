@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	. "gopkg.in/check.v1"
 	"gopkg.in/yaml.v2"
@@ -56,6 +57,11 @@ var configStruct = Configuration{
 				Headers: http.Header{
 					"Authorization": []string{"Bearer <example>"},
 				},
+				Filter: EndpointFilter{
+					Actions:           []string{"push"},
+					Repositories:      []string{"library/*"},
+					IgnoredMediaTypes: []string{"application/octet-stream"},
+				},
 			},
 		},
 	},
@@ -110,6 +116,10 @@ notifications:
       url:  http://example.com
       headers:
         Authorization: [Bearer <example>]
+      filter:
+        actions: [push]
+        repositories: [library/*]
+        ignoredmediatypes: [application/octet-stream]
 reporting:
   bugsnag:
     apikey: BugsnagApiKey
@@ -134,6 +144,10 @@ notifications:
       url:  http://example.com
       headers:
         Authorization: [Bearer <example>]
+      filter:
+        actions: [push]
+        repositories: [library/*]
+        ignoredmediatypes: [application/octet-stream]
 `
 
 type ConfigSuite struct {
@@ -177,6 +191,100 @@ func (suite *ConfigSuite) TestParseInmemory(c *C) {
 	c.Assert(config, DeepEquals, suite.expectedConfig)
 }
 
+// TestParseStorageDelete validates that a delete section may be provided
+// alongside the storage driver without being mistaken for a driver type.
+func (suite *ConfigSuite) TestParseStorageDelete(c *C) {
+	configYaml := `
+version: 0.1
+storage:
+  inmemory:
+  delete:
+    enabled: true
+`
+	config, err := Parse(bytes.NewReader([]byte(configYaml)))
+	c.Assert(err, IsNil)
+	c.Assert(config.Storage.Type(), Equals, "inmemory")
+	c.Assert(config.Storage["delete"], DeepEquals, Parameters{"enabled": true})
+}
+
+// TestParseProxy validates that the proxy section may be provided and
+// overridden from the environment.
+func (suite *ConfigSuite) TestParseProxy(c *C) {
+	configYaml := `
+version: 0.1
+storage: inmemory
+proxy:
+  remoteurl: https://registry-1.docker.io
+`
+	config, err := Parse(bytes.NewReader([]byte(configYaml)))
+	c.Assert(err, IsNil)
+	c.Assert(config.Proxy, DeepEquals, Proxy{RemoteURL: "https://registry-1.docker.io"})
+
+	os.Setenv("REGISTRY_PROXY_REMOTEURL", "http://mirror.example.com:5000")
+	defer os.Unsetenv("REGISTRY_PROXY_REMOTEURL")
+
+	config, err = Parse(bytes.NewReader([]byte(configYaml)))
+	c.Assert(err, IsNil)
+	c.Assert(config.Proxy.RemoteURL, Equals, "http://mirror.example.com:5000")
+}
+
+// TestParseHealth validates that the health check section is parsed.
+func (suite *ConfigSuite) TestParseHealth(c *C) {
+	configYaml := `
+version: 0.1
+storage: inmemory
+health:
+  storagedriver:
+    enabled: true
+    interval: 5s
+    threshold: 3
+  file:
+    - file: /tmp/out-of-rotation
+  http:
+    - uri: http://server.example.com/health
+      interval: 1m
+      threshold: 2
+`
+	config, err := Parse(bytes.NewReader([]byte(configYaml)))
+	c.Assert(err, IsNil)
+	c.Assert(config.Health, DeepEquals, Health{
+		FileCheckers: []FileChecker{
+			{File: "/tmp/out-of-rotation"},
+		},
+		HTTPCheckers: []HTTPChecker{
+			{URI: "http://server.example.com/health", Interval: time.Minute, Threshold: 2},
+		},
+		StorageDriver: HealthChecker{Enabled: true, Interval: 5 * time.Second, Threshold: 3},
+	})
+}
+
+// TestParseMaintenance validates that the maintenance section is parsed.
+func (suite *ConfigSuite) TestParseMaintenance(c *C) {
+	configYaml := `
+version: 0.1
+storage: inmemory
+maintenance:
+  readonly:
+    enabled: true
+  uploadpurging:
+    enabled: true
+    age: 72h
+    interval: 12h
+    dryrun: true
+`
+	config, err := Parse(bytes.NewReader([]byte(configYaml)))
+	c.Assert(err, IsNil)
+	c.Assert(config.Maintenance, DeepEquals, Maintenance{
+		ReadOnly: ReadOnly{Enabled: true},
+		UploadPurging: UploadPurging{
+			Enabled:  true,
+			Age:      72 * time.Hour,
+			Interval: 12 * time.Hour,
+			DryRun:   true,
+		},
+	})
+}
+
 // TestParseIncomplete validates that an incomplete yaml configuration cannot
 // be parsed without providing environment variables to fill in the missing
 // components.
@@ -21,6 +21,10 @@ var (
 	// ErrLayerClosed returned when an operation is attempted on a closed
 	// Layer or LayerUpload.
 	ErrLayerClosed = fmt.Errorf("layer closed")
+
+	// ErrUnsupported is returned when an operation is not supported by the
+	// service, such as a push to a read only pull through cache.
+	ErrUnsupported = fmt.Errorf("operation unsupported")
 )
 
 // ErrRepositoryUnknown is returned if the named repository is not known by
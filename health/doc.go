@@ -127,4 +127,12 @@
 // are a minimum of two failures in a row:
 //
 //  health.Register("httpChecker", health.PeriodicThresholdChecker(checks.HTTPChecker("https://www.google.pt"), time.Second*5, 2))
+//
+// Failing Requests
+//
+// To take the application itself out of rotation while any check fails,
+// wrap its handler with "Handler". Requests are then answered with a 503 and
+// the JSON status of the failed checks, rather than passed through:
+//
+//  http.ListenAndServe(":5000", health.Handler(app))
 package health
@@ -206,6 +206,26 @@ func StatusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Handler returns a handler that will return 503 response code if the health
+// checks have failed. If everything is okay with the health checks, the
+// handler will pass through to the provided handler. Use this handler to
+// disable a web application when the health checks fail.
+func Handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checksStatus := CheckStatus()
+		if len(checksStatus) != 0 {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			if err := json.NewEncoder(w).Encode(checksStatus); err != nil {
+				w.Write([]byte("{server_error: 'Could not parse error message'}"))
+			}
+			return
+		}
+
+		handler.ServeHTTP(w, r) // pass through
+	})
+}
+
 // Registers global /debug/health api endpoint
 func init() {
 	http.HandleFunc("/debug/health", StatusHandler)
@@ -45,3 +45,56 @@ func TestReturns503IfThereAreErrorChecks(t *testing.T) {
 		t.Errorf("Did not get a 503.")
 	}
 }
+
+// TestHealthHandler ensures that our handler implementation correctly protects
+// the web application when things aren't so healthy.
+func TestHealthHandler(t *testing.T) {
+	// Run against a clean set of checks, independent of the other tests.
+	mutex.Lock()
+	saved := registeredChecks
+	registeredChecks = make(map[string]Checker)
+	mutex.Unlock()
+	defer func() {
+		mutex.Lock()
+		registeredChecks = saved
+		mutex.Unlock()
+	}()
+
+	// Create a manual updater, so the status can be controlled.
+	updater := NewStatusUpdater()
+	Register("test_check", updater)
+
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	checkUp := func(t *testing.T, message string) {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "https://fakeurl.com/v2/", nil)
+		handler.ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusNoContent {
+			t.Fatalf("%s: request not passed through, got %d", message, recorder.Code)
+		}
+	}
+
+	checkDown := func(t *testing.T, message string) {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "https://fakeurl.com/v2/", nil)
+		handler.ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusServiceUnavailable {
+			t.Fatalf("%s: expected 503, got %d", message, recorder.Code)
+		}
+	}
+
+	checkUp(t, "initial health check")
+
+	// now, we fail the health check
+	updater.Update(errors.New("down"))
+	checkDown(t, "failed health check")
+
+	// fix it
+	updater.Update(nil)
+	checkUp(t, "fixed health check")
+}
@@ -0,0 +1,334 @@
+// Package metrics provides counters and histograms for instrumenting the
+// registry, exported in the Prometheus text exposition format.
+//
+// The package works expvar style. By importing the package the debug server
+// is getting a "/metrics" endpoint that returns the current value of all
+// registered metrics:
+//
+//	var requests = metrics.NewCounter("app_requests_total", "Total requests.", "method")
+//
+//	func init() {
+//	  metrics.Register(requests)
+//	}
+//
+//	requests.Inc("GET")
+//
+// Metrics are partitioned by the values of their labels, which must be given
+// in the order of the label names of the metric.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	mutex             sync.RWMutex
+	registeredMetrics = make(map[string]Metric)
+)
+
+// DefaultBuckets are the histogram buckets suited to measure the latency of
+// network operations, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metric is the interface implemented by the metrics of this package.
+type Metric interface {
+	// Name returns the name of the metric.
+	Name() string
+
+	// write writes the metric in the text exposition format.
+	write(w io.Writer)
+}
+
+// Register adds the metric to the exported metrics. Registering two metrics
+// with the same name panics.
+func Register(metric Metric) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := registeredMetrics[metric.Name()]; ok {
+		panic("Metric already exists: " + metric.Name())
+	}
+	registeredMetrics[metric.Name()] = metric
+}
+
+// WriteTo writes all registered metrics to w in the text exposition format,
+// sorted by name.
+func WriteTo(w io.Writer) error {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	names := make([]string, 0, len(registeredMetrics))
+	for name := range registeredMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		registeredMetrics[name].write(bw)
+	}
+
+	return bw.Flush()
+}
+
+// Handler writes all registered metrics in the text exposition format.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	WriteTo(w)
+}
+
+// Registers global /metrics endpoint
+func init() {
+	http.HandleFunc("/metrics", Handler)
+}
+
+// desc holds the description shared by all metric types.
+type desc struct {
+	name       string
+	help       string
+	labelNames []string
+}
+
+// Name returns the name of the metric.
+func (d desc) Name() string {
+	return d.name
+}
+
+// key returns the key of the series identified by labelValues, panicking if
+// the number of values does not match the labels of the metric.
+func (d desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labelNames) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", d.name, len(d.labelNames), len(labelValues)))
+	}
+
+	return strings.Join(labelValues, "\xff")
+}
+
+func (d desc) writeHeader(w io.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, helpEscaper.Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, typ)
+}
+
+// labels formats the label pairs of a series, with an optional extra pair
+// appended.
+func (d desc) labels(labelValues []string, extra ...string) string {
+	var pairs []string
+	for i, name := range d.labelNames {
+		pairs = append(pairs, name+`="`+labelValueEscaper.Replace(labelValues[i])+`"`)
+	}
+
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+`="`+extra[1]+`"`)
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// Counter is a metric counting events, partitioned by its labels.
+type Counter struct {
+	desc
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// NewCounter returns a counter with the given name, help text and label
+// names. The counter must be registered to be exported.
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	return &Counter{
+		desc:   desc{name: name, help: help, labelNames: labelNames},
+		series: make(map[string]*counterSeries),
+	}
+}
+
+// Inc increments the counter for the label values by one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the counter for the label values. Counters can only
+// increase, so v must not be negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("metric %s: counter cannot decrease", c.name))
+	}
+
+	key := c.key(labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{labelValues: append([]string(nil), labelValues...)}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+// Value returns the current value of the counter for the label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.series[key]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeHeader(w, "counter")
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labels(s.labelValues), formatFloat(s.value))
+	}
+}
+
+// Histogram is a metric sampling observations, such as request durations,
+// into buckets, partitioned by its labels.
+type Histogram struct {
+	desc
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+// NewHistogram returns a histogram with the given name, help text, upper
+// bounds of the buckets and label names. The histogram must be registered to
+// be exported.
+func NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &Histogram{
+		desc:    desc{name: name, help: help, labelNames: labelNames},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+}
+
+// Observe adds an observation of v to the histogram for the label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+// Count returns the number of observations of the histogram for the label
+// values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	key := h.key(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if s, ok := h.series[key]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w, "histogram")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(s.labelValues, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labels(s.labelValues), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labels(s.labelValues), s.count)
+	}
+}
+
+// sortedKeys returns the keys of the series map m in order, so that the
+// output is stable.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*counterSeries:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string]*histogramSeries:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestExposition ensures that counters and histograms are written in the text
+// exposition format.
+func TestExposition(t *testing.T) {
+	counter := NewCounter("test_requests_total", "Total test requests.", "method", "code")
+	counter.Inc("GET", "200")
+	counter.Add(2, "GET", "200")
+	counter.Inc("PUT", "201")
+
+	if v := counter.Value("GET", "200"); v != 3 {
+		t.Fatalf("unexpected counter value: %v != 3", v)
+	}
+
+	histogram := NewHistogram("test_request_duration_seconds", "Test request durations.", []float64{1, 0.1}, "method")
+	histogram.Observe(0.05, "GET")
+	histogram.Observe(0.5, "GET")
+	histogram.Observe(2, "GET")
+
+	if c := histogram.Count("GET"); c != 3 {
+		t.Fatalf("unexpected histogram count: %v != 3", c)
+	}
+
+	var buf bytes.Buffer
+	counter.write(&buf)
+	histogram.write(&buf)
+
+	expected := `# HELP test_requests_total Total test requests.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",code="200"} 3
+test_requests_total{method="PUT",code="201"} 1
+# HELP test_request_duration_seconds Test request durations.
+# TYPE test_request_duration_seconds histogram
+test_request_duration_seconds_bucket{method="GET",le="0.1"} 1
+test_request_duration_seconds_bucket{method="GET",le="1"} 2
+test_request_duration_seconds_bucket{method="GET",le="+Inf"} 3
+test_request_duration_seconds_sum{method="GET"} 2.55
+test_request_duration_seconds_count{method="GET"} 3
+`
+	if buf.String() != expected {
+		t.Fatalf("unexpected exposition:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+// TestLabelEscaping ensures that label values are escaped.
+func TestLabelEscaping(t *testing.T) {
+	counter := NewCounter("test_escaping_total", "Escaping\ntest.", "path")
+	counter.Inc("a\"b\\c\nd")
+
+	var buf bytes.Buffer
+	counter.write(&buf)
+
+	if !strings.Contains(buf.String(), `# HELP test_escaping_total Escaping\ntest.`) {
+		t.Fatalf("help not escaped: %s", buf.String())
+	}
+
+	if !strings.Contains(buf.String(), `test_escaping_total{path="a\"b\\c\nd"} 1`) {
+		t.Fatalf("label value not escaped: %s", buf.String())
+	}
+}
+
+// TestLabelMismatch ensures that using the wrong number of label values
+// panics.
+func TestLabelMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic with missing label values")
+		}
+	}()
+
+	NewCounter("test_mismatch_total", "Mismatch test.", "method").Inc()
+}
+
+// TestHandler ensures that registered metrics are served.
+func TestHandler(t *testing.T) {
+	counter := NewCounter("test_handler_total", "Handler test.")
+	Register(counter)
+	counter.Inc()
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "https://fakeurl.com/metrics", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request.")
+	}
+
+	Handler(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", recorder.Code)
+	}
+
+	if !strings.Contains(recorder.Body.String(), "test_handler_total 1\n") {
+		t.Fatalf("registered metric not served: %s", recorder.Body.String())
+	}
+}
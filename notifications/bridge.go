@@ -65,6 +65,21 @@ func (b *bridge) ManifestDeleted(repo distribution.Repository, sm *manifest.Sign
 	return b.createManifestEventAndWrite(EventActionDelete, repo, sm)
 }
 
+func (b *bridge) TagDeleted(repo distribution.Repository, tag string) error {
+	event := b.createEvent(EventActionDelete)
+	event.Target.MediaType = manifest.ManifestMediaType
+	event.Target.Repository = repo.Name()
+	event.Target.Tag = tag
+
+	var err error
+	event.Target.URL, err = b.ub.BuildManifestURL(repo.Name(), tag)
+	if err != nil {
+		return err
+	}
+
+	return b.sink.Write(*event)
+}
+
 func (b *bridge) LayerPushed(repo distribution.Repository, layer distribution.Layer) error {
 	return b.createLayerEventAndWrite(EventActionPush, repo, layer)
 }
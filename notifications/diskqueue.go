@@ -0,0 +1,804 @@
+package notifications
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// segmentSuffix is the extension of the log segment files, named after
+	// their zero padded sequence number.
+	segmentSuffix = ".log"
+
+	// cursorFile holds the position of the first event not yet delivered.
+	cursorFile = "cursor"
+
+	// recordHeaderSize is the size of the header of each record of the log:
+	// the length and the CRC-32 checksum of the payload.
+	recordHeaderSize = 8
+)
+
+var errCorruptRecord = errors.New("diskqueue: corrupt record")
+
+// position locates a record in the log of a diskQueue.
+type position struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+// segment is a log segment file of a diskQueue.
+type segment struct {
+	id   uint64
+	size int64
+}
+
+// diskQueue accepts all messages into an append-only log on disk, for
+// asynchronous consumption by a sink. Each block of events written is a
+// record of the log, removed once written successfully to the sink, so that
+// undelivered events are delivered again after a restart: delivery is at
+// least once. The sink is expected to retry until it succeeds or is closed.
+//
+// Consecutive records are written to the sink in batches, waiting up to the
+// linger time for a batch to fill up. A single batch is in flight at once, so
+// that the log is consumed in order: unlike the eventQueue, the diskQueue
+// does not dispatch to a pool of workers, and endpoints with a durable queue
+// are limited to a single one.
+type diskQueue struct {
+	sink      Sink
+	config    QueueConfig
+	maxBatch  int
+	linger    time.Duration
+	listeners []eventQueueListener
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	closed   bool
+	done     chan struct{}
+	segments []segment // segments on disk, in order
+	head     position  // first record not yet delivered
+	saved    position  // head as last saved in the cursor file
+	writer   *os.File  // last segment, open for appending
+	reader   *os.File  // segment the head is in, open for reading
+	readerID uint64
+	flight   []Event // events in flight, if any
+}
+
+// newDiskQueue opens the durable queue in the directory of the config,
+// creating it if needed, and starts delivering the events pending in it to
+// the sink. Batches hold at most maxBatch events, unless it is zero, or a
+// single larger record.
+func newDiskQueue(sink Sink, config QueueConfig, maxBatch int, linger time.Duration, listeners ...eventQueueListener) (*diskQueue, error) {
+	config.defaults()
+	switch config.Fsync {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return nil, fmt.Errorf("diskqueue: unknown fsync policy %q", config.Fsync)
+	}
+
+	switch config.Overflow {
+	case OverflowDropNewest, OverflowDropOldest, OverflowBlock:
+	default:
+		return nil, fmt.Errorf("diskqueue: unknown overflow policy %q", config.Overflow)
+	}
+
+	dq := &diskQueue{
+		sink:      sink,
+		config:    config,
+		maxBatch:  maxBatch,
+		linger:    linger,
+		listeners: listeners,
+		done:      make(chan struct{}),
+	}
+	dq.cond = sync.NewCond(&dq.mu)
+
+	if err := dq.open(); err != nil {
+		dq.closeFiles()
+		return nil, err
+	}
+
+	go dq.run()
+	if config.Fsync == FsyncInterval {
+		go dq.syncPeriodically()
+	}
+
+	return dq, nil
+}
+
+// Write appends the events to the log, only failing if the queue has been
+// closed or the log could not be written to.
+func (dq *diskQueue) Write(events ...Event) error {
+	p, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	size := int64(recordHeaderSize + len(p))
+
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+
+	if dq.closed {
+		return ErrSinkClosed
+	}
+
+	for _, listener := range dq.listeners {
+		listener.ingress(events...)
+	}
+
+	// A block is always accepted into an empty queue, however large.
+	for pending := dq.pending(); pending > 0 && pending+size > dq.config.MaxSize; pending = dq.pending() {
+		switch dq.config.Overflow {
+		case OverflowDropNewest:
+			logrus.Warnf("diskqueue: queue %s full, dropping %d events", dq.config.Path, len(events))
+			for _, listener := range dq.listeners {
+				listener.drop(events...)
+			}
+			return nil
+		case OverflowDropOldest:
+			dq.dropOldest(pending + size - dq.config.MaxSize)
+		case OverflowBlock:
+			dq.cond.Wait()
+			if dq.closed {
+				return ErrSinkClosed
+			}
+		}
+	}
+
+	if err := dq.append(p); err != nil {
+		for _, listener := range dq.listeners {
+			listener.drop(events...)
+		}
+		return err
+	}
+
+	dq.cond.Broadcast() // signal waiters
+	return nil
+}
+
+// Close shuts down the queue and its sink. Events not yet delivered remain
+// in the log, to be delivered when it is opened again.
+func (dq *diskQueue) Close() error {
+	dq.mu.Lock()
+	if dq.closed {
+		dq.mu.Unlock()
+		return fmt.Errorf("diskqueue: already closed")
+	}
+
+	dq.closed = true
+	dq.cond.Broadcast()
+	dq.mu.Unlock()
+
+	// Closing the sink interrupts any write in progress.
+	err := dq.sink.Close()
+	<-dq.done
+
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+	if dq.writer != nil && dq.config.Fsync != FsyncNever {
+		if syncErr := dq.writer.Sync(); syncErr != nil && err == nil {
+			err = syncErr
+		}
+	}
+	dq.closeFiles()
+
+	return err
+}
+
+// run is the main goroutine to deliver events to the target sink.
+func (dq *diskQueue) run() {
+	defer close(dq.done)
+
+	for {
+		block, from, to, ok := dq.next()
+		if !ok {
+			return // the queue is closed.
+		}
+
+		if err := dq.sink.Write(block...); err != nil {
+			dq.mu.Lock()
+			dq.settle()
+			dq.mu.Unlock()
+
+			if err == ErrSinkClosed {
+				return
+			}
+
+			// The events are left in the queue to be written again.
+			logrus.Errorf("diskqueue: error writing events to %v, retrying: %v", dq.sink, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		if dq.ack(from, to) {
+			for _, listener := range dq.listeners {
+				listener.egress(block...)
+			}
+		}
+	}
+}
+
+// next returns the batch of events at the head of the queue, waiting for
+// one to be written if the queue is empty, along with its position and the
+// position following it. It returns false once the queue is closed.
+func (dq *diskQueue) next() ([]Event, position, position, bool) {
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+
+	var deadline time.Time
+	for {
+		if dq.closed {
+			return nil, position{}, position{}, false
+		}
+
+		// Records may have been appended to a new segment.
+		dq.advance()
+
+		if dq.pending() > 0 {
+			batch, next, full, err := dq.readBatch()
+			if err == nil {
+				if !full && dq.linger > 0 {
+					if deadline.IsZero() {
+						deadline = time.Now().Add(dq.linger)
+					}
+
+					if time.Now().Before(deadline) {
+						waitUntil(dq.cond, deadline)
+						continue
+					}
+				}
+
+				dq.flight = batch
+				for _, listener := range dq.listeners {
+					listener.dispatch(batch...)
+				}
+				return batch, dq.head, next, true
+			}
+
+			logrus.Errorf("diskqueue: error reading %s at %v, skipping to the next segment: %v", dq.config.Path, dq.head, err)
+			if err := dq.skipSegment(); err != nil {
+				logrus.Errorf("diskqueue: error skipping segment of %s: %v", dq.config.Path, err)
+				dq.cond.Wait()
+			}
+			continue
+		}
+
+		dq.cond.Wait()
+	}
+}
+
+// ack moves the head of the queue from the position of a block written to
+// the sink to the following one. It returns false if the block has been
+// dropped from the queue in the meantime.
+func (dq *diskQueue) ack(from, to position) bool {
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+
+	dq.settle()
+	if dq.head != from {
+		return false
+	}
+
+	dq.head = to
+	dq.advance()
+	dq.cond.Broadcast() // signal writers waiting for room
+	return true
+}
+
+// dropOldest drops blocks from the head of the queue until at least size
+// bytes are freed or the queue is empty.
+func (dq *diskQueue) dropOldest(size int64) {
+	// The batch in flight, at the head, is dropped first.
+	dq.settle()
+
+	var dropped []Event
+	for start := dq.pending(); start-dq.pending() < size && dq.pending() > 0; {
+		block, next, err := dq.read(dq.head)
+		if err != nil {
+			logrus.Errorf("diskqueue: error reading %s at %v, skipping to the next segment: %v", dq.config.Path, dq.head, err)
+			if err := dq.skipSegment(); err != nil {
+				logrus.Errorf("diskqueue: error skipping segment of %s: %v", dq.config.Path, err)
+				break
+			}
+			continue
+		}
+
+		dropped = append(dropped, block...)
+		dq.head = next
+		dq.advance()
+	}
+
+	logrus.Warnf("diskqueue: queue %s full, dropped %d oldest events", dq.config.Path, len(dropped))
+	for _, listener := range dq.listeners {
+		listener.drop(dropped...)
+	}
+}
+
+// settle reports the events in flight to the listeners as written, whether
+// successfully or not.
+func (dq *diskQueue) settle() {
+	if dq.flight == nil {
+		return
+	}
+
+	for _, listener := range dq.listeners {
+		listener.settle(dq.flight...)
+	}
+	dq.flight = nil
+}
+
+// readBatch reads records from the head of the queue, as long as their events
+// fit in a batch, returning their events, the position following them and
+// whether the batch is full. An error is returned only if the record at the
+// head cannot be read.
+func (dq *diskQueue) readBatch() ([]Event, position, bool, error) {
+	var batch []Event
+	pos := dq.head
+	for {
+		var ok bool
+		if pos, ok = dq.nextRecord(pos); !ok {
+			return batch, pos, false, nil
+		}
+
+		events, next, err := dq.read(pos)
+		if err != nil {
+			if len(batch) == 0 {
+				return nil, pos, false, err
+			}
+
+			// The error is handled once the record is at the head.
+			return batch, pos, true, nil
+		}
+
+		if len(batch) > 0 && dq.maxBatch > 0 && len(batch)+len(events) > dq.maxBatch {
+			return batch, pos, true, nil
+		}
+
+		batch = append(batch, events...)
+		pos = next
+		if dq.maxBatch > 0 && len(batch) >= dq.maxBatch {
+			return batch, pos, true, nil
+		}
+	}
+}
+
+// nextRecord returns the position of the record at pos or, at the end of a
+// segment, at the start of the next one. It returns false if there is no
+// record.
+func (dq *diskQueue) nextRecord(pos position) (position, bool) {
+	for i, seg := range dq.segments {
+		if seg.id != pos.Segment {
+			continue
+		}
+
+		if pos.Offset < seg.size {
+			return pos, true
+		}
+
+		if i+1 < len(dq.segments) && dq.segments[i+1].size > 0 {
+			return position{Segment: dq.segments[i+1].id}, true
+		}
+		break
+	}
+
+	return pos, false
+}
+
+// pending returns the size of the records not yet delivered.
+func (dq *diskQueue) pending() int64 {
+	var size int64
+	for _, seg := range dq.segments {
+		if seg.id >= dq.head.Segment {
+			size += seg.size
+		}
+	}
+	return size - dq.head.Offset
+}
+
+// advance moves the head past fully delivered segments, removing them, and
+// saves it if it moved.
+func (dq *diskQueue) advance() {
+	for len(dq.segments) > 1 {
+		first := dq.segments[0]
+		if first.id == dq.head.Segment && dq.head.Offset >= first.size {
+			dq.head = position{Segment: dq.segments[1].id}
+		} else if first.id >= dq.head.Segment {
+			break
+		}
+		dq.removeSegment()
+	}
+
+	if dq.head == dq.saved {
+		return
+	}
+
+	if err := dq.saveCursor(); err != nil {
+		logrus.Errorf("diskqueue: error saving cursor of %s: %v", dq.config.Path, err)
+		return
+	}
+	dq.saved = dq.head
+}
+
+// skipSegment moves the head to the next segment, starting a new one if the
+// head is in the last segment.
+func (dq *diskQueue) skipSegment() error {
+	if len(dq.segments) == 1 {
+		if err := dq.roll(); err != nil {
+			return err
+		}
+	}
+
+	dq.head = position{Segment: dq.segments[0].id, Offset: dq.segments[0].size}
+	dq.advance()
+	return nil
+}
+
+// removeSegment deletes the first segment of the log.
+func (dq *diskQueue) removeSegment() {
+	id := dq.segments[0].id
+	dq.segments = dq.segments[1:]
+
+	if dq.reader != nil && dq.readerID == id {
+		dq.reader.Close()
+		dq.reader = nil
+	}
+
+	if err := os.Remove(dq.segmentPath(id)); err != nil {
+		logrus.Errorf("diskqueue: error removing delivered segment: %v", err)
+	}
+}
+
+// read decodes the record at pos, returning its events and the position of
+// the next record.
+func (dq *diskQueue) read(pos position) ([]Event, position, error) {
+	var seg *segment
+	for i := range dq.segments {
+		if dq.segments[i].id == pos.Segment {
+			seg = &dq.segments[i]
+		}
+	}
+	if seg == nil {
+		return nil, pos, fmt.Errorf("diskqueue: no segment %d", pos.Segment)
+	}
+
+	if dq.reader == nil || dq.readerID != pos.Segment {
+		if dq.reader != nil {
+			dq.reader.Close()
+			dq.reader = nil
+		}
+
+		f, err := os.Open(dq.segmentPath(pos.Segment))
+		if err != nil {
+			return nil, pos, err
+		}
+		dq.reader, dq.readerID = f, pos.Segment
+	}
+
+	events, size, err := readRecord(io.NewSectionReader(dq.reader, pos.Offset, seg.size-pos.Offset))
+	if err != nil {
+		return nil, pos, err
+	}
+
+	return events, position{Segment: pos.Segment, Offset: pos.Offset + size}, nil
+}
+
+// append writes the payload as a new record at the end of the log.
+func (dq *diskQueue) append(p []byte) error {
+	last := &dq.segments[len(dq.segments)-1]
+	size := int64(recordHeaderSize + len(p))
+	if last.size > 0 && last.size+size > dq.config.SegmentSize {
+		if err := dq.roll(); err != nil {
+			return err
+		}
+		last = &dq.segments[len(dq.segments)-1]
+		dq.advance()
+	}
+
+	record := make([]byte, size)
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(p)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(p))
+	copy(record[recordHeaderSize:], p)
+
+	if _, err := dq.writer.Write(record); err != nil {
+		// Leave no partial record behind.
+		dq.writer.Truncate(last.size)
+		return err
+	}
+
+	if dq.config.Fsync == FsyncAlways {
+		if err := dq.writer.Sync(); err != nil {
+			return err
+		}
+	}
+
+	last.size += size
+	return nil
+}
+
+// roll starts a new segment, to which records are appended from then on.
+func (dq *diskQueue) roll() error {
+	var id uint64 = 1
+	if len(dq.segments) > 0 {
+		id = dq.segments[len(dq.segments)-1].id + 1
+	}
+
+	f, err := os.OpenFile(dq.segmentPath(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	if dq.writer != nil {
+		if dq.config.Fsync != FsyncNever {
+			dq.writer.Sync()
+		}
+		dq.writer.Close()
+	}
+
+	dq.writer = f
+	dq.segments = append(dq.segments, segment{id: id})
+	return dq.syncDir()
+}
+
+// open loads the segments and the cursor of the log, truncating any record
+// left incomplete at the end of the last segment by a crash, and reports the
+// events pending in it to the listeners.
+func (dq *diskQueue) open() error {
+	if err := os.MkdirAll(dq.config.Path, 0700); err != nil {
+		return err
+	}
+
+	fis, err := ioutil.ReadDir(dq.config.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range fis {
+		if !strings.HasSuffix(fi.Name(), segmentSuffix) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(fi.Name(), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		dq.segments = append(dq.segments, segment{id: id, size: fi.Size()})
+	}
+	sort.Sort(segmentsByID(dq.segments))
+
+	if len(dq.segments) == 0 {
+		if err := dq.roll(); err != nil {
+			return err
+		}
+	} else {
+		last := &dq.segments[len(dq.segments)-1]
+		f, err := os.OpenFile(dq.segmentPath(last.id), os.O_RDWR|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		dq.writer = f
+
+		valid, err := validSize(f, last.size)
+		if err != nil {
+			return err
+		}
+		if valid < last.size {
+			logrus.Warnf("diskqueue: truncating incomplete records at the end of %s", dq.segmentPath(last.id))
+			if err := f.Truncate(valid); err != nil {
+				return err
+			}
+			last.size = valid
+		}
+	}
+
+	dq.head = position{Segment: dq.segments[0].id}
+	dq.saved = position{} // the cursor is saved if it does not exist
+	p, err := ioutil.ReadFile(filepath.Join(dq.config.Path, cursorFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var cursor position
+		if err := json.Unmarshal(p, &cursor); err != nil {
+			return fmt.Errorf("diskqueue: invalid cursor in %s: %v", dq.config.Path, err)
+		}
+
+		dq.saved = cursor
+		for _, seg := range dq.segments {
+			if seg.id == cursor.Segment {
+				if cursor.Offset > seg.size {
+					cursor.Offset = seg.size
+				}
+				dq.head = cursor
+			} else if seg.id < cursor.Segment {
+				// Segments delivered but not yet removed by a crash.
+				dq.head = position{Segment: seg.id, Offset: seg.size}
+			}
+		}
+	}
+	dq.advance()
+
+	return dq.replay()
+}
+
+// replay reports the events pending in the log to the listeners, as if they
+// were just written.
+func (dq *diskQueue) replay() error {
+	pos := dq.head
+	for _, seg := range dq.segments {
+		if seg.id < pos.Segment {
+			continue
+		}
+		if seg.id > pos.Segment {
+			pos = position{Segment: seg.id}
+		}
+
+		for pos.Offset < seg.size {
+			events, next, err := dq.read(pos)
+			if err != nil {
+				// Delivery skips the rest of the segment as well.
+				break
+			}
+
+			for _, listener := range dq.listeners {
+				listener.ingress(events...)
+			}
+			pos = next
+		}
+	}
+
+	return nil
+}
+
+// saveCursor saves the head position, replacing the cursor file atomically.
+func (dq *diskQueue) saveCursor() error {
+	p, err := json.Marshal(dq.head)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dq.config.Path, cursorFile)
+	f, err := os.OpenFile(path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(p); err != nil {
+		f.Close()
+		return err
+	}
+
+	if dq.config.Fsync == FsyncAlways {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// syncDir flushes the directory entries of the log, following the fsync
+// policy.
+func (dq *diskQueue) syncDir() error {
+	if dq.config.Fsync != FsyncAlways {
+		return nil
+	}
+
+	dir, err := os.Open(dq.config.Path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
+
+// syncPeriodically flushes the log to disk every FsyncInterval, until the
+// queue is closed.
+func (dq *diskQueue) syncPeriodically() {
+	ticker := time.NewTicker(dq.config.FsyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			dq.mu.Lock()
+			if dq.writer != nil {
+				if err := dq.writer.Sync(); err != nil {
+					logrus.Errorf("diskqueue: error syncing %s: %v", dq.config.Path, err)
+				}
+			}
+			dq.mu.Unlock()
+		case <-dq.done:
+			return
+		}
+	}
+}
+
+// closeFiles closes the open segment files.
+func (dq *diskQueue) closeFiles() {
+	if dq.writer != nil {
+		dq.writer.Close()
+		dq.writer = nil
+	}
+
+	if dq.reader != nil {
+		dq.reader.Close()
+		dq.reader = nil
+	}
+}
+
+func (dq *diskQueue) segmentPath(id uint64) string {
+	return filepath.Join(dq.config.Path, fmt.Sprintf("%020d%s", id, segmentSuffix))
+}
+
+// readRecord decodes the record at the start of r, returning its events and
+// its size. A record claiming to be larger than the rest of r is corrupt,
+// and is rejected before its payload is allocated.
+func readRecord(r *io.SectionReader) ([]Event, int64, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, errCorruptRecord
+	}
+
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	if length > r.Size()-recordHeaderSize {
+		return nil, 0, errCorruptRecord
+	}
+
+	p := make([]byte, length)
+	if _, err := io.ReadFull(r, p); err != nil {
+		return nil, 0, errCorruptRecord
+	}
+
+	if crc32.ChecksumIEEE(p) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, errCorruptRecord
+	}
+
+	var events []Event
+	if err := json.Unmarshal(p, &events); err != nil {
+		return nil, 0, errCorruptRecord
+	}
+
+	return events, int64(recordHeaderSize + len(p)), nil
+}
+
+// validSize returns the size of the complete records at the start of the
+// segment file.
+func validSize(f *os.File, size int64) (int64, error) {
+	var valid int64
+	for valid < size {
+		_, n, err := readRecord(io.NewSectionReader(f, valid, size-valid))
+		if err == errCorruptRecord {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		valid += n
+	}
+
+	return valid, nil
+}
+
+type segmentsByID []segment
+
+func (s segmentsByID) Len() int           { return len(s) }
+func (s segmentsByID) Less(i, j int) bool { return s[i].id < s[j].id }
+func (s segmentsByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
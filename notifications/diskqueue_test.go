@@ -0,0 +1,398 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiskQueue(t *testing.T) {
+	const nevents = 1000
+	dir := tempQueueDir(t)
+	defer os.RemoveAll(dir)
+
+	var ts testSink
+	metrics := newSafeMetrics()
+	dq, err := newDiskQueue(
+		&delayedSink{
+			Sink:  &ts,
+			delay: time.Millisecond * 1,
+		}, QueueConfig{Path: dir, SegmentSize: 4096}, 0, 0, metrics.eventQueueListener())
+	if err != nil {
+		t.Fatalf("unexpected error opening queue: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var block []Event
+	for i := 1; i <= nevents; i++ {
+		block = append(block, createTestEvent("push", "library/test", "blob"))
+		if i%10 == 0 && i > 0 {
+			wg.Add(1)
+			go func(block ...Event) {
+				if err := dq.Write(block...); err != nil {
+					t.Errorf("error writing event block: %v", err)
+				}
+				wg.Done()
+			}(block...)
+
+			block = nil
+		}
+	}
+
+	wg.Wait()
+	waitPending(t, metrics)
+	checkClose(t, dq)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	if len(ts.events) != nevents {
+		t.Fatalf("events did not make it to the sink: %d != %d", len(ts.events), nevents)
+	}
+
+	if !ts.closed {
+		t.Fatalf("sink should have been closed")
+	}
+
+	if metrics.Events != nevents {
+		t.Fatalf("unexpected ingress count: %d != %d", metrics.Events, nevents)
+	}
+
+	// Delivered segments are removed, leaving only the last one.
+	segments, err := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("delivered segments were not removed: %v", segments)
+	}
+}
+
+func TestDiskQueueRedelivery(t *testing.T) {
+	const nevents = 30
+	dir := tempQueueDir(t)
+	defer os.RemoveAll(dir)
+
+	// Nothing is delivered to a sink always failing.
+	failing := &flakySink{
+		rate: 1.0,
+		Sink: &testSink{},
+	}
+	dq, err := newDiskQueue(failing, QueueConfig{Path: dir, SegmentSize: 1024}, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error opening queue: %v", err)
+	}
+
+	var written []Event
+	for i := 0; i < nevents; i++ {
+		event := createTestEvent("push", "library/test", "blob")
+		if err := dq.Write(event); err != nil {
+			t.Fatalf("error writing event: %v", err)
+		}
+		written = append(written, event)
+	}
+	checkClose(t, dq)
+
+	// Simulate a crash in the middle of a write.
+	segments, err := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) < 2 {
+		t.Fatalf("expected the log to be split in segments: %v", segments)
+	}
+
+	f, err := os.OpenFile(segments[len(segments)-1], os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0, 0, 1, 0, 42, 42}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// The pending events are delivered once the queue is opened again.
+	var ts testSink
+	metrics := newSafeMetrics()
+	dq, err = newDiskQueue(&ts, QueueConfig{Path: dir, SegmentSize: 1024}, 0, 0, metrics.eventQueueListener())
+	if err != nil {
+		t.Fatalf("unexpected error reopening queue: %v", err)
+	}
+
+	event := createTestEvent("pull", "library/test", "blob")
+	if err := dq.Write(event); err != nil {
+		t.Fatalf("error writing event: %v", err)
+	}
+	written = append(written, event)
+
+	waitPending(t, metrics)
+	checkClose(t, dq)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	if metrics.Events != nevents+1 {
+		t.Fatalf("unexpected ingress count: %d != %d", metrics.Events, nevents+1)
+	}
+
+	checkEventIDs(t, ts.events, written)
+}
+
+func TestDiskQueueOverflow(t *testing.T) {
+	for _, testcase := range []struct {
+		overflow  string
+		delivered []int // indexes of the events written delivered
+		dropped   int
+	}{
+		{
+			overflow:  OverflowDropNewest,
+			delivered: []int{0, 1, 2},
+			dropped:   2,
+		},
+		{
+			// The oldest event is dropped while being delivered.
+			overflow:  OverflowDropOldest,
+			delivered: []int{0, 2, 3, 4},
+			dropped:   2,
+		},
+		{
+			overflow:  OverflowBlock,
+			delivered: []int{0, 1, 2, 3, 4},
+		},
+	} {
+		dir := tempQueueDir(t)
+		defer os.RemoveAll(dir)
+
+		var events []Event
+		for i := 0; i < 5; i++ {
+			events = append(events, createTestEvent("push", "library/test", "blob"))
+		}
+
+		// Room for three events in the queue.
+		p, err := json.Marshal(events[:1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := int64(recordHeaderSize + len(p))
+
+		var ts testSink
+		gate := newGateSink(&ts)
+		metrics := newSafeMetrics()
+		dq, err := newDiskQueue(gate, QueueConfig{
+			Path:     dir,
+			MaxSize:  3*size + size/2,
+			Overflow: testcase.overflow,
+		}, 0, 0, metrics.eventQueueListener())
+		if err != nil {
+			t.Fatalf("%s: unexpected error opening queue: %v", testcase.overflow, err)
+		}
+
+		if err := dq.Write(events[0]); err != nil {
+			t.Fatalf("%s: error writing event: %v", testcase.overflow, err)
+		}
+		<-gate.entered
+
+		written := make(chan error, len(events))
+		go func() {
+			for _, event := range events[1:] {
+				written <- dq.Write(event)
+			}
+		}()
+
+		for i := 1; i < 3; i++ {
+			if err := <-written; err != nil {
+				t.Fatalf("%s: error writing event: %v", testcase.overflow, err)
+			}
+		}
+
+		if testcase.overflow == OverflowBlock {
+			select {
+			case err := <-written:
+				t.Fatalf("%s: write to a full queue did not block: %v", testcase.overflow, err)
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+
+		close(gate.release)
+		for i := 3; i < len(events); i++ {
+			if err := <-written; err != nil {
+				t.Fatalf("%s: error writing event: %v", testcase.overflow, err)
+			}
+		}
+
+		waitPending(t, metrics)
+		checkClose(t, dq)
+
+		var expected []Event
+		for _, i := range testcase.delivered {
+			expected = append(expected, events[i])
+		}
+
+		ts.mu.Lock()
+		checkEventIDs(t, ts.events, expected)
+		ts.mu.Unlock()
+
+		metrics.Lock()
+		if metrics.Dropped != testcase.dropped {
+			t.Fatalf("%s: unexpected dropped count: %d != %d", testcase.overflow, metrics.Dropped, testcase.dropped)
+		}
+		metrics.Unlock()
+	}
+}
+
+func TestDiskQueueBatching(t *testing.T) {
+	dir := tempQueueDir(t)
+	defer os.RemoveAll(dir)
+
+	ordered := newOrderingSink(0)
+	gate := newGateSink(ordered)
+	metrics := newSafeMetrics()
+	dq, err := newDiskQueue(gate, QueueConfig{Path: dir}, 3, 0, metrics.eventQueueListener())
+	if err != nil {
+		t.Fatalf("unexpected error opening queue: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		event := createTestEvent("push", "library/test", "blob")
+		event.Target.Tag = strconv.Itoa(i)
+		if err := dq.Write(event); err != nil {
+			t.Fatalf("error writing event: %v", err)
+		}
+
+		if i == 0 {
+			<-gate.entered
+		}
+	}
+
+	// The first record is in flight, the others wait on disk.
+	metrics.Lock()
+	if metrics.Pending != 5 || metrics.InFlight != 1 || metrics.Depth != 4 {
+		t.Fatalf("unexpected gauges: pending=%d depth=%d inflight=%d", metrics.Pending, metrics.Depth, metrics.InFlight)
+	}
+	metrics.Unlock()
+
+	close(gate.release)
+	waitPending(t, metrics)
+	checkClose(t, dq)
+
+	ordered.mu.Lock()
+	defer ordered.mu.Unlock()
+	if ordered.err != nil {
+		t.Fatal(ordered.err)
+	}
+
+	var sizes []int
+	for _, batch := range ordered.batches {
+		sizes = append(sizes, len(batch))
+	}
+	if len(sizes) != 3 || sizes[0] != 1 || sizes[1] != 3 || sizes[2] != 1 {
+		t.Fatalf("unexpected batches: %v", sizes)
+	}
+
+	metrics.Lock()
+	defer metrics.Unlock()
+	if metrics.InFlight != 0 || metrics.Depth != 0 {
+		t.Fatalf("unexpected gauges: depth=%d inflight=%d", metrics.Depth, metrics.InFlight)
+	}
+}
+
+func TestDiskQueueInvalidConfig(t *testing.T) {
+	dir := tempQueueDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, config := range []QueueConfig{
+		{Path: dir, Fsync: "sometimes"},
+		{Path: dir, Overflow: "dropall"},
+	} {
+		if _, err := newDiskQueue(&testSink{}, config, 0, 0); err == nil {
+			t.Fatalf("expected error opening queue with %+v", config)
+		}
+	}
+}
+
+// gateSink holds all writes until it is released, signalling the first one.
+type gateSink struct {
+	Sink
+	once    sync.Once
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newGateSink(sink Sink) *gateSink {
+	return &gateSink{
+		Sink:    sink,
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+}
+
+func (gs *gateSink) Write(events ...Event) error {
+	gs.once.Do(func() { close(gs.entered) })
+	<-gs.release
+	return gs.Sink.Write(events...)
+}
+
+func tempQueueDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "diskqueue-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+	return dir
+}
+
+// waitPending waits until all the events written to the queue reporting to
+// metrics have been delivered or dropped.
+func waitPending(t *testing.T, metrics *safeMetrics) {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		metrics.Lock()
+		pending := metrics.Pending
+		metrics.Unlock()
+
+		if pending == 0 {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("events still pending: %d", pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func checkEventIDs(t *testing.T, events, expected []Event) {
+	if len(events) != len(expected) {
+		t.Fatalf("unexpected number of events delivered: %d != %d", len(events), len(expected))
+	}
+
+	for i := range events {
+		if events[i].ID != expected[i].ID {
+			t.Fatalf("unexpected event delivered at %d: %s != %s", i, events[i].ID, expected[i].ID)
+		}
+	}
+}
+
+func TestReadRecordOversizedLength(t *testing.T) {
+	// A torn or garbled header must not make readRecord allocate the
+	// length it claims.
+	var record [recordHeaderSize + 2]byte
+	binary.BigEndian.PutUint32(record[0:4], 0xffffffff)
+	copy(record[recordHeaderSize:], "[]")
+
+	r := io.NewSectionReader(bytes.NewReader(record[:]), 0, int64(len(record)))
+	if _, _, err := readRecord(r); err != errCorruptRecord {
+		t.Fatalf("unexpected error reading oversized record: %v", err)
+	}
+}
@@ -1,21 +1,132 @@
 package notifications
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
 // EndpointConfig covers the optional configuration parameters for an active
 // endpoint.
 type EndpointConfig struct {
+	// Type selects the transport of the events to the endpoint, "http"
+	// by default. Parameters holds the options specific to the type.
+	Type       string
+	Parameters map[string]interface{}
+
 	Headers   http.Header
 	Timeout   time.Duration
 	Threshold int
 	Backoff   time.Duration
+
+	// Secret is shared with an http endpoint, to sign the requests sent to
+	// it. Requests are not signed if it is empty.
+	Secret string
+
+	// Workers is the number of writes to the endpoint in flight at once.
+	// Events of a repository are written in order, one batch at a time.
+	// Durable queues are delivered by a single worker.
+	Workers int
+
+	// MaxBatchSize is the maximum number of events written at once. A
+	// batch is written once full or after BatchLinger, if the events pending
+	// do not fill it.
+	MaxBatchSize int
+	BatchLinger  time.Duration
+
+	// Queue configures a durable queue of the events. If its path is
+	// empty, events are queued in memory and lost when the registry stops.
+	Queue QueueConfig
+
+	// Filter selects the events sent to the endpoint. All events are sent
+	// by default.
+	Filter FilterConfig
+}
+
+// FilterConfig selects events by their action, repository and target media
+// type. An event is selected only if it matches all the criteria set.
+type FilterConfig struct {
+	// Actions lists the actions of the events selected, such as "push".
+	Actions []string
+
+	// Repositories lists patterns of the repositories of the events
+	// selected, with the syntax of path.Match, such as "library/*".
+	Repositories []string
+
+	// IgnoredMediaTypes lists media types of targets of events never
+	// selected.
+	IgnoredMediaTypes []string
+}
+
+// Fsync policies of durable queues, deciding when the events written are
+// flushed to disk.
+const (
+	FsyncAlways   = "always"   // after every write
+	FsyncInterval = "interval" // periodically
+	FsyncNever    = "never"    // whenever the operating system does
+)
+
+// Overflow policies of durable queues, deciding what happens to the events
+// written when the queue is full.
+const (
+	OverflowDropNewest = "dropnewest" // the events written are dropped
+	OverflowDropOldest = "dropoldest" // the oldest events are dropped to make room
+	OverflowBlock      = "block"      // writes wait until there is room
+)
+
+// QueueConfig configures a durable queue, persisting the pending events of
+// an endpoint to an append-only log on disk, so that they are delivered after
+// a restart of the registry.
+type QueueConfig struct {
+	// Path is the directory holding the log segments.
+	Path string
+
+	// Fsync is the fsync policy, FsyncInterval syncing every
+	// FsyncInterval.
+	Fsync         string
+	FsyncInterval time.Duration
+
+	// MaxSize is the maximum size of the pending events, in bytes, above
+	// which the Overflow policy applies.
+	MaxSize  int64
+	Overflow string
+
+	// SegmentSize is the size above which a new log segment is started.
+	// Segments are deleted once all their events are delivered.
+	SegmentSize int64
+}
+
+// defaults set any zero-valued fields to a reasonable default.
+func (qc *QueueConfig) defaults() {
+	if qc.Fsync == "" {
+		qc.Fsync = FsyncAlways
+	}
+
+	if qc.FsyncInterval <= 0 {
+		qc.FsyncInterval = time.Second
+	}
+
+	if qc.MaxSize <= 0 {
+		qc.MaxSize = 1 << 30
+	}
+
+	if qc.Overflow == "" {
+		qc.Overflow = OverflowDropNewest
+	}
+
+	if qc.SegmentSize <= 0 {
+		qc.SegmentSize = 16 << 20
+	}
 }
 
 // defaults set any zero-valued fields to a reasonable default.
 func (ec *EndpointConfig) defaults() {
+	if ec.Type == "" {
+		ec.Type = "http"
+	}
+
 	if ec.Timeout <= 0 {
 		ec.Timeout = time.Second
 	}
@@ -27,10 +138,22 @@ func (ec *EndpointConfig) defaults() {
 	if ec.Backoff <= 0 {
 		ec.Backoff = time.Second
 	}
+
+	if ec.Workers <= 0 {
+		ec.Workers = 1
+	}
+
+	if ec.MaxBatchSize <= 0 {
+		ec.MaxBatchSize = 100
+	}
+
+	if ec.Queue.Path != "" {
+		ec.Queue.defaults()
+	}
 }
 
-// Endpoint is a reliable, queued, thread-safe sink that notify external http
-// services when events are written. Writes are non-blocking and always
+// Endpoint is a reliable, queued, thread-safe sink that notify external
+// services, over http or other transports, when events are written. Writes are non-blocking and always
 // succeed for callers but events may be queued internally.
 type Endpoint struct {
 	Sink
@@ -42,8 +165,10 @@ type Endpoint struct {
 	metrics *safeMetrics
 }
 
-// NewEndpoint returns a running endpoint, ready to receive events.
-func NewEndpoint(name, url string, config EndpointConfig) *Endpoint {
+// NewEndpoint returns a running endpoint, ready to receive events. An error
+// is returned if the type of the endpoint is unknown, its parameters or
+// filter are invalid or its durable queue cannot be opened.
+func NewEndpoint(name, url string, config EndpointConfig) (*Endpoint, error) {
 	var endpoint Endpoint
 	endpoint.name = name
 	endpoint.url = url
@@ -51,15 +176,49 @@ func NewEndpoint(name, url string, config EndpointConfig) *Endpoint {
 	endpoint.defaults()
 	endpoint.metrics = newSafeMetrics()
 
-	// Configures the inmemory queue, retry, http pipeline.
-	endpoint.Sink = newHTTPSink(
-		endpoint.url, endpoint.Timeout, endpoint.Headers,
-		endpoint.metrics.httpStatusListener())
-	endpoint.Sink = newRetryingSink(endpoint.Sink, endpoint.Threshold, endpoint.Backoff)
-	endpoint.Sink = newEventQueue(endpoint.Sink, endpoint.metrics.eventQueueListener())
+	factory, ok := sinkFactories[endpoint.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown endpoint type %q", endpoint.Type)
+	}
+
+	if endpoint.Queue.Path != "" && endpoint.Workers > 1 {
+		return nil, fmt.Errorf("durable queues are delivered by a single worker, not %d", endpoint.Workers)
+	}
+
+	// Configures the filter, inmemory or durable queue, then the retry,
+	// transport pipeline of each worker.
+	var sinks []Sink
+	for i := 0; i < endpoint.Workers; i++ {
+		sink, err := factory(endpoint.url, endpoint.EndpointConfig, endpoint.metrics)
+		if err != nil {
+			for _, sink := range sinks {
+				sink.Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, newRetryingSink(sink, endpoint.Threshold, endpoint.Backoff))
+	}
+
+	if endpoint.Queue.Path != "" {
+		dq, err := newDiskQueue(sinks[0], endpoint.Queue, endpoint.MaxBatchSize, endpoint.BatchLinger, endpoint.metrics.eventQueueListener())
+		if err != nil {
+			sinks[0].Close()
+			return nil, err
+		}
+		endpoint.Sink = dq
+	} else {
+		endpoint.Sink = newEventQueue(sinks, endpoint.MaxBatchSize, endpoint.BatchLinger, endpoint.metrics.eventQueueListener())
+	}
+
+	f, err := newFilter(endpoint.Sink, endpoint.Filter, endpoint.metrics.filterListener())
+	if err != nil {
+		endpoint.Sink.Close()
+		return nil, err
+	}
+	endpoint.Sink = f
 
 	register(&endpoint)
-	return &endpoint
+	return &endpoint, nil
 }
 
 // Name returns the name of the endpoint, generally used for debugging.
@@ -72,6 +231,19 @@ func (e *Endpoint) URL() string {
 	return e.url
 }
 
+// RedactURL returns rawurl without the credentials it may carry, such as
+// those of nats endpoints, so that it can be logged or exported. A url that
+// cannot be parsed is returned as is.
+func RedactURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.User == nil {
+		return rawurl
+	}
+
+	u.User = nil
+	return u.String()
+}
+
 // ReadMetrics populates em with metrics from the endpoint.
 func (e *Endpoint) ReadMetrics(em *EndpointMetrics) {
 	e.metrics.Lock()
@@ -84,3 +256,64 @@ func (e *Endpoint) ReadMetrics(em *EndpointMetrics) {
 		em.Statuses[k] = v
 	}
 }
+
+// sinkFactory creates the sink delivering events to an endpoint of a given
+// type, at the url of the endpoint. The sink makes a single attempt at each
+// write, reliability being provided by the endpoint, and reports the outcome
+// to the metrics.
+type sinkFactory func(url string, config EndpointConfig, metrics *safeMetrics) (Sink, error)
+
+// sinkFactories holds the sink factories by endpoint type.
+var sinkFactories = make(map[string]sinkFactory)
+
+// registerSinkType makes the endpoint type available, panicking if it is
+// registered twice.
+func registerSinkType(name string, factory sinkFactory) {
+	if _, ok := sinkFactories[name]; ok {
+		panic(fmt.Sprintf("endpoint type %q already registered", name))
+	}
+	sinkFactories[name] = factory
+}
+
+// stringParameter returns the value of the named parameter, or def if it is
+// not set.
+func stringParameter(parameters map[string]interface{}, name, def string) (string, error) {
+	value, ok := parameters[name]
+	if !ok || value == nil {
+		return def, nil
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("parameter %s must be a string, not %T", name, value)
+	}
+	return s, nil
+}
+
+// intParameter returns the integer value of the named parameter, or def if it
+// is not set.
+func intParameter(parameters map[string]interface{}, name string, def int64) (int64, error) {
+	value, ok := parameters[name]
+	if !ok || value == nil {
+		return def, nil
+	}
+
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint64:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	case string:
+		i, err := strconv.ParseInt(v, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parameter %s must be an integer: %v", name, err)
+		}
+		return i, nil
+	default:
+		return 0, fmt.Errorf("parameter %s must be an integer, not %T", name, value)
+	}
+}
@@ -57,6 +57,10 @@ type Event struct {
 		// Repository identifies the named repository.
 		Repository string `json:"repository,omitempty"`
 
+		// Tag identifies the tag targeted by the event, when the event
+		// concerns a tag rather than a manifest revision.
+		Tag string `json:"tag,omitempty"`
+
 		// URL provides a direct link to the content.
 		URL string `json:"url,omitempty"`
 	} `json:"target,omitempty"`
@@ -0,0 +1,199 @@
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+func init() {
+	registerSinkType("file", func(path string, config EndpointConfig, metrics *safeMetrics) (Sink, error) {
+		if config.Workers > 1 {
+			return nil, fmt.Errorf("filesink: a file is written by a single worker, not %d", config.Workers)
+		}
+
+		maxSize, err := intParameter(config.Parameters, "maxsize", 100<<20)
+		if err != nil {
+			return nil, err
+		}
+
+		maxBackups, err := intParameter(config.Parameters, "maxbackups", 5)
+		if err != nil {
+			return nil, err
+		}
+
+		return newFileSink(path, maxSize, int(maxBackups), metrics.deliveryListener())
+	})
+}
+
+// fileSink appends the events written to a file, as JSON lines each holding
+// an envelope of a block of events. Once the file grows beyond its maximum
+// size, it is renamed with the suffix ".1", shifting older files up to
+// maxBackups, and a new file is started.
+type fileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu        sync.Mutex
+	closed    bool
+	file      *os.File
+	size      int64
+	listeners []deliveryListener
+}
+
+// newFileSink returns a sink appending to the file at path, created along
+// with its directory if needed.
+func newFileSink(path string, maxSize int64, maxBackups int, listeners ...deliveryListener) (*fileSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("filesink: no path")
+	}
+
+	if maxSize <= 0 || maxBackups < 0 {
+		return nil, fmt.Errorf("filesink: invalid maximum size %d or backups %d", maxSize, maxBackups)
+	}
+
+	fs := &fileSink{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+		listeners:  listeners,
+	}
+
+	if err := fs.open(); err != nil {
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+// Write appends the envelope of the events to the file, rotating it first if
+// it would grow beyond its maximum size.
+func (fs *fileSink) Write(events ...Event) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.closed {
+		return ErrSinkClosed
+	}
+
+	if err := fs.write(events...); err != nil {
+		for _, listener := range fs.listeners {
+			listener.err(err, events...)
+		}
+		return fmt.Errorf("%v: %v", fs, err)
+	}
+
+	for _, listener := range fs.listeners {
+		listener.delivered(events...)
+	}
+	return nil
+}
+
+// Close closes the file.
+func (fs *fileSink) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.closed {
+		return fmt.Errorf("filesink: already closed")
+	}
+
+	fs.closed = true
+	if fs.file == nil {
+		return nil
+	}
+	return fs.file.Close()
+}
+
+func (fs *fileSink) String() string {
+	return fmt.Sprintf("fileSink{%s}", fs.path)
+}
+
+func (fs *fileSink) write(events ...Event) error {
+	p, err := json.Marshal(Envelope{Events: events})
+	if err != nil {
+		return fmt.Errorf("error marshaling event envelope: %v", err)
+	}
+	p = append(p, '\n')
+
+	if fs.file == nil {
+		// A previous rotation failed to open the new file.
+		if err := fs.open(); err != nil {
+			return err
+		}
+	}
+
+	if fs.size > 0 && fs.size+int64(len(p)) > fs.maxSize {
+		if err := fs.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fs.file.Write(p); err != nil {
+		// Leave no partial line behind.
+		fs.file.Truncate(fs.size)
+		return err
+	}
+
+	fs.size += int64(len(p))
+	return nil
+}
+
+// rotate renames the file and its backups, removing the oldest one, and
+// starts a new file.
+func (fs *fileSink) rotate() error {
+	if err := fs.file.Close(); err != nil {
+		return err
+	}
+	fs.file = nil
+
+	if fs.maxBackups == 0 {
+		if err := os.Remove(fs.path); err != nil {
+			return err
+		}
+		return fs.open()
+	}
+
+	if err := os.Remove(fs.backupPath(fs.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i := fs.maxBackups - 1; i > 0; i-- {
+		if err := os.Rename(fs.backupPath(i), fs.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Rename(fs.path, fs.backupPath(1)); err != nil {
+		return err
+	}
+
+	return fs.open()
+}
+
+func (fs *fileSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(fs.path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(fs.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	fs.file, fs.size = f, fi.Size()
+	return nil
+}
+
+func (fs *fileSink) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", fs.path, n)
+}
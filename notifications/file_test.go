@@ -0,0 +1,118 @@
+package notifications
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSink(t *testing.T) {
+	dir := tempQueueDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events", "events.log")
+
+	// Room for about two blocks per file.
+	block := []Event{createTestEvent("push", "library/test", "blob")}
+	p, err := json.Marshal(Envelope{Events: block})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := newSafeMetrics()
+	fs, err := newFileSink(path, int64(2*len(p)+len(p)/2), 2, metrics.deliveryListener())
+	if err != nil {
+		t.Fatalf("unexpected error creating file sink: %v", err)
+	}
+
+	var written []Event
+	for i := 0; i < 7; i++ {
+		event := createTestEvent("push", "library/test", "blob")
+		if err := fs.Write(event); err != nil {
+			t.Fatalf("unexpected error writing event: %v", err)
+		}
+		written = append(written, event)
+	}
+	checkClose(t, fs)
+
+	// The oldest file was removed, leaving the five latest events.
+	var events []Event
+	for _, name := range []string{path + ".2", path + ".1", path} {
+		events = append(events, readEnvelopes(t, name)...)
+	}
+	checkEventIDs(t, events, written[2:])
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected backup beyond the maximum: %v", err)
+	}
+
+	metrics.Lock()
+	defer metrics.Unlock()
+	if metrics.Successes != len(written) {
+		t.Fatalf("unexpected success count: %d != %d", metrics.Successes, len(written))
+	}
+}
+
+func TestFileEndpoint(t *testing.T) {
+	dir := tempQueueDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.log")
+
+	endpoint, err := NewEndpoint("file", path, EndpointConfig{
+		Type:       "file",
+		Parameters: map[string]interface{}{"maxsize": "1048576", "maxbackups": 1},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating endpoint: %v", err)
+	}
+
+	var written []Event
+	for i := 0; i < 10; i++ {
+		event := createTestEvent("push", "library/test", "blob")
+		if err := endpoint.Write(event); err != nil {
+			t.Fatalf("unexpected error writing event: %v", err)
+		}
+		written = append(written, event)
+	}
+
+	// Closing the in memory queue flushes it.
+	checkClose(t, endpoint)
+	checkEventIDs(t, readEnvelopes(t, path), written)
+
+	for _, config := range []EndpointConfig{
+		{Type: "carrierpigeon"},
+		{Type: "file", Parameters: map[string]interface{}{"maxsize": "large"}},
+		{Type: "file", Parameters: map[string]interface{}{"maxbackups": -1}},
+		{Type: "file", Workers: 2},
+		{Type: "http", Workers: 2, Queue: QueueConfig{Path: filepath.Join(dir, "queue")}},
+	} {
+		if _, err := NewEndpoint("invalid", path, config); err == nil {
+			t.Fatalf("expected error creating endpoint with %+v", config)
+		}
+	}
+}
+
+func readEnvelopes(t *testing.T, path string) []Event {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error opening %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var envelope Envelope
+		if err := json.Unmarshal(scanner.Bytes(), &envelope); err != nil {
+			t.Fatalf("error decoding line of %s: %v", path, err)
+		}
+		events = append(events, envelope.Events...)
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("unexpected error reading %s: %v", path, err)
+	}
+
+	return events
+}
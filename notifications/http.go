@@ -9,11 +9,18 @@ import (
 	"time"
 )
 
+func init() {
+	registerSinkType("http", func(url string, config EndpointConfig, metrics *safeMetrics) (Sink, error) {
+		return newHTTPSink(url, config.Timeout, config.Headers, config.Secret, metrics.httpStatusListener()), nil
+	})
+}
+
 // httpSink implements a single-flight, http notification endpoint. This is
 // very lightweight in that it only makes an attempt at an http request.
 // Reliability should be provided by the caller.
 type httpSink struct {
-	url string
+	url    string
+	secret string // signs the requests, if set
 
 	mu        sync.Mutex
 	closed    bool
@@ -25,10 +32,12 @@ type httpSink struct {
 }
 
 // newHTTPSink returns an unreliable, single-flight http sink. Wrap in other
-// sinks for increased reliability.
-func newHTTPSink(u string, timeout time.Duration, headers http.Header, listeners ...httpStatusListener) *httpSink {
+// sinks for increased reliability. If the secret is not empty, the body of
+// each request is signed with it, in the SignatureHeader.
+func newHTTPSink(u string, timeout time.Duration, headers http.Header, secret string, listeners ...httpStatusListener) *httpSink {
 	return &httpSink{
 		url:       u,
+		secret:    secret,
 		listeners: listeners,
 		client: &http.Client{
 			Transport: &headerRoundTripper{
@@ -74,8 +83,22 @@ func (hs *httpSink) Write(events ...Event) error {
 		return fmt.Errorf("%v: error marshaling event envelope: %v", hs, err)
 	}
 
-	body := bytes.NewReader(p)
-	resp, err := hs.client.Post(hs.url, EventsMediaType, body)
+	req, err := http.NewRequest("POST", hs.url, bytes.NewReader(p))
+	if err != nil {
+		for _, listener := range hs.listeners {
+			listener.err(err, events...)
+		}
+		return fmt.Errorf("%v: error creating request: %v", hs, err)
+	}
+	req.Header.Set("Content-Type", EventsMediaType)
+
+	// The signature is timestamped on each attempt, so that receivers can
+	// reject old requests replayed.
+	if hs.secret != "" {
+		req.Header.Set(SignatureHeader, signature(hs.secret, time.Now(), p))
+	}
+
+	resp, err := hs.client.Do(req)
 	if err != nil {
 		for _, listener := range hs.listeners {
 			listener.err(err, events...)
@@ -60,7 +60,7 @@ func TestHTTPSink(t *testing.T) {
 	}))
 
 	metrics := newSafeMetrics()
-	sink := newHTTPSink(server.URL, 0, nil,
+	sink := newHTTPSink(server.URL, 0, nil, "",
 		&endpointMetricsHTTPStatusListener{safeMetrics: metrics})
 
 	var expectedMetrics EndpointMetrics
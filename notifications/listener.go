@@ -16,6 +16,10 @@ type ManifestListener interface {
 	// and we'll need to propagate these in the future.
 
 	ManifestDeleted(repo distribution.Repository, sm *manifest.SignedManifest) error
+
+	// TagDeleted is called when a tag is removed from the repository. The
+	// manifest revision it pointed to is not deleted.
+	TagDeleted(repo distribution.Repository, tag string) error
 }
 
 // LayerListener describes a listener that can respond to layer related events.
@@ -90,6 +94,25 @@ func (msl *manifestServiceListener) Put(sm *manifest.SignedManifest) error {
 	return err
 }
 
+func (msl *manifestServiceListener) Delete(dgst digest.Digest) error {
+	// Fetch the manifest before removing it, so the listener can describe
+	// the deleted target.
+	sm, err := msl.ManifestService.Get(dgst)
+	if err != nil {
+		return err
+	}
+
+	if err := msl.ManifestService.Delete(dgst); err != nil {
+		return err
+	}
+
+	if err := msl.parent.listener.ManifestDeleted(msl.parent.Repository, sm); err != nil {
+		logrus.Errorf("error dispatching manifest delete to listener: %v", err)
+	}
+
+	return nil
+}
+
 func (msl *manifestServiceListener) GetByTag(tag string) (*manifest.SignedManifest, error) {
 	sm, err := msl.ManifestService.GetByTag(tag)
 	if err == nil {
@@ -101,6 +124,18 @@ func (msl *manifestServiceListener) GetByTag(tag string) (*manifest.SignedManife
 	return sm, err
 }
 
+func (msl *manifestServiceListener) DeleteTag(tag string) error {
+	if err := msl.ManifestService.DeleteTag(tag); err != nil {
+		return err
+	}
+
+	if err := msl.parent.listener.TagDeleted(msl.parent.Repository, tag); err != nil {
+		logrus.Errorf("error dispatching tag delete to listener: %v", err)
+	}
+
+	return nil
+}
+
 type layerServiceListener struct {
 	distribution.LayerService
 	parent *repositoryListener
@@ -127,6 +162,19 @@ func (lsl *layerServiceListener) Resume(uuid string) (distribution.LayerUpload,
 	return lsl.decorateUpload(lu), err
 }
 
+// Mount dispatches a layer push event for the target repository, since the
+// layer becomes available there just as if it had been uploaded.
+func (lsl *layerServiceListener) Mount(sourceRepo string, dgst digest.Digest) (distribution.Layer, error) {
+	layer, err := lsl.LayerService.Mount(sourceRepo, dgst)
+	if err == nil {
+		if err := lsl.parent.listener.LayerPushed(lsl.parent.Repository, layer); err != nil {
+			logrus.Errorf("error dispatching layer push to listener: %v", err)
+		}
+	}
+
+	return layer, err
+}
+
 func (lsl *layerServiceListener) decorateUpload(lu distribution.LayerUpload) distribution.LayerUpload {
 	return &layerUploadListener{
 		LayerUpload: lu,
@@ -32,11 +32,12 @@ func TestListener(t *testing.T) {
 	checkExerciseRepository(t, repository)
 
 	expectedOps := map[string]int{
-		"manifest:push": 1,
-		"manifest:pull": 2,
-		// "manifest:delete": 0, // deletes not supported for now
-		"layer:push": 2,
-		"layer:pull": 2,
+		"manifest:push":   1,
+		"manifest:pull":   2,
+		"manifest:delete": 1,
+		"tag:delete":      1,
+		"layer:push":      2,
+		"layer:pull":      2,
 		// "layer:delete":    0, // deletes not supported for now
 	}
 
@@ -66,6 +67,11 @@ func (tl *testListener) ManifestDeleted(repo distribution.Repository, sm *manife
 	return nil
 }
 
+func (tl *testListener) TagDeleted(repo distribution.Repository, tag string) error {
+	tl.ops["tag:delete"]++
+	return nil
+}
+
 func (tl *testListener) LayerPushed(repo distribution.Repository, layer distribution.Layer) error {
 	tl.ops["layer:push"]++
 	return nil
@@ -175,4 +181,12 @@ func checkExerciseRepository(t *testing.T, repository distribution.Repository) {
 	if fetched.Tag != fetchedByManifest.Tag {
 		t.Fatalf("retrieved unexpected manifest: %v", err)
 	}
+
+	if err := manifests.DeleteTag(tag); err != nil {
+		t.Fatalf("unexpected error deleting tag: %v", err)
+	}
+
+	if err := manifests.Delete(dgst); err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
 }
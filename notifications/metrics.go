@@ -12,10 +12,14 @@ import (
 // some other future solution to be better.
 type EndpointMetrics struct {
 	Pending   int            // events pending in queue
+	Depth     int            // events pending in queue, not yet in flight
+	InFlight  int            // events being written to the endpoint
 	Events    int            // total events incoming
 	Successes int            // total events written successfully
 	Failures  int            // total events failed
 	Errors    int            // total events errored
+	Dropped   int            // total events dropped by a full queue
+	Filtered  int            // total events dropped by the filter
 	Statuses  map[string]int // status code histogram, per call event
 }
 
@@ -48,6 +52,21 @@ func (sm *safeMetrics) eventQueueListener() eventQueueListener {
 	}
 }
 
+// deliveryListener returns the listener for sinks other than http that
+// updates the relevent counters.
+func (sm *safeMetrics) deliveryListener() deliveryListener {
+	return &endpointMetricsDeliveryListener{
+		safeMetrics: sm,
+	}
+}
+
+// filterListener returns a listener counting the events dropped by a filter.
+func (sm *safeMetrics) filterListener() filterListener {
+	return &endpointMetricsFilterListener{
+		safeMetrics: sm,
+	}
+}
+
 // endpointMetricsHTTPStatusListener increments counters related to http sinks
 // for the relevent events.
 type endpointMetricsHTTPStatusListener struct {
@@ -76,6 +95,26 @@ func (emsl *endpointMetricsHTTPStatusListener) err(err error, events ...Event) {
 	emsl.Errors += len(events)
 }
 
+// endpointMetricsDeliveryListener increments counters related to sinks other
+// than http for the relevent events.
+type endpointMetricsDeliveryListener struct {
+	*safeMetrics
+}
+
+var _ deliveryListener = &endpointMetricsDeliveryListener{}
+
+func (edl *endpointMetricsDeliveryListener) delivered(events ...Event) {
+	edl.safeMetrics.Lock()
+	defer edl.safeMetrics.Unlock()
+	edl.Successes += len(events)
+}
+
+func (edl *endpointMetricsDeliveryListener) err(err error, events ...Event) {
+	edl.safeMetrics.Lock()
+	defer edl.safeMetrics.Unlock()
+	edl.Errors += len(events)
+}
+
 // endpointMetricsEventQueueListener maintains the incoming events counter and
 // the queues pending count.
 type endpointMetricsEventQueueListener struct {
@@ -87,12 +126,55 @@ func (eqc *endpointMetricsEventQueueListener) ingress(events ...Event) {
 	defer eqc.Unlock()
 	eqc.Events += len(events)
 	eqc.Pending += len(events)
+	eqc.updateDepth()
 }
 
 func (eqc *endpointMetricsEventQueueListener) egress(events ...Event) {
 	eqc.Lock()
 	defer eqc.Unlock()
 	eqc.Pending -= len(events)
+	eqc.updateDepth()
+}
+
+func (eqc *endpointMetricsEventQueueListener) drop(events ...Event) {
+	eqc.Lock()
+	defer eqc.Unlock()
+	eqc.Pending -= len(events)
+	eqc.Dropped += len(events)
+	eqc.updateDepth()
+}
+
+func (eqc *endpointMetricsEventQueueListener) dispatch(events ...Event) {
+	eqc.Lock()
+	defer eqc.Unlock()
+	eqc.InFlight += len(events)
+	eqc.updateDepth()
+}
+
+func (eqc *endpointMetricsEventQueueListener) settle(events ...Event) {
+	eqc.Lock()
+	defer eqc.Unlock()
+	eqc.InFlight -= len(events)
+	eqc.updateDepth()
+}
+
+// updateDepth derives the depth of the queue from the pending and in flight
+// counts. The lock must be held.
+func (eqc *endpointMetricsEventQueueListener) updateDepth() {
+	eqc.Depth = eqc.Pending - eqc.InFlight
+}
+
+// endpointMetricsFilterListener counts the events dropped by a filter.
+type endpointMetricsFilterListener struct {
+	*safeMetrics
+}
+
+var _ filterListener = &endpointMetricsFilterListener{}
+
+func (efl *endpointMetricsFilterListener) filtered(events ...Event) {
+	efl.Lock()
+	defer efl.Unlock()
+	efl.Filtered += len(events)
 }
 
 // endpoints is global registry of endpoints used to report metrics to expvar
@@ -137,8 +219,11 @@ func init() {
 			}
 
 			epjson.Name = v.Name()
-			epjson.URL = v.URL()
+			epjson.URL = RedactURL(v.URL())
 			epjson.EndpointConfig = v.EndpointConfig
+			if epjson.Secret != "" {
+				epjson.Secret = "<redacted>"
+			}
 
 			v.ReadMetrics(&epjson.Metrics)
 
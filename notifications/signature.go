@@ -0,0 +1,134 @@
+package notifications
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader is the header of the signature of the body of notification
+// requests sent to endpoints configured with a secret. Its value has the form
+// "t=<timestamp>,v1=<signature>", where the timestamp is the time the request
+// was sent, in seconds since the epoch, and the signature is the hex encoded
+// HMAC-SHA256, keyed by the secret, of the timestamp, a period and the body.
+const SignatureHeader = "Docker-Distribution-Signature"
+
+// DefaultSignatureTolerance is the maximum age of the signatures accepted by
+// VerifyRequest when none is given.
+const DefaultSignatureTolerance = 5 * time.Minute
+
+var (
+	// ErrSignatureMissing is returned by VerifyRequest when the request is
+	// not signed.
+	ErrSignatureMissing = errors.New("notifications: signature missing")
+
+	// ErrSignatureInvalid is returned by VerifyRequest when the signature
+	// does not match the body of the request.
+	ErrSignatureInvalid = errors.New("notifications: signature invalid")
+
+	// ErrSignatureExpired is returned by VerifyRequest when the signature
+	// is too old, or too far in the future, to be accepted.
+	ErrSignatureExpired = errors.New("notifications: signature expired")
+)
+
+// signature returns the value of the signature header of the body signed
+// with the secret at the given time.
+func signature(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", t, hex.EncodeToString(computeMAC(secret, t, body)))
+}
+
+func computeMAC(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// VerifyRequest checks that the notification request was signed with the
+// secret of the endpoint less than tolerance ago, DefaultSignatureTolerance if
+// it is zero, and returns the envelope of events in its body. Receivers should
+// ignore the events they have already seen within the tolerance, using their
+// ids, as a request may be replayed during that time. The body of the request
+// can still be read afterwards.
+func VerifyRequest(r *http.Request, secret string, tolerance time.Duration) (Envelope, error) {
+	var envelope Envelope
+
+	if tolerance <= 0 {
+		tolerance = DefaultSignatureTolerance
+	}
+
+	header := r.Header.Get(SignatureHeader)
+	if header == "" {
+		return envelope, ErrSignatureMissing
+	}
+
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return envelope, ErrSignatureInvalid
+		}
+
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signature, err := hex.DecodeString(kv[1])
+			if err != nil {
+				return envelope, ErrSignatureInvalid
+			}
+			signatures = append(signatures, signature)
+		}
+	}
+
+	if timestamp == "" || len(signatures) == 0 {
+		return envelope, ErrSignatureInvalid
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return envelope, ErrSignatureInvalid
+	}
+
+	age := time.Now().Sub(time.Unix(seconds, 0))
+	if age > tolerance || age < -tolerance {
+		return envelope, ErrSignatureExpired
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return envelope, err
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	expected := computeMAC(secret, timestamp, body)
+	var valid bool
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			valid = true
+		}
+	}
+
+	if !valid {
+		return envelope, ErrSignatureInvalid
+	}
+
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return envelope, fmt.Errorf("notifications: error decoding envelope: %v", err)
+	}
+
+	return envelope, nil
+}
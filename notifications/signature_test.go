@@ -0,0 +1,149 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHTTPSinkSignature checks that requests sent by an http sink with a
+// secret are accepted by VerifyRequest.
+func TestHTTPSinkSignature(t *testing.T) {
+	const secret = "shared-secret"
+
+	var received []Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		envelope, err := VerifyRequest(r, secret, 0)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// The body remains available to the handler.
+		p, err := ioutil.ReadAll(r.Body)
+		if err != nil || !bytes.HasPrefix(bytes.TrimSpace(p), []byte("{")) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		received = append(received, envelope.Events...)
+	}))
+	defer server.Close()
+
+	events := []Event{
+		createTestEvent("push", "library/test", "manifest"),
+		createTestEvent("push", "library/test", "blob"),
+	}
+
+	sink := newHTTPSink(server.URL, 0, nil, secret)
+	if err := sink.Write(events...); err != nil {
+		t.Fatalf("unexpected error writing signed events: %v", err)
+	}
+	checkEventIDs(t, received, events)
+
+	for _, s := range []string{"", "other-secret"} {
+		sink := newHTTPSink(server.URL, 0, nil, s)
+		if err := sink.Write(events...); err == nil {
+			t.Fatalf("events signed with secret %q should have been rejected", s)
+		}
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	const secret = "shared-secret"
+
+	body, err := json.Marshal(Envelope{Events: []Event{createTestEvent("push", "library/test", "blob")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, testcase := range []struct {
+		description string
+		body        []byte
+		header      string
+		tolerance   time.Duration
+		err         error
+	}{
+		{
+			description: "valid",
+			body:        body,
+			header:      signature(secret, now, body),
+		},
+		{
+			description: "valid among several signatures",
+			body:        body,
+			header:      signature("old-secret", now, body) + "," + strings.Split(signature(secret, now, body), ",")[1],
+		},
+		{
+			description: "valid within tolerance",
+			body:        body,
+			header:      signature(secret, now.Add(-time.Hour), body),
+			tolerance:   2 * time.Hour,
+		},
+		{
+			description: "missing",
+			body:        body,
+			err:         ErrSignatureMissing,
+		},
+		{
+			description: "tampered body",
+			body:        bytes.Replace(body, []byte("library/test"), []byte("library/evil"), 1),
+			header:      signature(secret, now, body),
+			err:         ErrSignatureInvalid,
+		},
+		{
+			description: "tampered timestamp",
+			body:        body,
+			header:      "t=" + strconv.FormatInt(now.Unix()-10, 10) + "," + strings.Split(signature(secret, now, body), ",")[1],
+			err:         ErrSignatureInvalid,
+		},
+		{
+			description: "wrong secret",
+			body:        body,
+			header:      signature("other-secret", now, body),
+			err:         ErrSignatureInvalid,
+		},
+		{
+			description: "expired",
+			body:        body,
+			header:      signature(secret, now.Add(-DefaultSignatureTolerance-time.Minute), body),
+			err:         ErrSignatureExpired,
+		},
+		{
+			description: "in the future",
+			body:        body,
+			header:      signature(secret, now.Add(time.Hour), body),
+			err:         ErrSignatureExpired,
+		},
+		{
+			description: "malformed",
+			body:        body,
+			header:      "v1=zz",
+			err:         ErrSignatureInvalid,
+		},
+	} {
+		r, err := http.NewRequest("POST", "http://example.com/events", bytes.NewReader(testcase.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if testcase.header != "" {
+			r.Header.Set(SignatureHeader, testcase.header)
+		}
+
+		envelope, err := VerifyRequest(r, secret, testcase.tolerance)
+		if err != testcase.err {
+			t.Fatalf("%s: unexpected error: %v != %v", testcase.description, err, testcase.err)
+		}
+
+		if err == nil && len(envelope.Events) != 1 {
+			t.Fatalf("%s: unexpected envelope: %#v", testcase.description, envelope)
+		}
+	}
+}
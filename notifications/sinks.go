@@ -3,6 +3,7 @@ package notifications
 import (
 	"container/list"
 	"fmt"
+	"path"
 	"sync"
 	"time"
 
@@ -101,34 +102,57 @@ func (b *Broadcaster) run() {
 }
 
 // eventQueue accepts all messages into a queue for asynchronous consumption
-// by a sink. It is unbounded and thread safe but the sink must be reliable or
-// events will be dropped.
+// by a pool of workers, each writing to its own sink. It is thread safe but
+// the sinks must be reliable or events will be dropped. Its size is not
+// bounded: events keep accumulating in memory while the sinks fall behind.
+//
+// Workers write the events in batches, waiting up to the linger time for a
+// batch to fill up. Events of a repository are written in order: an event is
+// not dispatched while an event of its repository is in flight.
 type eventQueue struct {
-	sink      Sink
+	sinks     []Sink
+	maxBatch  int
+	linger    time.Duration
 	events    *list.List
+	inflight  map[string]int // events in flight, by repository
 	listeners []eventQueueListener
 	cond      *sync.Cond
 	mu        sync.Mutex
 	closed    bool
+	workers   sync.WaitGroup
 }
 
 // eventQueueListener is called when various events happen on the queue.
+// Events are dropped, after their ingress, only by full durable queues.
+// Events dispatched to a sink are settled once the write returns, before
+// their egress if it succeeded.
 type eventQueueListener interface {
 	ingress(events ...Event)
 	egress(events ...Event)
+	drop(events ...Event)
+	dispatch(events ...Event)
+	settle(events ...Event)
 }
 
-// newEventQueue returns a queue to the provided sink. If the updater is non-
-// nil, it will be called to update pending metrics on ingress and egress.
-func newEventQueue(sink Sink, listeners ...eventQueueListener) *eventQueue {
+// newEventQueue returns a queue to the provided sinks, with a worker per
+// sink. Batches hold at most maxBatch events, unless it is zero. If the
+// updater is non-nil, it will be called to update pending metrics on ingress
+// and egress.
+func newEventQueue(sinks []Sink, maxBatch int, linger time.Duration, listeners ...eventQueueListener) *eventQueue {
 	eq := eventQueue{
-		sink:      sink,
+		sinks:     sinks,
+		maxBatch:  maxBatch,
+		linger:    linger,
 		events:    list.New(),
+		inflight:  make(map[string]int),
 		listeners: listeners,
 	}
 
 	eq.cond = sync.NewCond(&eq.mu)
-	go eq.run()
+	for _, sink := range sinks {
+		eq.workers.Add(1)
+		go eq.run(sink)
+	}
 	return &eq
 }
 
@@ -145,8 +169,10 @@ func (eq *eventQueue) Write(events ...Event) error {
 	for _, listener := range eq.listeners {
 		listener.ingress(events...)
 	}
-	eq.events.PushBack(events)
-	eq.cond.Signal() // signal waiters
+	for _, event := range events {
+		eq.events.PushBack(event)
+	}
+	eq.cond.Broadcast() // signal waiters
 
 	return nil
 }
@@ -154,60 +180,160 @@ func (eq *eventQueue) Write(events ...Event) error {
 // Close shutsdown the event queue, flushing
 func (eq *eventQueue) Close() error {
 	eq.mu.Lock()
-	defer eq.mu.Unlock()
-
 	if eq.closed {
+		eq.mu.Unlock()
 		return fmt.Errorf("eventqueue: already closed")
 	}
 
 	// set closed flag
 	eq.closed = true
-	eq.cond.Signal() // signal flushes queue
-	eq.cond.Wait()   // wait for signal from last flush
+	eq.cond.Broadcast() // signal workers to flush the queue
+	eq.mu.Unlock()
+
+	eq.workers.Wait() // wait for the last flush
 
-	return eq.sink.Close()
+	var err error
+	for _, sink := range eq.sinks {
+		if closeErr := sink.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
 }
 
-// run is the main goroutine to flush events to the target sink.
-func (eq *eventQueue) run() {
+// run is the goroutine of a worker flushing events to its sink.
+func (eq *eventQueue) run(sink Sink) {
+	defer eq.workers.Done()
+
 	for {
-		block := eq.next()
+		batch := eq.next()
 
-		if block == nil {
-			return // nil block means event queue is closed.
+		if batch == nil {
+			return // nil batch means event queue is closed.
 		}
 
-		if err := eq.sink.Write(block...); err != nil {
-			logrus.Warnf("eventqueue: error writing events to %v, these events will be lost: %v", eq.sink, err)
+		err := sink.Write(batch...)
+		if err != nil {
+			logrus.Warnf("eventqueue: error writing events to %v, these events will be lost: %v", sink, err)
 		}
 
-		for _, listener := range eq.listeners {
-			listener.egress(block...)
-		}
+		eq.done(batch)
 	}
 }
 
-// next encompasses the critical section of the run loop. When the queue is
-// empty, it will block on the condition. If new data arrives, it will wake
-// and return a block. When closed, a nil slice will be returned.
+// next encompasses the critical section of the run loop. When no event can
+// be dispatched, it will block on the condition. If new data arrives, it will
+// wake and return a batch, once full or after lingering. When closed and
+// empty, a nil slice will be returned.
 func (eq *eventQueue) next() []Event {
 	eq.mu.Lock()
 	defer eq.mu.Unlock()
 
-	for eq.events.Len() < 1 {
-		if eq.closed {
+	var deadline time.Time
+	for {
+		if elements := eq.dispatchable(); len(elements) > 0 {
+			full := eq.maxBatch > 0 && len(elements) >= eq.maxBatch
+			if full || eq.closed || eq.linger <= 0 {
+				return eq.take(elements)
+			}
+
+			if deadline.IsZero() {
+				deadline = time.Now().Add(eq.linger)
+			}
+
+			if !time.Now().Before(deadline) {
+				return eq.take(elements)
+			}
+
+			waitUntil(eq.cond, deadline)
+			continue
+		}
+
+		if eq.closed && eq.events.Len() == 0 {
 			eq.cond.Broadcast()
 			return nil
 		}
 
 		eq.cond.Wait()
 	}
+}
+
+// dispatchable returns the elements of the events that can be dispatched, in
+// order and up to the maximum batch size. An event can be dispatched unless
+// an event of its repository is in flight or waiting ahead of it.
+func (eq *eventQueue) dispatchable() []*list.Element {
+	var elements []*list.Element
+	blocked := make(map[string]struct{})
+	for e := eq.events.Front(); e != nil; e = e.Next() {
+		if eq.maxBatch > 0 && len(elements) >= eq.maxBatch {
+			break
+		}
+
+		repository := e.Value.(Event).Target.Repository
+		if _, ok := blocked[repository]; ok {
+			continue
+		}
+
+		if eq.inflight[repository] > 0 {
+			blocked[repository] = struct{}{}
+			continue
+		}
+
+		elements = append(elements, e)
+	}
 
-	front := eq.events.Front()
-	block := front.Value.([]Event)
-	eq.events.Remove(front)
+	return elements
+}
+
+// take removes the elements from the queue and returns their events, now in
+// flight.
+func (eq *eventQueue) take(elements []*list.Element) []Event {
+	batch := make([]Event, 0, len(elements))
+	for _, e := range elements {
+		event := eq.events.Remove(e).(Event)
+		eq.inflight[event.Target.Repository]++
+		batch = append(batch, event)
+	}
 
-	return block
+	for _, listener := range eq.listeners {
+		listener.dispatch(batch...)
+	}
+
+	return batch
+}
+
+// done marks the batch as written, unblocking the next events of its
+// repositories.
+func (eq *eventQueue) done(batch []Event) {
+	eq.mu.Lock()
+	defer eq.mu.Unlock()
+
+	for _, event := range batch {
+		repository := event.Target.Repository
+		if eq.inflight[repository]--; eq.inflight[repository] <= 0 {
+			delete(eq.inflight, repository)
+		}
+	}
+
+	for _, listener := range eq.listeners {
+		listener.settle(batch...)
+		listener.egress(batch...)
+	}
+
+	eq.cond.Broadcast() // signal workers waiting on these repositories
+}
+
+// waitUntil waits on the condition until it is signaled or the deadline
+// passes. The lock of the condition must be held.
+func waitUntil(cond *sync.Cond, deadline time.Time) {
+	timer := time.AfterFunc(deadline.Sub(time.Now()), func() {
+		cond.L.Lock()
+		defer cond.L.Unlock()
+		cond.Broadcast()
+	})
+	defer timer.Stop()
+
+	cond.Wait()
 }
 
 // retryingSink retries the write until success or an ErrSinkClosed is
@@ -335,3 +461,120 @@ func (rs *retryingSink) proceed() bool {
 	return rs.failures.recent < rs.failures.threshold ||
 		time.Now().UTC().After(rs.failures.last.Add(rs.failures.backoff))
 }
+
+// deliveryListener is called on the outcome of writing events to sinks
+// other than http, which have no status.
+type deliveryListener interface {
+	delivered(events ...Event)
+	err(err error, events ...Event)
+}
+
+// filter is a sink that only writes the events matching its configuration to
+// the underlying sink, dropping the others.
+type filter struct {
+	sink      Sink
+	config    FilterConfig
+	listeners []filterListener
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// filterListener is called with the events dropped by a filter.
+type filterListener interface {
+	filtered(events ...Event)
+}
+
+// newFilter returns a sink writing the events matching the config to sink.
+// An error is returned if a repository pattern is malformed.
+func newFilter(sink Sink, config FilterConfig, listeners ...filterListener) (*filter, error) {
+	for _, pattern := range config.Repositories {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("filter: invalid repository pattern %q: %v", pattern, err)
+		}
+	}
+
+	return &filter{
+		sink:      sink,
+		config:    config,
+		listeners: listeners,
+	}, nil
+}
+
+// Write writes the matching events to the underlying sink, in a single block
+// if there are any.
+func (f *filter) Write(events ...Event) error {
+	f.mu.Lock()
+	closed := f.closed
+	f.mu.Unlock()
+
+	if closed {
+		return ErrSinkClosed
+	}
+
+	var matched, dropped []Event
+	for _, event := range events {
+		if f.match(event) {
+			matched = append(matched, event)
+		} else {
+			dropped = append(dropped, event)
+		}
+	}
+
+	if len(dropped) > 0 {
+		for _, listener := range f.listeners {
+			listener.filtered(dropped...)
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil
+	}
+
+	return f.sink.Write(matched...)
+}
+
+// Close closes the filter and the underlying sink.
+func (f *filter) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return fmt.Errorf("filter: already closed")
+	}
+
+	f.closed = true
+	return f.sink.Close()
+}
+
+// match returns true if the event passes all the criteria of the filter.
+func (f *filter) match(event Event) bool {
+	if len(f.config.Actions) > 0 && !contains(f.config.Actions, event.Action) {
+		return false
+	}
+
+	if len(f.config.Repositories) > 0 {
+		var matched bool
+		for _, pattern := range f.config.Repositories {
+			if ok, _ := path.Match(pattern, event.Target.Repository); ok {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return !contains(f.config.IgnoredMediaTypes, event.Target.MediaType)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
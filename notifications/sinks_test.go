@@ -3,6 +3,7 @@ package notifications
 import (
 	"fmt"
 	"math/rand"
+	"strconv"
 	"sync"
 	"time"
 
@@ -65,10 +66,10 @@ func TestEventQueue(t *testing.T) {
 	metrics := newSafeMetrics()
 	eq := newEventQueue(
 		// delayed sync simulates destination slower than channel comms
-		&delayedSink{
+		[]Sink{&delayedSink{
 			Sink:  &ts,
 			delay: time.Millisecond * 1,
-		}, metrics.eventQueueListener())
+		}}, 0, 0, metrics.eventQueueListener())
 
 	var wg sync.WaitGroup
 	var block []Event
@@ -112,6 +113,115 @@ func TestEventQueue(t *testing.T) {
 	}
 }
 
+func TestEventQueueWorkers(t *testing.T) {
+	const (
+		nrepositories = 10
+		nevents       = 500
+		maxBatch      = 8
+	)
+
+	ordered := newOrderingSink(time.Millisecond)
+	metrics := newSafeMetrics()
+	eq := newEventQueue([]Sink{ordered, ordered, ordered, ordered}, maxBatch, 0, metrics.eventQueueListener())
+
+	var wg sync.WaitGroup
+	for r := 0; r < nrepositories; r++ {
+		wg.Add(1)
+		go func(repository string) {
+			defer wg.Done()
+			for i := 0; i < nevents/nrepositories; i++ {
+				event := createTestEvent("push", repository, "blob")
+				event.Target.Tag = strconv.Itoa(i)
+				if err := eq.Write(event); err != nil {
+					t.Errorf("error writing event: %v", err)
+				}
+			}
+		}(fmt.Sprintf("library/test%d", r))
+	}
+
+	wg.Wait()
+	checkClose(t, eq)
+
+	ordered.mu.Lock()
+	defer ordered.mu.Unlock()
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	if ordered.err != nil {
+		t.Fatal(ordered.err)
+	}
+
+	if len(ordered.events) != nevents {
+		t.Fatalf("events did not make it to the sink: %d != %d", len(ordered.events), nevents)
+	}
+
+	if ordered.maxConcurrent < 2 {
+		t.Fatalf("batches were not written concurrently")
+	}
+
+	for _, batch := range ordered.batches {
+		if len(batch) > maxBatch {
+			t.Fatalf("batch larger than the maximum: %d > %d", len(batch), maxBatch)
+		}
+	}
+
+	if metrics.Pending != 0 || metrics.Depth != 0 || metrics.InFlight != 0 {
+		t.Fatalf("unexpected gauges: pending=%d depth=%d inflight=%d", metrics.Pending, metrics.Depth, metrics.InFlight)
+	}
+}
+
+func TestEventQueueBatching(t *testing.T) {
+	var ts testSink
+	gate := newGateSink(&ts)
+	metrics := newSafeMetrics()
+	eq := newEventQueue([]Sink{gate}, 2, 0, metrics.eventQueueListener())
+
+	var events []Event
+	for i := 0; i < 5; i++ {
+		events = append(events, createTestEvent("push", "library/test", "blob"))
+	}
+	if err := eq.Write(events...); err != nil {
+		t.Fatalf("error writing events: %v", err)
+	}
+	<-gate.entered
+
+	// The first batch is in flight, the others wait in the queue.
+	metrics.Lock()
+	if metrics.Pending != 5 || metrics.InFlight != 2 || metrics.Depth != 3 {
+		t.Fatalf("unexpected gauges: pending=%d depth=%d inflight=%d", metrics.Pending, metrics.Depth, metrics.InFlight)
+	}
+	metrics.Unlock()
+
+	close(gate.release)
+	checkClose(t, eq)
+
+	ts.mu.Lock()
+	checkEventIDs(t, ts.events, events)
+	ts.mu.Unlock()
+
+	// Batches linger until full.
+	ordered := newOrderingSink(0)
+	eq = newEventQueue([]Sink{ordered}, 10, 200*time.Millisecond)
+	for i := 0; i < 13; i++ {
+		event := createTestEvent("push", "library/test", "blob")
+		event.Target.Tag = strconv.Itoa(i)
+		if err := eq.Write(event); err != nil {
+			t.Fatalf("error writing event: %v", err)
+		}
+	}
+	checkClose(t, eq)
+
+	ordered.mu.Lock()
+	defer ordered.mu.Unlock()
+	if ordered.err != nil {
+		t.Fatal(ordered.err)
+	}
+
+	if len(ordered.batches) != 2 || len(ordered.batches[0]) != 10 || len(ordered.batches[1]) != 3 {
+		t.Fatalf("unexpected batches: %d", len(ordered.batches))
+	}
+}
+
 func TestRetryingSink(t *testing.T) {
 
 	// Make a sync that fails most of the time, ensuring that all the events
@@ -181,6 +291,69 @@ func (ts *testSink) Close() error {
 	return nil
 }
 
+// orderingSink records the batches written to it, possibly concurrently,
+// checking that the events of each repository, numbered by their tag, are
+// written in order and by a single batch at a time.
+type orderingSink struct {
+	testSink
+	delay time.Duration
+
+	mu            sync.Mutex
+	batches       [][]Event
+	inflight      map[string]bool
+	next          map[string]int
+	concurrent    int
+	maxConcurrent int
+	err           error
+}
+
+func newOrderingSink(delay time.Duration) *orderingSink {
+	return &orderingSink{
+		delay:    delay,
+		inflight: make(map[string]bool),
+		next:     make(map[string]int),
+	}
+}
+
+func (ors *orderingSink) Write(events ...Event) error {
+	ors.mu.Lock()
+	ors.batches = append(ors.batches, events)
+	ors.concurrent++
+	if ors.concurrent > ors.maxConcurrent {
+		ors.maxConcurrent = ors.concurrent
+	}
+
+	repositories := make(map[string]bool)
+	for _, event := range events {
+		repository := event.Target.Repository
+		if ors.inflight[repository] && ors.err == nil {
+			ors.err = fmt.Errorf("concurrent batches of repository %s", repository)
+		}
+		repositories[repository] = true
+
+		if seq, _ := strconv.Atoi(event.Target.Tag); seq != ors.next[repository] && ors.err == nil {
+			ors.err = fmt.Errorf("event %d of repository %s written out of order, expected %d", seq, repository, ors.next[repository])
+		}
+		ors.next[repository]++
+	}
+
+	for repository := range repositories {
+		ors.inflight[repository] = true
+	}
+	ors.mu.Unlock()
+
+	time.Sleep(ors.delay)
+
+	ors.mu.Lock()
+	for repository := range repositories {
+		delete(ors.inflight, repository)
+	}
+	ors.concurrent--
+	ors.mu.Unlock()
+
+	return ors.testSink.Write(events...)
+}
+
 type delayedSink struct {
 	Sink
 	delay time.Duration
@@ -221,3 +394,62 @@ func checkClose(t *testing.T, sink Sink) {
 		t.Fatalf("error should be ErrSinkClosed")
 	}
 }
+
+func TestFilter(t *testing.T) {
+	var ts testSink
+	metrics := newSafeMetrics()
+	f, err := newFilter(&ts, FilterConfig{
+		Actions:           []string{EventActionPush},
+		Repositories:      []string{"library/*", "test"},
+		IgnoredMediaTypes: []string{layerMediaType},
+	}, metrics.filterListener())
+	if err != nil {
+		t.Fatalf("unexpected error creating filter: %v", err)
+	}
+
+	var expected []Event
+	for _, testcase := range []struct {
+		action     string
+		repository string
+		mediaType  string
+		match      bool
+	}{
+		{EventActionPush, "library/test", "manifest", true},
+		{EventActionPush, "test", "manifest", true},
+		{EventActionPull, "library/test", "manifest", false},
+		{EventActionDelete, "library/test", "manifest", false},
+		{EventActionPush, "other/test", "manifest", false},
+		{EventActionPush, "library/test/nested", "manifest", false},
+		{EventActionPush, "library/test", layerMediaType, false},
+	} {
+		event := createTestEvent(testcase.action, testcase.repository, testcase.mediaType)
+		if err := f.Write(event); err != nil {
+			t.Fatalf("unexpected error writing event: %v", err)
+		}
+
+		if testcase.match {
+			expected = append(expected, event)
+		}
+	}
+
+	checkClose(t, f)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	checkEventIDs(t, ts.events, expected)
+
+	if metrics.Filtered != 5 {
+		t.Fatalf("unexpected filtered count: %d != %d", metrics.Filtered, 5)
+	}
+
+	if !ts.closed {
+		t.Fatalf("sink should have been closed")
+	}
+
+	if _, err := newFilter(&ts, FilterConfig{Repositories: []string{"library/["}}); err == nil {
+		t.Fatalf("expected error creating filter with invalid pattern")
+	}
+}
@@ -0,0 +1,172 @@
+// +build !windows,!plan9
+
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+func init() {
+	registerSinkType("syslog", func(address string, config EndpointConfig, metrics *safeMetrics) (Sink, error) {
+		tag, err := stringParameter(config.Parameters, "tag", "registry")
+		if err != nil {
+			return nil, err
+		}
+
+		facility, err := stringParameter(config.Parameters, "facility", "daemon")
+		if err != nil {
+			return nil, err
+		}
+
+		return newSyslogSink(address, tag, facility, metrics.deliveryListener())
+	})
+}
+
+// syslogFacilities maps the names of the syslog facilities to their values.
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// syslogSink sends the events written to syslog, each block of events as a
+// message holding its envelope, at the info level.
+type syslogSink struct {
+	network  string
+	raddr    string
+	tag      string
+	priority syslog.Priority
+
+	mu        sync.Mutex
+	closed    bool
+	writer    *syslog.Writer
+	listeners []deliveryListener
+}
+
+// newSyslogSink returns a sink sending to the syslog server at address, such
+// as "udp://loghost:514", or to the local syslog server if it is empty. The
+// server is connected to on the first write.
+func newSyslogSink(address, tag, facility string, listeners ...deliveryListener) (*syslogSink, error) {
+	priority, ok := syslogFacilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, fmt.Errorf("syslogsink: unknown facility %q", facility)
+	}
+
+	ss := &syslogSink{
+		tag:       tag,
+		priority:  priority | syslog.LOG_INFO,
+		listeners: listeners,
+	}
+
+	if address != "" {
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, fmt.Errorf("syslogsink: invalid address %q: %v", address, err)
+		}
+
+		switch u.Scheme {
+		case "udp", "tcp", "unix", "unixgram":
+		default:
+			return nil, fmt.Errorf("syslogsink: unsupported network %q in %q", u.Scheme, address)
+		}
+
+		ss.network, ss.raddr = u.Scheme, u.Host
+		if strings.HasPrefix(u.Scheme, "unix") {
+			ss.raddr = u.Path
+		}
+	}
+
+	return ss, nil
+}
+
+// Write sends the envelope of the events to syslog, connecting to it if
+// needed.
+func (ss *syslogSink) Write(events ...Event) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.closed {
+		return ErrSinkClosed
+	}
+
+	if err := ss.write(events...); err != nil {
+		for _, listener := range ss.listeners {
+			listener.err(err, events...)
+		}
+		return fmt.Errorf("%v: %v", ss, err)
+	}
+
+	for _, listener := range ss.listeners {
+		listener.delivered(events...)
+	}
+	return nil
+}
+
+// Close closes the connection to syslog.
+func (ss *syslogSink) Close() error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.closed {
+		return fmt.Errorf("syslogsink: already closed")
+	}
+
+	ss.closed = true
+	if ss.writer == nil {
+		return nil
+	}
+	return ss.writer.Close()
+}
+
+func (ss *syslogSink) String() string {
+	if ss.network == "" {
+		return "syslogSink{local}"
+	}
+	return fmt.Sprintf("syslogSink{%s://%s}", ss.network, ss.raddr)
+}
+
+func (ss *syslogSink) write(events ...Event) error {
+	p, err := json.Marshal(Envelope{Events: events})
+	if err != nil {
+		return fmt.Errorf("error marshaling event envelope: %v", err)
+	}
+
+	if ss.writer == nil {
+		w, err := syslog.Dial(ss.network, ss.raddr, ss.priority, ss.tag)
+		if err != nil {
+			return err
+		}
+		ss.writer = w
+	}
+
+	if _, err := ss.writer.Write(p); err != nil {
+		// Connect again on the next write.
+		ss.writer.Close()
+		ss.writer = nil
+		return err
+	}
+
+	return nil
+}
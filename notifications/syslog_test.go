@@ -0,0 +1,67 @@
+// +build !windows,!plan9
+
+package notifications
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error listening: %v", err)
+	}
+	defer conn.Close()
+
+	metrics := newSafeMetrics()
+	ss, err := newSyslogSink("udp://"+conn.LocalAddr().String(), "registry-test", "local0", metrics.deliveryListener())
+	if err != nil {
+		t.Fatalf("unexpected error creating syslog sink: %v", err)
+	}
+
+	events := []Event{
+		createTestEvent("push", "library/test", "manifest"),
+		createTestEvent("push", "library/test", "blob"),
+	}
+	if err := ss.Write(events...); err != nil {
+		t.Fatalf("unexpected error writing events: %v", err)
+	}
+	checkClose(t, ss)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	p := make([]byte, 64<<10)
+	n, _, err := conn.ReadFrom(p)
+	if err != nil {
+		t.Fatalf("unexpected error reading message: %v", err)
+	}
+	message := string(p[:n])
+
+	// local0.info
+	if !strings.HasPrefix(message, "<134>") {
+		t.Fatalf("unexpected priority: %q", message)
+	}
+
+	if !strings.Contains(message, " registry-test[") {
+		t.Fatalf("tag missing from message: %q", message)
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal([]byte(strings.TrimSpace(message[strings.Index(message, "{"):])), &envelope); err != nil {
+		t.Fatalf("error decoding envelope of message %q: %v", message, err)
+	}
+	checkEventIDs(t, envelope.Events, events)
+
+	for _, address := range []string{"http://localhost", "udp://[::1"} {
+		if _, err := newSyslogSink(address, "registry", "daemon"); err == nil {
+			t.Fatalf("expected error creating syslog sink with address %q", address)
+		}
+	}
+
+	if _, err := newSyslogSink("", "registry", "local8"); err == nil {
+		t.Fatalf("expected error creating syslog sink with unknown facility")
+	}
+}
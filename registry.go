@@ -39,6 +39,12 @@ type Namespace interface {
 	// registry may or may not have the repository but should always return a
 	// reference.
 	Repository(ctx context.Context, name string) (Repository, error)
+
+	// Repositories fills repos with a lexically sorted catalog of the
+	// repositories in the namespace, starting after last, and returns the
+	// number of entries written. At most len(repos) entries are written. If
+	// there are no more repositories after those returned, err is io.EOF.
+	Repositories(ctx context.Context, repos []string, last string) (n int, err error)
 }
 
 // Repository is a named collection of manifests and layers.
@@ -77,8 +83,10 @@ type ManifestService interface {
 	// TODO(stevvooe): The methods after this message should be moved to a
 	// discrete TagService, per active proposals.
 
-	// Tags lists the tags under the named repository.
-	Tags() ([]string, error)
+	// Tags lists the tags under the named repository in lexical order. Only
+	// tags sorting after last are returned, and at most n of them. If n is
+	// less than or equal to zero, all remaining tags are returned.
+	Tags(n int, last string) ([]string, error)
 
 	// ExistsByTag returns true if the manifest exists.
 	ExistsByTag(tag string) (bool, error)
@@ -86,6 +94,10 @@ type ManifestService interface {
 	// GetByTag retrieves the named manifest, if it exists.
 	GetByTag(tag string) (*manifest.SignedManifest, error)
 
+	// DeleteTag removes the tag. The manifest revision it points to is left
+	// in place.
+	DeleteTag(tag string) error
+
 	// TODO(stevvooe): There are several changes that need to be done to this
 	// interface:
 	//
@@ -116,6 +128,12 @@ type LayerService interface {
 	// upload. The caller should seek to the latest desired upload location
 	// before proceeding.
 	Resume(uuid string) (LayerUpload, error)
+
+	// Mount makes the layer identified by digest, already present in the
+	// repository named sourceRepo, available in this repository without
+	// transferring its content. ErrUnknownLayer is returned if the source
+	// repository does not have the layer.
+	Mount(sourceRepo string, digest digest.Digest) (Layer, error)
 }
 
 // Layer provides a readable and seekable layer object. Typically,
@@ -86,6 +86,30 @@ var (
 		Format:      "<digest>",
 	}
 
+	linkHeader = ParameterDescriptor{
+		Name:        "Link",
+		Type:        "link",
+		Description: "RFC5988 compliant rel='next' with URL to next result set, if available",
+		Format:      `<<url>?n=<last n value>&last=<last entry from response>>; rel="next"`,
+	}
+
+	paginationParameters = []ParameterDescriptor{
+		{
+			Name:        "n",
+			Type:        "integer",
+			Description: "Limit the number of entries in each response. If not present, a default number of entries will be returned.",
+			Format:      "<integer>",
+			Required:    false,
+		},
+		{
+			Name:        "last",
+			Type:        "string",
+			Description: "Result set will include values lexically after last.",
+			Format:      "<last entry from previous response>",
+			Required:    false,
+		},
+	}
+
 	unauthorizedResponse = ResponseDescriptor{
 		Description: "The client does not have access to the repository.",
 		StatusCode:  http.StatusUnauthorized,
@@ -127,6 +151,46 @@ var (
 			Format:      unauthorizedErrorsBody,
 		},
 	}
+
+	deniedResponse = ResponseDescriptor{
+		Description: "The client is authenticated, but the requested access to the repository is denied.",
+		StatusCode:  http.StatusForbidden,
+		Headers: []ParameterDescriptor{
+			{
+				Name:        "Content-Length",
+				Type:        "integer",
+				Description: "Length of the JSON error response body.",
+				Format:      "<length>",
+			},
+		},
+		ErrorCodes: []ErrorCode{
+			ErrorCodeDenied,
+		},
+		Body: BodyDescriptor{
+			ContentType: "application/json; charset=utf-8",
+			Format:      deniedErrorsBody,
+		},
+	}
+
+	readOnlyResponse = ResponseDescriptor{
+		Description: "The registry is in read-only mode, so the repository cannot be modified.",
+		StatusCode:  http.StatusServiceUnavailable,
+		Headers: []ParameterDescriptor{
+			{
+				Name:        "Content-Length",
+				Type:        "integer",
+				Description: "Length of the JSON error response body.",
+				Format:      "<length>",
+			},
+		},
+		ErrorCodes: []ErrorCode{
+			ErrorCodeUnsupported,
+		},
+		Body: BodyDescriptor{
+			ContentType: "application/json; charset=utf-8",
+			Format:      errorsBody,
+		},
+	}
 )
 
 const (
@@ -165,6 +229,17 @@ const (
         ...
     ]
 }`
+
+	deniedErrorsBody = `{
+	"errors:" [
+	    {
+            "code": "DENIED",
+            "message": "requested access to the resource is denied",
+            "detail": ...
+        },
+        ...
+    ]
+}`
 )
 
 // APIDescriptor exports descriptions of the layout of the v2 registry API.
@@ -388,6 +463,89 @@ var routeDescriptors = []RouteDescriptor{
 			},
 		},
 	},
+	{
+		Name:        RouteNameCatalog,
+		Path:        "/v2/_catalog",
+		Entity:      "Catalog",
+		Description: "List a set of available repositories in the local registry cluster. Does not provide any indication of what may be available upstream. Applications can only determine if a repository is available but not if it is not available.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve a sorted, json list of repositories available in the registry.",
+				Requests: []RequestDescriptor{
+					{
+						Name:        "Catalog Fetch Complete",
+						Description: "Request an unabridged list of repositories available. Repositories that the client is not authorized to pull are omitted.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "Returns the unabridged list of repositories as a json response.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+    "repositories": [
+        <name>,
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponse,
+						},
+					},
+					{
+						Name:        "Catalog Fetch Paginated",
+						Description: "Return the specified portion of repositories. If more repositories remain, a `Link` header points to the next page.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						QueryParameters: paginationParameters,
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+    "repositories": [
+        <name>,
+        ...
+    ]
+}`,
+								},
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+									linkHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponse,
+						},
+					},
+				},
+			},
+		},
+	},
 	{
 		Name:        RouteNameTags,
 		Path:        "/v2/{name:" + RepositoryNameRegexp.String() + "}/tags/list",
@@ -399,6 +557,8 @@ var routeDescriptors = []RouteDescriptor{
 				Description: "Fetch the tags under the repository identified by `name`.",
 				Requests: []RequestDescriptor{
 					{
+						Name:        "Tags",
+						Description: "Return all tags for the repository, in lexical order.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
@@ -453,6 +613,69 @@ var routeDescriptors = []RouteDescriptor{
 									ErrorCodeUnauthorized,
 								},
 							},
+							deniedResponse,
+						},
+					},
+					{
+						Name:        "Tags Paginated",
+						Description: "Return a portion of the tags for the specified repository. If more tags remain, a `Link` header points to the next page.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: paginationParameters,
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "A list of tags for the named repository.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+									linkHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+    "name": <name>,
+    "tags": [
+        <tag>,
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusNotFound,
+								Description: "The repository is not known to the registry.",
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []ErrorCode{
+									ErrorCodeNameUnknown,
+								},
+							},
+							{
+								StatusCode:  http.StatusUnauthorized,
+								Description: "The client does not have access to the repository.",
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []ErrorCode{
+									ErrorCodeUnauthorized,
+								},
+							},
+							deniedResponse,
 						},
 					},
 				},
@@ -633,13 +856,14 @@ var routeDescriptors = []RouteDescriptor{
 									Format:      errorsBody,
 								},
 							},
+							readOnlyResponse,
 						},
 					},
 				},
 			},
 			{
 				Method:      "DELETE",
-				Description: "Delete the manifest identified by `name` and `reference` where `reference` can be a tag or digest.",
+				Description: "Delete the manifest or tag identified by `name` and `reference`. If `reference` is a digest, the manifest revision is deleted, along with any tags pointing at it. If `reference` is a tag, only the tag is removed and the manifest revision it pointed to remains available by digest. Deletion must be enabled in the registry configuration.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -658,7 +882,7 @@ var routeDescriptors = []RouteDescriptor{
 						Failures: []ResponseDescriptor{
 							{
 								Name:        "Invalid Name or Tag",
-								Description: "The specified `name` or `tag` were invalid and the delete was unable to proceed.",
+								Description: "The specified `name` or `reference` were invalid and the delete was unable to proceed.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []ErrorCode{
 									ErrorCodeNameInvalid,
@@ -690,7 +914,7 @@ var routeDescriptors = []RouteDescriptor{
 							},
 							{
 								Name:        "Unknown Manifest",
-								Description: "The specified `name` or `tag` are unknown to the registry and the delete was unable to proceed. Clients can assume the manifest was already deleted if this response is returned.",
+								Description: "The specified `name` or `reference` are unknown to the registry and the delete was unable to proceed. Clients can assume the manifest or tag was already deleted if this response is returned.",
 								StatusCode:  http.StatusNotFound,
 								ErrorCodes: []ErrorCode{
 									ErrorCodeNameUnknown,
@@ -701,6 +925,19 @@ var routeDescriptors = []RouteDescriptor{
 									Format:      errorsBody,
 								},
 							},
+							{
+								Name:        "Not allowed",
+								Description: "Manifest delete is not allowed because it is disabled in the registry configuration.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []ErrorCode{
+									ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							readOnlyResponse,
 						},
 					},
 				},
@@ -775,6 +1012,7 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							unauthorizedResponse,
+							deniedResponse,
 							{
 								Description: "The blob, identified by `name` and `digest`, is unknown to the registry.",
 								StatusCode:  http.StatusNotFound,
@@ -844,6 +1082,7 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							unauthorizedResponse,
+							deniedResponse,
 							{
 								StatusCode: http.StatusNotFound,
 								ErrorCodes: []ErrorCode{
@@ -932,6 +1171,64 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							unauthorizedResponsePush,
+							deniedResponse,
+							readOnlyResponse,
+						},
+					},
+					{
+						Name:        "Mount Blob",
+						Description: "Mount a blob identified by the `mount` parameter from another repository, named by the `from` parameter, without transferring its content. The client must have pull access to the source repository. If the blob cannot be mounted, the request is handled as if the parameters were absent, initiating a resumable upload.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							contentLengthZeroHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "mount",
+								Type:        "query",
+								Format:      "<digest>",
+								Regexp:      digest.DigestRegexp,
+								Description: `Digest of the blob which the client wishes to mount from the source repository.`,
+							},
+							{
+								Name:        "from",
+								Type:        "query",
+								Format:      "<repository name>",
+								Regexp:      RepositoryNameRegexp,
+								Description: `Name of the source repository.`,
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The blob has been mounted in the repository and is available at the provided location.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:   "Location",
+										Type:   "url",
+										Format: "<blob location>",
+									},
+									contentLengthZeroHeader,
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:       "Invalid Name or Digest",
+								StatusCode: http.StatusBadRequest,
+								ErrorCodes: []ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+								},
+							},
+							unauthorizedResponsePush,
+							deniedResponse,
+							readOnlyResponse,
 						},
 					},
 					{
@@ -976,6 +1273,8 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							unauthorizedResponsePush,
+							deniedResponse,
+							readOnlyResponse,
 						},
 					},
 				},
@@ -1035,6 +1334,7 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							unauthorizedResponse,
+							deniedResponse,
 							{
 								Description: "The upload is unknown to the registry. The upload must be restarted.",
 								StatusCode:  http.StatusNotFound,
@@ -1119,6 +1419,8 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							unauthorizedResponsePush,
+							deniedResponse,
+							readOnlyResponse,
 							{
 								Description: "The upload is unknown to the registry. The upload must be restarted.",
 								StatusCode:  http.StatusNotFound,
@@ -1225,6 +1527,8 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							unauthorizedResponsePush,
+							deniedResponse,
+							readOnlyResponse,
 							{
 								Description: "The upload is unknown to the registry. The upload must be restarted.",
 								StatusCode:  http.StatusNotFound,
@@ -1297,6 +1601,8 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							unauthorizedResponse,
+							deniedResponse,
+							readOnlyResponse,
 							{
 								Description: "The upload is unknown to the registry. The client may ignore this error and assume the upload has been deleted.",
 								StatusCode:  http.StatusNotFound,
@@ -1438,6 +1744,14 @@ var errorDescriptors = []ErrorDescriptor{
 		longer proceed.`,
 		HTTPStatusCodes: []int{http.StatusNotFound},
 	},
+	{
+		Code:    ErrorCodeDenied,
+		Value:   "DENIED",
+		Message: "requested access to the resource is denied",
+		Description: `The access controller authenticated the client, but
+		denied the requested access to the resource.`,
+		HTTPStatusCodes: []int{http.StatusForbidden},
+	},
 }
 
 var errorCodeToDescriptors map[ErrorCode]ErrorDescriptor
@@ -60,6 +60,10 @@ const (
 
 	// ErrorCodeBlobUploadInvalid is returned when an upload is invalid.
 	ErrorCodeBlobUploadInvalid
+
+	// ErrorCodeDenied is returned if the requested access to a resource is
+	// denied to an authenticated client.
+	ErrorCodeDenied
 )
 
 // ParseErrorCode attempts to parse the error code string, returning
@@ -19,6 +19,23 @@ func makeURLBuilderTestCases(urlBuilder *URLBuilder) []urlBuilderTestCase {
 			expectedPath: "/v2/",
 			build:        urlBuilder.BuildBaseURL,
 		},
+		{
+			description:  "test catalog url",
+			expectedPath: "/v2/_catalog",
+			build: func() (string, error) {
+				return urlBuilder.BuildCatalogURL()
+			},
+		},
+		{
+			description:  "test paginated catalog url",
+			expectedPath: "/v2/_catalog?last=foo%2Fbar&n=10",
+			build: func() (string, error) {
+				return urlBuilder.BuildCatalogURL(url.Values{
+					"n":    []string{"10"},
+					"last": []string{"foo/bar"},
+				})
+			},
+		},
 		{
 			description:  "test tags url",
 			expectedPath: "/v2/foo/bar/tags/list",
@@ -26,6 +43,16 @@ func makeURLBuilderTestCases(urlBuilder *URLBuilder) []urlBuilderTestCase {
 				return urlBuilder.BuildTagsURL("foo/bar")
 			},
 		},
+		{
+			description:  "test paginated tags url",
+			expectedPath: "/v2/foo/bar/tags/list?last=v1&n=10",
+			build: func() (string, error) {
+				return urlBuilder.BuildTagsURL("foo/bar", url.Values{
+					"n":    []string{"10"},
+					"last": []string{"v1"},
+				})
+			},
+		},
 		{
 			description:  "test manifest url",
 			expectedPath: "/v2/foo/bar/manifests/tag",
@@ -0,0 +1,140 @@
+// Package acl provides an access controller that enforces a local,
+// per-repository access policy on top of another access controller.
+//
+// The wrapped access controller, such as htpasswd, authenticates the client.
+// Each requested access is then checked against the rules of a YAML policy
+// file and the request is denied with auth.ErrAccessDenied unless every
+// access is granted to the authenticated user.
+package acl
+
+import (
+	"fmt"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/auth"
+	"golang.org/x/net/context"
+)
+
+// accessController authorizes the requested access against a policy after
+// the wrapped access controller has authenticated the client.
+type accessController struct {
+	backend auth.AccessController
+	policy  *Policy
+}
+
+var _ auth.AccessController = &accessController{}
+var _ auth.AccessFilter = &accessController{}
+
+func newAccessController(options map[string]interface{}) (auth.AccessController, error) {
+	policyPath, present := options["policy"]
+	if _, ok := policyPath.(string); !present || !ok {
+		return nil, fmt.Errorf(`"policy" must be set for acl access controller`)
+	}
+
+	backendName, present := options["backend"]
+	if _, ok := backendName.(string); !present || !ok {
+		return nil, fmt.Errorf(`"backend" must be set for acl access controller`)
+	}
+
+	if backendName.(string) == "acl" {
+		return nil, fmt.Errorf(`"backend" of acl access controller cannot be acl`)
+	}
+
+	backendOptions, err := stringKeys(options["options"])
+	if err != nil {
+		return nil, fmt.Errorf(`invalid "options" for acl access controller: %v`, err)
+	}
+
+	backend, err := auth.GetAccessController(backendName.(string), backendOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	pol, err := LoadPolicy(policyPath.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return &accessController{backend: backend, policy: pol}, nil
+}
+
+// Authorized authenticates the request with the backend access controller,
+// then denies it unless the policy grants every requested access to the
+// authenticated user.
+func (ac *accessController) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
+	ctx, err := ac.backend.Authorized(ctx, accessRecords...)
+	if err != nil {
+		return nil, err
+	}
+
+	userInfo, ok := ctx.Value("auth.user").(auth.UserInfo)
+	if !ok {
+		return nil, fmt.Errorf("acl: backend access controller did not set auth.user")
+	}
+
+	for _, access := range accessRecords {
+		if !ac.policy.Allowed(userInfo.Name, access) {
+			ctxu.GetLogger(ctx).Infof("acl: %s denied %s access to %s %s", userInfo.Name, access.Action, access.Type, access.Name)
+			return nil, auth.ErrAccessDenied
+		}
+	}
+
+	return ctx, nil
+}
+
+// Filter checks accesses against the policy for the user authenticated by
+// Authorized. The accesses must also be granted by the backend access
+// controller, which is asked once per access if it cannot filter them
+// itself.
+func (ac *accessController) Filter(ctx context.Context) (func(auth.Access) bool, error) {
+	userInfo, ok := ctx.Value("auth.user").(auth.UserInfo)
+	if !ok {
+		return nil, fmt.Errorf("acl: context was not authorized")
+	}
+
+	backendAllowed := func(access auth.Access) bool {
+		_, err := ac.backend.Authorized(ctx, access)
+		return err == nil
+	}
+	if filter, ok := ac.backend.(auth.AccessFilter); ok {
+		allowed, err := filter.Filter(ctx)
+		if err != nil {
+			return nil, err
+		}
+		backendAllowed = allowed
+	}
+
+	return func(access auth.Access) bool {
+		return ac.policy.Allowed(userInfo.Name, access) && backendAllowed(access)
+	}, nil
+}
+
+// stringKeys converts the backend options, which the yaml decoder produces
+// with interface{} keys, into the map expected by the access controllers.
+func stringKeys(options interface{}) (map[string]interface{}, error) {
+	switch options := options.(type) {
+	case nil:
+		return map[string]interface{}{}, nil
+	case map[string]interface{}:
+		return options, nil
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(options))
+		for k, v := range options {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("non-string key %v", k)
+			}
+
+			converted[key] = v
+		}
+
+		return converted, nil
+	default:
+		return nil, fmt.Errorf("expected a map, got %T", options)
+	}
+}
+
+// init registers the acl auth backend.
+func init() {
+	auth.Register("acl", auth.InitFunc(newAccessController))
+}
@@ -0,0 +1,113 @@
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/docker/distribution/registry/auth"
+	"golang.org/x/net/context"
+)
+
+// testBackend authenticates every request as the user named in its options.
+type testBackend struct {
+	user string
+}
+
+func (tb testBackend) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
+	return auth.WithUser(ctx, auth.UserInfo{Name: tb.user}), nil
+}
+
+func init() {
+	auth.Register("acltest", auth.InitFunc(func(options map[string]interface{}) (auth.AccessController, error) {
+		user, _ := options["user"].(string)
+		return testBackend{user: user}, nil
+	}))
+}
+
+func TestACLAccessController(t *testing.T) {
+	tempFile, err := ioutil.TempFile("", "acl-test")
+	if err != nil {
+		t.Fatal("could not create temporary policy file")
+	}
+	defer os.Remove(tempFile.Name())
+
+	if _, err := tempFile.WriteString(testPolicy); err != nil {
+		t.Fatal("could not write temporary policy file")
+	}
+	tempFile.Close()
+
+	ac, err := newAccessController(map[string]interface{}{
+		"policy":  tempFile.Name(),
+		"backend": "acltest",
+		"options": map[interface{}]interface{}{
+			"user": "alice",
+		},
+	})
+	if err != nil {
+		t.Fatalf("error creating access controller: %v", err)
+	}
+
+	pull := auth.Access{
+		Resource: auth.Resource{Type: "repository", Name: "team-a/app"},
+		Action:   "pull",
+	}
+	push := pull
+	push.Action = "push"
+	del := pull
+	del.Action = "*"
+
+	ctx, err := ac.Authorized(context.Background(), pull, push)
+	if err != nil {
+		t.Fatalf("unexpected error authorizing push: %v", err)
+	}
+
+	userInfo, ok := ctx.Value("auth.user").(auth.UserInfo)
+	if !ok || userInfo.Name != "alice" {
+		t.Fatalf("auth.user not carried over from backend: %#v", ctx.Value("auth.user"))
+	}
+
+	if _, err := ac.Authorized(context.Background(), pull, del); err != auth.ErrAccessDenied {
+		t.Fatalf("expected access to be denied, got %v", err)
+	}
+
+	// Requests without access records, such as the base route, only need to
+	// be authenticated.
+	ctx, err = ac.Authorized(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error authorizing base request: %v", err)
+	}
+
+	// The catalog then filters the repositories against the policy.
+	allowed, err := ac.(auth.AccessFilter).Filter(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error filtering accesses: %v", err)
+	}
+
+	other := pull
+	other.Name = "team-b/app"
+	for access, expected := range map[auth.Access]bool{pull: true, del: false, other: false} {
+		if allowed(access) != expected {
+			t.Fatalf("unexpected filtering of %v: expected %v", access, expected)
+		}
+	}
+
+	if _, err := ac.(auth.AccessFilter).Filter(context.Background()); err == nil {
+		t.Fatalf("expected error filtering accesses of an unauthorized context")
+	}
+}
+
+func TestNewAccessControllerOptions(t *testing.T) {
+	for _, options := range []map[string]interface{}{
+		{"backend": "acltest"},
+		{"policy": "/policy.yml"},
+		{"policy": "/policy.yml", "backend": "acl"},
+		{"policy": "/policy.yml", "backend": "unknown"},
+		{"policy": "/does/not/exist", "backend": "acltest"},
+		{"policy": "/policy.yml", "backend": "acltest", "options": "user"},
+	} {
+		if _, err := newAccessController(options); err == nil {
+			t.Fatalf("expected error creating access controller with options %v", options)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package acl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution/registry/auth"
+	"gopkg.in/yaml.v2"
+)
+
+// Policy is the parsed form of a policy file. It maps user name patterns to
+// the actions they are granted on repositories matching a name pattern:
+//
+//	alice:
+//	  team-a/*: pull,push
+//	"*":
+//	  library/*: pull
+//
+// Patterns use the syntax of path.Match, so "*" does not match across "/".
+// The action "*" grants every action, including the full access required to
+// delete.
+type Policy struct {
+	rules []rule
+}
+
+// rule grants actions on the repositories matching the repository pattern
+// to the users matching the user pattern.
+type rule struct {
+	user       string
+	repository string
+	actions    map[string]struct{}
+}
+
+// LoadPolicy reads and parses the policy file at path.
+func LoadPolicy(path string) (*Policy, error) {
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePolicy(p)
+}
+
+// ParsePolicy parses the YAML policy document in p.
+func ParsePolicy(p []byte) (*Policy, error) {
+	var doc map[string]map[string]string
+	if err := yaml.Unmarshal(p, &doc); err != nil {
+		return nil, fmt.Errorf("acl: invalid policy: %v", err)
+	}
+
+	return NewPolicy(doc)
+}
+
+// NewPolicy creates a policy from its rules, mapping user name patterns to
+// repository name patterns to comma separated actions, as they appear in a
+// policy document.
+func NewPolicy(doc map[string]map[string]string) (*Policy, error) {
+	// Sort the rules so that they are evaluated and logged in a stable order.
+	var users []string
+	for user := range doc {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	var pol Policy
+	for _, user := range users {
+		if err := checkPattern(user); err != nil {
+			return nil, err
+		}
+
+		var repositories []string
+		for repository := range doc[user] {
+			repositories = append(repositories, repository)
+		}
+		sort.Strings(repositories)
+
+		for _, repository := range repositories {
+			if err := checkPattern(repository); err != nil {
+				return nil, err
+			}
+
+			r := rule{
+				user:       user,
+				repository: repository,
+				actions:    make(map[string]struct{}),
+			}
+
+			for _, action := range strings.Split(doc[user][repository], ",") {
+				action = strings.TrimSpace(action)
+				if action == "" {
+					continue
+				}
+
+				r.actions[action] = struct{}{}
+			}
+
+			pol.rules = append(pol.rules, r)
+		}
+	}
+
+	return &pol, nil
+}
+
+// checkPattern returns an error if pattern is not a valid path.Match
+// pattern.
+func checkPattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("acl: invalid pattern %q: %v", pattern, err)
+	}
+
+	return nil
+}
+
+// Allowed returns true if any rule grants the requested access to user.
+// Only repository resources can be granted.
+func (pol *Policy) Allowed(user string, access auth.Access) bool {
+	if access.Type != "repository" {
+		return false
+	}
+
+	for _, r := range pol.rules {
+		// Patterns were checked when the policy was parsed, so the errors
+		// can be ignored here.
+		if ok, _ := path.Match(r.user, user); !ok {
+			continue
+		}
+
+		if ok, _ := path.Match(r.repository, access.Name); !ok {
+			continue
+		}
+
+		if _, ok := r.actions["*"]; ok {
+			return true
+		}
+
+		if _, ok := r.actions[access.Action]; ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,76 @@
+package acl
+
+import (
+	"testing"
+
+	"github.com/docker/distribution/registry/auth"
+)
+
+const testPolicy = `
+alice:
+  team-a/*: pull,push
+  team-b/shared: pull
+admin:
+  "*": "*"
+  "*/*": "*"
+"*":
+  library/*: pull
+`
+
+func TestPolicyAllowed(t *testing.T) {
+	pol, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("unexpected error parsing policy: %v", err)
+	}
+
+	for _, tc := range []struct {
+		user       string
+		repository string
+		action     string
+		allowed    bool
+	}{
+		{"alice", "team-a/app", "pull", true},
+		{"alice", "team-a/app", "push", true},
+		{"alice", "team-a/app", "*", false},
+		{"alice", "team-a/nested/app", "pull", false},
+		{"alice", "team-b/shared", "pull", true},
+		{"alice", "team-b/shared", "push", false},
+		{"alice", "team-b/other", "pull", false},
+		{"alice", "library/ubuntu", "pull", true},
+		{"bob", "library/ubuntu", "pull", true},
+		{"bob", "library/ubuntu", "push", false},
+		{"bob", "team-a/app", "pull", false},
+		{"admin", "team-a/app", "*", true},
+		{"admin", "ubuntu", "push", true},
+	} {
+		access := auth.Access{
+			Resource: auth.Resource{Type: "repository", Name: tc.repository},
+			Action:   tc.action,
+		}
+
+		if allowed := pol.Allowed(tc.user, access); allowed != tc.allowed {
+			t.Fatalf("unexpected result for %s %s on %s: %v != %v", tc.user, tc.action, tc.repository, allowed, tc.allowed)
+		}
+	}
+
+	registryAccess := auth.Access{
+		Resource: auth.Resource{Type: "registry", Name: "catalog"},
+		Action:   "*",
+	}
+
+	if pol.Allowed("admin", registryAccess) {
+		t.Fatalf("non-repository access should never be granted")
+	}
+}
+
+func TestParsePolicyInvalid(t *testing.T) {
+	for _, doc := range []string{
+		"alice: pull",
+		"alice:\n  \"team-a/[\": pull\n",
+		"\"[\":\n  team-a/*: pull\n",
+	} {
+		if _, err := ParsePolicy([]byte(doc)); err == nil {
+			t.Fatalf("expected error parsing policy %q", doc)
+		}
+	}
+}
@@ -31,12 +31,18 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"golang.org/x/net/context"
 )
 
+// ErrAccessDenied is returned by an AccessController when the client was
+// authenticated, but the requested access is not granted to it. Unlike a
+// Challenge, retrying with other credentials is not expected to help.
+var ErrAccessDenied = errors.New("access denied")
+
 // UserInfo carries information about
 // an autenticated/authorized client.
 type UserInfo struct {
@@ -85,6 +91,16 @@ type AccessController interface {
 	Authorized(ctx context.Context, access ...Access) (context.Context, error)
 }
 
+// AccessFilter is implemented by access controllers able to check accesses
+// for a client they already authorized, without authenticating it again. It
+// lets a request concerning many resources, such as the catalog, be
+// authorized once rather than once per resource.
+type AccessFilter interface {
+	// Filter returns a function reporting whether an access is granted to
+	// the client of ctx, which must be a context returned by Authorized.
+	Filter(ctx context.Context) (func(Access) bool, error)
+}
+
 // WithUser returns a context with the authorized user info.
 func WithUser(ctx context.Context, user UserInfo) context.Context {
 	return userInfoContext{
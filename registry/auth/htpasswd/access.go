@@ -0,0 +1,158 @@
+// Package htpasswd provides a simple authentication scheme that checks for the
+// user credential hash in an htpasswd formatted file in a configuration-determined
+// location.
+//
+// This authentication method MUST be used under TLS, as simple token-replay attack is possible.
+package htpasswd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/auth"
+	"golang.org/x/net/context"
+)
+
+var (
+	// ErrInvalidCredential is returned when the auth token does not authenticate correctly.
+	ErrInvalidCredential = errors.New("invalid authorization credential")
+
+	// ErrAuthenticationFailure returned when authentication failure to be presented to agent.
+	ErrAuthenticationFailure = errors.New("authentication failure")
+)
+
+// accessController authenticates users against the credentials in an
+// htpasswd file. The file is reloaded whenever its modification time changes.
+type accessController struct {
+	realm string
+	path  string
+
+	mu       sync.Mutex
+	modtime  time.Time
+	htpasswd *htpasswd
+}
+
+var _ auth.AccessController = &accessController{}
+var _ auth.AccessFilter = &accessController{}
+
+func newAccessController(options map[string]interface{}) (auth.AccessController, error) {
+	realm, present := options["realm"]
+	if _, ok := realm.(string); !present || !ok {
+		return nil, fmt.Errorf(`"realm" must be set for htpasswd access controller`)
+	}
+
+	path, present := options["path"]
+	if _, ok := path.(string); !present || !ok {
+		return nil, fmt.Errorf(`"path" must be set for htpasswd access controller`)
+	}
+
+	ac := &accessController{realm: realm.(string), path: path.(string)}
+	if err := ac.reload(); err != nil {
+		return nil, err
+	}
+
+	return ac, nil
+}
+
+// Authorized checks the basic auth credentials of the request against the
+// htpasswd file, responding with a basic challenge if they are missing or
+// invalid.
+func (ac *accessController) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
+	req, err := ctxu.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return nil, &challenge{
+			realm: ac.realm,
+			err:   ErrInvalidCredential,
+		}
+	}
+
+	if err := ac.reload(); err != nil {
+		// Keep serving the credentials we already have; a file that is
+		// being rewritten may fail to parse for a short while.
+		ctxu.GetLogger(ctx).Errorf("error reloading htpasswd file %q: %v", ac.path, err)
+	}
+
+	ac.mu.Lock()
+	h := ac.htpasswd
+	ac.mu.Unlock()
+
+	if err := h.authenticateUser(username, password); err != nil {
+		ctxu.GetLogger(ctx).Errorf("error authenticating user %q: %v", username, err)
+		return nil, &challenge{
+			realm: ac.realm,
+			err:   ErrAuthenticationFailure,
+		}
+	}
+
+	return auth.WithUser(ctx, auth.UserInfo{Name: username}), nil
+}
+
+// Filter grants every access, as Authorized does to authenticated users.
+func (ac *accessController) Filter(ctx context.Context) (func(auth.Access) bool, error) {
+	return func(auth.Access) bool { return true }, nil
+}
+
+// reload parses the htpasswd file again if it was modified since it was last
+// read.
+func (ac *accessController) reload() error {
+	fi, err := os.Stat(ac.path)
+	if err != nil {
+		return err
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if ac.htpasswd != nil && fi.ModTime().Equal(ac.modtime) {
+		return nil
+	}
+
+	f, err := os.Open(ac.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h, err := newHTPasswd(f)
+	if err != nil {
+		return err
+	}
+
+	ac.htpasswd = h
+	ac.modtime = fi.ModTime()
+	return nil
+}
+
+// challenge implements the auth.Challenge interface.
+type challenge struct {
+	realm string
+	err   error
+}
+
+var _ auth.Challenge = challenge{}
+
+// ServeHTTP sets the basic challenge header on the response and writes an
+// unauthorized status.
+func (ch challenge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", ch.realm))
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func (ch challenge) Error() string {
+	return fmt.Sprintf("basic authentication challenge: %#v", ch)
+}
+
+// init registers the htpasswd auth backend.
+func init() {
+	auth.Register("htpasswd", auth.InitFunc(newAccessController))
+}
@@ -0,0 +1,147 @@
+package htpasswd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/registry/auth"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/net/context"
+)
+
+func TestBasicAccessController(t *testing.T) {
+	testRealm := "The-Shire"
+	testUser := "bilbo"
+	testPassword := "baggins"
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("unexpected error generating bcrypt hash: %v", err)
+	}
+
+	tempFile, err := ioutil.TempFile("", "htpasswd-test")
+	if err != nil {
+		t.Fatal("could not create temporary htpasswd file")
+	}
+	defer os.Remove(tempFile.Name())
+
+	if _, err = tempFile.WriteString("# comment\n" + testUser + ":" + string(hash) + "\n"); err != nil {
+		t.Fatal("could not write temporary htpasswd file")
+	}
+	tempFile.Close()
+
+	options := map[string]interface{}{
+		"realm": testRealm,
+		"path":  tempFile.Name(),
+	}
+
+	accessController, err := newAccessController(options)
+	if err != nil {
+		t.Fatalf("error creating access controller: %v", err)
+	}
+
+	var userNumber int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(context.Background(), "http.request", r)
+		authCtx, err := accessController.Authorized(ctx)
+		if err != nil {
+			switch err := err.(type) {
+			case auth.Challenge:
+				err.ServeHTTP(w, r)
+				return
+			default:
+				t.Fatalf("unexpected error authorizing request: %v", err)
+			}
+		}
+
+		userInfo, ok := authCtx.Value("auth.user").(auth.UserInfo)
+		if !ok {
+			t.Fatal("basic accessController did not set auth.user context")
+		}
+
+		if userInfo.Name != testUser {
+			t.Fatalf("expected user name %q, got %q", testUser, userInfo.Name)
+		}
+
+		userNumber++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	checkStatus := func(username, password string, expected int) {
+		req, err := http.NewRequest("GET", server.URL, nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating new request: %v", err)
+		}
+
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error during GET: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != expected {
+			t.Fatalf("unexpected response status for %q: %v != %v", username, resp.StatusCode, expected)
+		}
+
+		if expected == http.StatusUnauthorized {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			if challenge != `Basic realm="`+testRealm+`"` {
+				t.Fatalf("unexpected challenge header: %q", challenge)
+			}
+		}
+	}
+
+	// Request without credentials should not be authorized
+	checkStatus("", "", http.StatusUnauthorized)
+
+	checkStatus(testUser, "wrong", http.StatusUnauthorized)
+	checkStatus("frodo", testPassword, http.StatusUnauthorized)
+	checkStatus(testUser, testPassword, http.StatusNoContent)
+
+	if userNumber != 1 {
+		t.Fatalf("expected one authorized request, got %d", userNumber)
+	}
+
+	// Changing the password in the file must take effect without a restart.
+	newHash, err := bcrypt.GenerateFromPassword([]byte("changed"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("unexpected error generating bcrypt hash: %v", err)
+	}
+
+	if err := ioutil.WriteFile(tempFile.Name(), []byte(testUser+":"+string(newHash)+"\n"), 0644); err != nil {
+		t.Fatalf("could not rewrite htpasswd file: %v", err)
+	}
+
+	// Make sure the modification time differs on filesystems with a coarse
+	// timestamp resolution.
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(tempFile.Name(), later, later); err != nil {
+		t.Fatalf("could not update htpasswd file times: %v", err)
+	}
+
+	checkStatus(testUser, testPassword, http.StatusUnauthorized)
+	checkStatus(testUser, "changed", http.StatusNoContent)
+}
+
+func TestNewAccessControllerOptions(t *testing.T) {
+	if _, err := newAccessController(map[string]interface{}{"path": "/htpasswd"}); err == nil {
+		t.Fatal("expected error without realm")
+	}
+
+	if _, err := newAccessController(map[string]interface{}{"realm": "realm"}); err == nil {
+		t.Fatal("expected error without path")
+	}
+
+	if _, err := newAccessController(map[string]interface{}{"realm": "realm", "path": "/does/not/exist"}); err == nil {
+		t.Fatal("expected error with missing htpasswd file")
+	}
+}
@@ -0,0 +1,65 @@
+package htpasswd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHTPasswd(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		input   string
+		err     bool
+		entries map[string][]byte
+	}{
+		{
+			desc: "basic example",
+			input: `
+# This is a comment in a basic example.
+bilbo:$2y$05$nvxSeDRWdqBUJGJh55RrDOhLIuPxjXUBs0mudsuXmM/2ll3Kr/6oa
+frodo:$2y$05$926C3y10Quzn/LnqQH86VOEVh/18T6RnLaS.khre96jLNL/7e.K5W
+`,
+			entries: map[string][]byte{
+				"bilbo": []byte("$2y$05$nvxSeDRWdqBUJGJh55RrDOhLIuPxjXUBs0mudsuXmM/2ll3Kr/6oa"),
+				"frodo": []byte("$2y$05$926C3y10Quzn/LnqQH86VOEVh/18T6RnLaS.khre96jLNL/7e.K5W"),
+			},
+		},
+		{
+			desc:    "empty file",
+			input:   "\n\n",
+			entries: map[string][]byte{},
+		},
+		{
+			desc:  "missing separator",
+			input: "bilbo\n",
+			err:   true,
+		},
+		{
+			desc:  "missing user",
+			input: ":$2y$05$nvxSeDRWdqBUJGJh55RrDOhLIuPxjXUBs0mudsuXmM/2ll3Kr/6oa\n",
+			err:   true,
+		},
+		{
+			desc:  "unsupported hash",
+			input: "bilbo:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n",
+			err:   true,
+		},
+	} {
+		entries, err := parseHTPasswd(strings.NewReader(tc.input))
+		if tc.err {
+			if err == nil {
+				t.Fatalf("%s: expected error, got entries %v", tc.desc, entries)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.desc, err)
+		}
+
+		if !reflect.DeepEqual(entries, tc.entries) {
+			t.Fatalf("%s: %v != %v", tc.desc, entries, tc.entries)
+		}
+	}
+}
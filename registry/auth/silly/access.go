@@ -26,6 +26,7 @@ type accessController struct {
 }
 
 var _ auth.AccessController = &accessController{}
+var _ auth.AccessFilter = &accessController{}
 
 func newAccessController(options map[string]interface{}) (auth.AccessController, error) {
 	realm, present := options["realm"]
@@ -69,6 +70,12 @@ func (ac *accessController) Authorized(ctx context.Context, accessRecords ...aut
 	return context.WithValue(ctx, "auth.user", auth.UserInfo{Name: "silly"}), nil
 }
 
+// Filter grants every access, as Authorized does to requests carrying an
+// authorization header.
+func (ac *accessController) Filter(ctx context.Context) (func(auth.Access) bool, error) {
+	return func(auth.Access) bool { return true }, nil
+}
+
 type challenge struct {
 	realm   string
 	service string
@@ -265,9 +265,21 @@ func (ac *accessController) Authorized(ctx context.Context, accessItems ...auth.
 		}
 	}
 
+	ctx = context.WithValue(ctx, "auth.token.access", accessSet)
 	return auth.WithUser(ctx, auth.UserInfo{Name: token.Claims.Subject}), nil
 }
 
+// Filter checks accesses against the scope of the token verified by
+// Authorized.
+func (ac *accessController) Filter(ctx context.Context) (func(auth.Access) bool, error) {
+	accessSet, ok := ctx.Value("auth.token.access").(accessSet)
+	if !ok {
+		return nil, fmt.Errorf("token: context was not authorized by the token access controller")
+	}
+
+	return accessSet.contains, nil
+}
+
 // init handles registering the token auth backend.
 func init() {
 	auth.Register("token", auth.InitFunc(newAccessController))
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 
@@ -27,9 +28,11 @@ type Client interface {
 	// DeleteImage removes the image at the given name, tag pair.
 	DeleteImage(name, tag string) error
 
-	// ListImageTags returns a list of all image tags with the given repository
-	// name.
-	ListImageTags(name string) ([]string, error)
+	// ListImageTags returns a lexically sorted list of the image tags with the
+	// given repository name. Only tags sorting after last are returned, and at
+	// most n of them. If n is less than or equal to zero, all remaining tags
+	// are returned.
+	ListImageTags(name string, n int, last string) ([]string, error)
 
 	// BlobLength returns the length of the blob stored at the given name,
 	// digest pair.
@@ -208,8 +211,17 @@ func (r *clientImpl) DeleteImage(name, tag string) error {
 	return nil
 }
 
-func (r *clientImpl) ListImageTags(name string) ([]string, error) {
-	tagsURL, err := r.ub.BuildTagsURL(name)
+func (r *clientImpl) ListImageTags(name string, n int, last string) ([]string, error) {
+	values := url.Values{}
+	if n > 0 {
+		values.Set("n", strconv.Itoa(n))
+	}
+
+	if last != "" {
+		values.Set("last", last)
+	}
+
+	tagsURL, err := r.ub.BuildTagsURL(name, values)
 	if err != nil {
 		return nil, err
 	}
@@ -298,7 +310,10 @@ func (r *clientImpl) GetBlob(name string, dgst digest.Digest, byteOffset int) (i
 		return nil, 0, err
 	}
 
-	getRequest.Header.Add("Range", fmt.Sprintf("%d-", byteOffset))
+	if byteOffset > 0 {
+		getRequest.Header.Add("Range", fmt.Sprintf("bytes=%d-", byteOffset))
+	}
+
 	response, err := http.DefaultClient.Do(getRequest)
 	if err != nil {
 		return nil, 0, err
@@ -306,7 +321,7 @@ func (r *clientImpl) GetBlob(name string, dgst digest.Digest, byteOffset int) (i
 
 	// TODO(bbland): handle other status codes, like 5xx errors
 	switch {
-	case response.StatusCode == http.StatusOK:
+	case response.StatusCode == http.StatusOK, response.StatusCode == http.StatusPartialContent:
 		lengthHeader := response.Header.Get("Content-Length")
 		length, err := strconv.ParseInt(lengthHeader, 10, 0)
 		if err != nil {
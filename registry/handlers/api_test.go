@@ -20,6 +20,7 @@ import (
 	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/manifest"
 	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/auth"
 	_ "github.com/docker/distribution/registry/storage/driver/inmemory"
 	"github.com/docker/distribution/testutil"
 	"github.com/docker/libtrust"
@@ -251,6 +252,67 @@ func TestLayerAPI(t *testing.T) {
 	//       ensure the content remains uncorrupted.
 }
 
+func TestLayerMount(t *testing.T) {
+	env := newTestEnv(t)
+
+	layerFile, tarSumStr, err := testutil.CreateRandomTarFile()
+	checkErr(t, err, "creating random layer file")
+	layerDigest := digest.Digest(tarSumStr)
+
+	uploadURLBase, _ := startPushLayer(t, env.builder, "foo/bar")
+	pushLayer(t, env.builder, "foo/bar", layerDigest, uploadURLBase, layerFile)
+
+	mountURL := func(name, from string, dgst digest.Digest) string {
+		u, err := env.builder.BuildBlobUploadURL(name, url.Values{
+			"mount": []string{dgst.String()},
+			"from":  []string{from},
+		})
+		checkErr(t, err, "building mount url")
+		return u
+	}
+
+	// Mounting from a repository without the layer starts a regular upload.
+	resp, err := http.Post(mountURL("foo/baz", "foo/qux", layerDigest), "", nil)
+	checkErr(t, err, "mounting unknown layer")
+	defer resp.Body.Close()
+	checkResponse(t, "mounting unknown layer", resp, http.StatusAccepted)
+
+	// Without pull access to the source, the layer is not mounted either.
+	env.app.accessController = catalogTestAccessController{denied: "foo/bar"}
+
+	resp, err = http.Post(mountURL("foo/baz", "foo/bar", layerDigest), "", nil)
+	checkErr(t, err, "mounting layer without pull access")
+	defer resp.Body.Close()
+	checkResponse(t, "mounting layer without pull access", resp, http.StatusAccepted)
+
+	env.app.accessController = nil
+
+	resp, err = http.Post(mountURL("foo/baz", "foo/bar", layerDigest), "", nil)
+	checkErr(t, err, "mounting layer")
+	defer resp.Body.Close()
+	checkResponse(t, "mounting layer", resp, http.StatusCreated)
+
+	layerURL, err := env.builder.BuildBlobURL("foo/baz", layerDigest)
+	checkErr(t, err, "building layer url")
+
+	checkHeaders(t, resp, http.Header{
+		"Location":              []string{layerURL},
+		"Content-Length":        []string{"0"},
+		"Docker-Content-Digest": []string{layerDigest.String()},
+	})
+
+	resp, err = http.Head(layerURL)
+	checkErr(t, err, "checking head on mounted layer")
+	defer resp.Body.Close()
+	checkResponse(t, "checking head on mounted layer", resp, http.StatusOK)
+
+	resp, err = http.Post(mountURL("foo/baz", "foo/bar", "invalid"), "", nil)
+	checkErr(t, err, "mounting invalid digest")
+	defer resp.Body.Close()
+	checkResponse(t, "mounting invalid digest", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "mounting invalid digest", resp, v2.ErrorCodeDigestInvalid)
+}
+
 func TestManifestAPI(t *testing.T) {
 	env := newTestEnv(t)
 
@@ -450,6 +512,314 @@ func TestManifestAPI(t *testing.T) {
 	}
 }
 
+func TestManifestDelete(t *testing.T) {
+	imageName := "foo/bar"
+	tag := "thetag"
+
+	// Deletes are refused unless enabled in the configuration.
+	env := newTestEnv(t)
+	dgst := pushTestManifest(t, env, imageName, tag)
+
+	manifestDigestURL, err := env.builder.BuildManifestURL(imageName, dgst.String())
+	checkErr(t, err, "building manifest url")
+
+	resp, err := httpDelete(manifestDigestURL)
+	checkErr(t, err, "deleting manifest")
+	defer resp.Body.Close()
+
+	checkResponse(t, "deleting manifest with deletes disabled", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "deleting manifest with deletes disabled", resp, v2.ErrorCodeUnsupported)
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": true},
+		},
+	}
+
+	env = newTestEnvWithConfig(t, &config)
+	dgst = pushTestManifest(t, env, imageName, tag)
+
+	manifestURL, err := env.builder.BuildManifestURL(imageName, tag)
+	checkErr(t, err, "building manifest url")
+
+	manifestDigestURL, err = env.builder.BuildManifestURL(imageName, dgst.String())
+	checkErr(t, err, "building manifest url")
+
+	// Deleting by tag only removes the tag.
+	resp, err = httpDelete(manifestURL)
+	checkErr(t, err, "deleting tag")
+	defer resp.Body.Close()
+
+	checkResponse(t, "deleting tag", resp, http.StatusAccepted)
+
+	resp, err = http.Get(manifestURL)
+	checkErr(t, err, "fetching deleted tag")
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching deleted tag", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching deleted tag", resp, v2.ErrorCodeManifestUnknown)
+
+	resp, err = http.Get(manifestDigestURL)
+	checkErr(t, err, "fetching untagged manifest")
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching untagged manifest", resp, http.StatusOK)
+
+	resp, err = httpDelete(manifestURL)
+	checkErr(t, err, "deleting deleted tag")
+	defer resp.Body.Close()
+
+	checkResponse(t, "deleting deleted tag", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "deleting deleted tag", resp, v2.ErrorCodeManifestUnknown)
+
+	// Deleting by digest removes the revision along with its tags.
+	dgst = pushTestManifest(t, env, imageName, tag)
+
+	manifestDigestURL, err = env.builder.BuildManifestURL(imageName, dgst.String())
+	checkErr(t, err, "building manifest url")
+
+	resp, err = httpDelete(manifestDigestURL)
+	checkErr(t, err, "deleting manifest")
+	defer resp.Body.Close()
+
+	checkResponse(t, "deleting manifest", resp, http.StatusAccepted)
+
+	// Both the revision and its tag should now be gone.
+	for _, u := range []string{manifestDigestURL, manifestURL} {
+		resp, err = http.Get(u)
+		checkErr(t, err, "fetching deleted manifest")
+		defer resp.Body.Close()
+
+		checkResponse(t, "fetching deleted manifest", resp, http.StatusNotFound)
+		checkBodyHasErrorCodes(t, "fetching deleted manifest", resp, v2.ErrorCodeManifestUnknown)
+	}
+
+	resp, err = httpDelete(manifestDigestURL)
+	checkErr(t, err, "deleting deleted manifest")
+	defer resp.Body.Close()
+
+	checkResponse(t, "deleting deleted manifest", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "deleting deleted manifest", resp, v2.ErrorCodeManifestUnknown)
+}
+
+func TestCatalogAPI(t *testing.T) {
+	env := newTestEnv(t)
+
+	catalogURL, err := env.builder.BuildCatalogURL()
+	checkErr(t, err, "building catalog url")
+
+	// An empty registry has an empty catalog.
+	checkCatalog(t, "fetching empty catalog", catalogURL, []string{}, "")
+
+	names := []string{"foo/bar", "foo", "bar/baz"}
+	for _, name := range names {
+		pushTestManifest(t, env, name, "latest")
+	}
+
+	checkCatalog(t, "fetching catalog", catalogURL, []string{"bar/baz", "foo", "foo/bar"}, "")
+
+	// Page through the catalog, following the Link header.
+	pageURL, err := env.builder.BuildCatalogURL(url.Values{"n": []string{"2"}})
+	checkErr(t, err, "building paginated catalog url")
+
+	nextURL, err := env.builder.BuildCatalogURL(url.Values{
+		"n":    []string{"2"},
+		"last": []string{"foo"},
+	})
+	checkErr(t, err, "building next catalog url")
+
+	link := checkCatalog(t, "fetching first catalog page", pageURL, []string{"bar/baz", "foo"}, nextURL)
+	checkCatalog(t, "fetching last catalog page", link, []string{"foo/bar"}, "")
+
+	// Repositories the client may not pull are left out of the catalog,
+	// without shortening the page.
+	env.app.accessController = catalogTestAccessController{denied: "foo"}
+
+	nextURL, err = env.builder.BuildCatalogURL(url.Values{
+		"n":    []string{"1"},
+		"last": []string{"bar/baz"},
+	})
+	checkErr(t, err, "building next catalog url")
+
+	pageURL, err = env.builder.BuildCatalogURL(url.Values{"n": []string{"1"}})
+	checkErr(t, err, "building paginated catalog url")
+
+	link = checkCatalog(t, "fetching filtered catalog page", pageURL, []string{"bar/baz"}, nextURL)
+	checkCatalog(t, "fetching filtered catalog page", link, []string{"foo/bar"}, "")
+}
+
+func TestAccessDenied(t *testing.T) {
+	env := newTestEnv(t)
+	env.app.accessController = catalogTestAccessController{denied: "foo/bar"}
+
+	tagsURL, err := env.builder.BuildTagsURL("foo/bar")
+	checkErr(t, err, "building tags url")
+
+	resp, err := http.Get(tagsURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching tags: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching tags of denied repository", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "fetching tags of denied repository", resp, v2.ErrorCodeDenied)
+}
+
+func TestReadOnly(t *testing.T) {
+	env := newTestEnv(t)
+	imageName := "foo/bar"
+	dgst := pushTestManifest(t, env, imageName, "latest")
+
+	env.app.SetReadOnly(true)
+
+	uploadURL, err := env.builder.BuildBlobUploadURL(imageName)
+	checkErr(t, err, "building upload url")
+
+	resp, err := http.Post(uploadURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "starting upload in read-only mode", resp, http.StatusServiceUnavailable)
+	checkBodyHasErrorCodes(t, "starting upload in read-only mode", resp, v2.ErrorCodeUnsupported)
+
+	// Pulls keep working.
+	manifestURL, err := env.builder.BuildManifestURL(imageName, dgst.String())
+	checkErr(t, err, "building manifest url")
+
+	resp, err = http.Get(manifestURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching manifest: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching manifest in read-only mode", resp, http.StatusOK)
+
+	// The mode can be toggled at runtime through the debug handler.
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/debug/maintenance/readonly?enabled=false", nil)
+	checkErr(t, err, "creating read-only mode request")
+	env.app.ReadOnlyHandler(recorder, req)
+
+	if recorder.Code != http.StatusOK || env.app.ReadOnly() {
+		t.Fatalf("read-only mode not disabled: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	startPushLayer(t, env.builder, imageName)
+}
+
+func TestTagsPagination(t *testing.T) {
+	env := newTestEnv(t)
+	imageName := "foo/bar"
+
+	for _, tag := range []string{"v2", "latest", "v1"} {
+		pushTestManifest(t, env, imageName, tag)
+	}
+
+	tagsURL, err := env.builder.BuildTagsURL(imageName)
+	checkErr(t, err, "building tags url")
+
+	// Without n, every tag is returned in lexical order.
+	checkTags(t, "fetching all tags", tagsURL, []string{"latest", "v1", "v2"}, "")
+
+	pageURL, err := env.builder.BuildTagsURL(imageName, url.Values{"n": []string{"2"}})
+	checkErr(t, err, "building paginated tags url")
+
+	nextURL, err := env.builder.BuildTagsURL(imageName, url.Values{
+		"n":    []string{"2"},
+		"last": []string{"v1"},
+	})
+	checkErr(t, err, "building next tags url")
+
+	link := checkTags(t, "fetching first tags page", pageURL, []string{"latest", "v1"}, nextURL)
+	checkTags(t, "fetching last tags page", link, []string{"v2"}, "")
+
+	// A page that ends exactly at the last tag has no link.
+	pageURL, err = env.builder.BuildTagsURL(imageName, url.Values{"n": []string{"3"}})
+	checkErr(t, err, "building paginated tags url")
+
+	checkTags(t, "fetching full tags page", pageURL, []string{"latest", "v1", "v2"}, "")
+}
+
+// checkTags fetches the tags at u and checks the listed tags and the next
+// page link, returning the link.
+func checkTags(t *testing.T, msg, u string, expected []string, expectedLink string) string {
+	resp, err := http.Get(u)
+	checkErr(t, err, msg)
+	defer resp.Body.Close()
+
+	checkResponse(t, msg, resp, http.StatusOK)
+
+	var tags tagsAPIResponse
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&tags); err != nil {
+		t.Fatalf("error decoding %s response: %v", msg, err)
+	}
+
+	if !reflect.DeepEqual(tags.Tags, expected) {
+		t.Fatalf("unexpected tags %s: %v != %v", msg, tags.Tags, expected)
+	}
+
+	checkLink(t, msg, resp, expectedLink)
+	return expectedLink
+}
+
+// checkLink checks the next page link of the response, if any.
+func checkLink(t *testing.T, msg string, resp *http.Response, expectedLink string) {
+	link := resp.Header.Get("Link")
+	if expectedLink == "" {
+		if link != "" {
+			t.Fatalf("unexpected link header %s: %q", msg, link)
+		}
+
+		return
+	}
+
+	if link != fmt.Sprintf("<%s>; rel=\"next\"", expectedLink) {
+		t.Fatalf("unexpected link header %s: %q", msg, link)
+	}
+}
+
+// checkCatalog fetches the catalog at u and checks the listed repositories
+// and the next page link, returning the link.
+func checkCatalog(t *testing.T, msg, u string, expected []string, expectedLink string) string {
+	resp, err := http.Get(u)
+	checkErr(t, err, msg)
+	defer resp.Body.Close()
+
+	checkResponse(t, msg, resp, http.StatusOK)
+
+	var ctlg catalogAPIResponse
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&ctlg); err != nil {
+		t.Fatalf("error decoding %s response: %v", msg, err)
+	}
+
+	if !reflect.DeepEqual(ctlg.Repositories, expected) {
+		t.Fatalf("unexpected repositories %s: %v != %v", msg, ctlg.Repositories, expected)
+	}
+
+	checkLink(t, msg, resp, expectedLink)
+	return expectedLink
+}
+
+// catalogTestAccessController refuses pull access to a single repository.
+type catalogTestAccessController struct {
+	denied string
+}
+
+func (ac catalogTestAccessController) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
+	for _, access := range accessRecords {
+		if access.Name == ac.denied && access.Action == "pull" {
+			return nil, auth.ErrAccessDenied
+		}
+	}
+
+	return ctx, nil
+}
+
 type testEnv struct {
 	pk      libtrust.PrivateKey
 	ctx     context.Context
@@ -520,6 +890,59 @@ func putManifest(t *testing.T, msg, url string, v interface{}) *http.Response {
 	return resp
 }
 
+func httpDelete(url string) (*http.Response, error) {
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.DefaultClient.Do(req)
+}
+
+// pushTestManifest pushes a random layer and a signed manifest referencing it
+// under name and tag, returning the digest of the manifest.
+func pushTestManifest(t *testing.T, env *testEnv, name, tag string) digest.Digest {
+	rs, dgstStr, err := testutil.CreateRandomTarFile()
+	if err != nil {
+		t.Fatalf("error creating random layer: %v", err)
+	}
+	layerDigest := digest.Digest(dgstStr)
+
+	uploadURLBase, _ := startPushLayer(t, env.builder, name)
+	pushLayer(t, env.builder, name, layerDigest, uploadURLBase, rs)
+
+	m := &manifest.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 1,
+		},
+		Name: name,
+		Tag:  tag,
+		FSLayers: []manifest.FSLayer{
+			{
+				BlobSum: layerDigest,
+			},
+		},
+	}
+
+	sm, err := manifest.Sign(m, env.pk)
+	checkErr(t, err, "signing manifest")
+
+	payload, err := sm.Payload()
+	checkErr(t, err, "getting manifest payload")
+
+	dgst, err := digest.FromBytes(payload)
+	checkErr(t, err, "digesting manifest")
+
+	manifestURL, err := env.builder.BuildManifestURL(name, tag)
+	checkErr(t, err, "building manifest url")
+
+	resp := putManifest(t, "putting signed manifest", manifestURL, sm)
+	defer resp.Body.Close()
+	checkResponse(t, "putting signed manifest", resp, http.StatusAccepted)
+
+	return dgst
+}
+
 func startPushLayer(t *testing.T, ub *v2.URLBuilder, name string) (location string, uuid string) {
 	layerUploadURL, err := ub.BuildBlobUploadURL(name)
 	if err != nil {
@@ -11,6 +11,8 @@ import (
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/configuration"
 	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/health"
+	"github.com/docker/distribution/health/checks"
 	"github.com/docker/distribution/notifications"
 	"github.com/docker/distribution/registry/api/v2"
 	"github.com/docker/distribution/registry/auth"
@@ -46,6 +48,13 @@ type App struct {
 	}
 
 	redis *redis.Pool
+
+	// deleteEnabled allows manifests to be removed through the api.
+	deleteEnabled bool
+
+	// readOnly is non-zero while the registry is in read-only mode. It is
+	// accessed atomically, since it can be toggled at runtime.
+	readOnly int32
 }
 
 // NewApp takes a configuration and returns a configured app, ready to serve
@@ -69,6 +78,7 @@ func NewApp(ctx context.Context, configuration configuration.Configuration) *App
 	app.register(v2.RouteNameBlob, layerDispatcher)
 	app.register(v2.RouteNameBlobUpload, layerUploadDispatcher)
 	app.register(v2.RouteNameBlobUploadChunk, layerUploadDispatcher)
+	app.register(v2.RouteNameCatalog, catalogDispatcher)
 
 	var err error
 	app.driver, err = factory.Create(configuration.Storage.Type(), configuration.Storage.Parameters())
@@ -86,6 +96,13 @@ func NewApp(ctx context.Context, configuration configuration.Configuration) *App
 
 	app.configureEvents(&configuration)
 	app.configureRedis(&configuration)
+	app.configureDelete(&configuration)
+
+	if configuration.Maintenance.ReadOnly.Enabled {
+		app.SetReadOnly(true)
+	}
+
+	app.configureUploadPurger(&configuration)
 
 	// configure storage caches
 	if cc, ok := configuration.Storage["cache"]; ok {
@@ -111,6 +128,17 @@ func NewApp(ctx context.Context, configuration configuration.Configuration) *App
 		app.registry = storage.NewRegistryWithDriver(app.driver, nil)
 	}
 
+	if configuration.Proxy.RemoteURL != "" {
+		app.registry, err = registrymiddleware.Get("proxy", map[string]interface{}{
+			"remoteurl": configuration.Proxy.RemoteURL,
+		}, app.registry)
+		if err != nil {
+			panic(fmt.Sprintf("unable to configure proxy: %v", err))
+		}
+
+		ctxu.GetLogger(app).Infof("registry configured as a pull through cache of %s", configuration.Proxy.RemoteURL)
+	}
+
 	app.registry, err = applyRegistryMiddleware(app.registry, configuration.Middleware["registry"])
 	if err != nil {
 		panic(err)
@@ -129,6 +157,80 @@ func NewApp(ctx context.Context, configuration configuration.Configuration) *App
 	return app
 }
 
+// defaultCheckInterval is the period between health checks without a
+// configured interval.
+const defaultCheckInterval = 10 * time.Second
+
+// RegisterHealthChecks registers the health checks of the configuration. It
+// is left to the caller, rather than done by NewApp, since the checks are
+// registered with the global health package: it must only be called once per
+// registry process.
+func (app *App) RegisterHealthChecks() {
+	healthConfig := app.Config.Health
+
+	if healthConfig.StorageDriver.Enabled {
+		app.registerHealthCheck("storagedriver_"+app.Config.Storage.Type(), healthConfig.StorageDriver, func() error {
+			// The drivers refuse to Stat the root path, but it can be
+			// listed, which equally requires a round trip to the backend.
+			_, err := app.driver.List("/")
+			if _, ok := err.(storagedriver.PathNotFoundError); ok {
+				err = nil // pass this through, backend is responding, but this path doesn't exist.
+			}
+			return err
+		})
+	}
+
+	if healthConfig.Redis.Enabled {
+		if app.redis == nil {
+			panic("redis configuration required for the redis health check")
+		}
+
+		app.registerHealthCheck("redis", healthConfig.Redis, func() error {
+			conn := app.redis.Get()
+			defer conn.Close()
+
+			_, err := conn.Do("PING")
+			return err
+		})
+	}
+
+	for _, fileChecker := range healthConfig.FileCheckers {
+		app.registerHealthCheck(fileChecker.File, configuration.HealthChecker{
+			Interval: fileChecker.Interval,
+		}, checks.FileChecker(fileChecker.File).Check)
+	}
+
+	for _, httpChecker := range healthConfig.HTTPCheckers {
+		app.registerHealthCheck(httpChecker.URI, configuration.HealthChecker{
+			Interval:  httpChecker.Interval,
+			Threshold: httpChecker.Threshold,
+		}, checks.HTTPChecker(httpChecker.URI).Check)
+	}
+}
+
+// registerHealthCheck registers check to run periodically, as configured by
+// checker.
+func (app *App) registerHealthCheck(name string, checker configuration.HealthChecker, check func() error) {
+	interval := checkInterval(checker.Interval)
+
+	if checker.Threshold != 0 {
+		ctxu.GetLogger(app).Infof("configuring health check %s, interval=%v, threshold=%d", name, interval, checker.Threshold)
+		health.RegisterPeriodicThresholdFunc(name, check, interval, checker.Threshold)
+	} else {
+		ctxu.GetLogger(app).Infof("configuring health check %s, interval=%v", name, interval)
+		health.RegisterPeriodicFunc(name, check, interval)
+	}
+}
+
+// checkInterval returns the configured interval, or the default if none is
+// configured.
+func checkInterval(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return defaultCheckInterval
+	}
+	return interval
+}
+
 // register a handler with the application, by route name. The handler will be
 // passed through the application filters and context will be constructed at
 // request time.
@@ -140,7 +242,7 @@ func (app *App) register(routeName string, dispatch dispatchFunc) {
 	// replace it with manual routing and structure-based dispatch for better
 	// control over the request execution.
 
-	app.router.GetRoute(routeName).Handler(app.dispatcher(dispatch))
+	app.router.GetRoute(routeName).Handler(instrumentHandler(routeName, app.dispatcher(dispatch)))
 }
 
 // configureEvents prepares the event sink for action.
@@ -153,15 +255,37 @@ func (app *App) configureEvents(configuration *configuration.Configuration) {
 			continue
 		}
 
-		ctxu.GetLogger(app).Infof("configuring endpoint %v (%v), timeout=%s, headers=%v", endpoint.Name, endpoint.URL, endpoint.Timeout, endpoint.Headers)
-		endpoint := notifications.NewEndpoint(endpoint.Name, endpoint.URL, notifications.EndpointConfig{
-			Timeout:   endpoint.Timeout,
-			Threshold: endpoint.Threshold,
-			Backoff:   endpoint.Backoff,
-			Headers:   endpoint.Headers,
+		ctxu.GetLogger(app).Infof("configuring endpoint %v (%v), timeout=%s, headers=%v", endpoint.Name, notifications.RedactURL(endpoint.URL), endpoint.Timeout, endpoint.Headers)
+		sink, err := notifications.NewEndpoint(endpoint.Name, endpoint.URL, notifications.EndpointConfig{
+			Type:         endpoint.Type,
+			Parameters:   endpoint.Parameters,
+			Timeout:      endpoint.Timeout,
+			Threshold:    endpoint.Threshold,
+			Backoff:      endpoint.Backoff,
+			Headers:      endpoint.Headers,
+			Secret:       endpoint.Secret,
+			Workers:      endpoint.Workers,
+			MaxBatchSize: endpoint.MaxBatchSize,
+			BatchLinger:  endpoint.BatchLinger,
+			Queue: notifications.QueueConfig{
+				Path:          endpoint.Queue.Path,
+				Fsync:         endpoint.Queue.Fsync,
+				FsyncInterval: endpoint.Queue.FsyncInterval,
+				MaxSize:       endpoint.Queue.MaxSize,
+				Overflow:      endpoint.Queue.Overflow,
+				SegmentSize:   endpoint.Queue.SegmentSize,
+			},
+			Filter: notifications.FilterConfig{
+				Actions:           endpoint.Filter.Actions,
+				Repositories:      endpoint.Filter.Repositories,
+				IgnoredMediaTypes: endpoint.Filter.IgnoredMediaTypes,
+			},
 		})
+		if err != nil {
+			panic(fmt.Sprintf("unable to configure endpoint %s: %v", endpoint.Name, err))
+		}
 
-		sinks = append(sinks, endpoint)
+		sinks = append(sinks, sink)
 	}
 
 	// NOTE(stevvooe): Moving to a new queueing implementation is as easy as
@@ -188,6 +312,51 @@ func (app *App) configureEvents(configuration *configuration.Configuration) {
 	}
 }
 
+const (
+	// defaultUploadPurgeAge is the age after which uploads are purged, if
+	// none is configured.
+	defaultUploadPurgeAge = 7 * 24 * time.Hour
+
+	// defaultUploadPurgeInterval is the duration between upload purges, if
+	// none is configured.
+	defaultUploadPurgeInterval = 24 * time.Hour
+)
+
+// configureUploadPurger starts purging the stale uploads in the background,
+// if it is turned on in the maintenance section.
+func (app *App) configureUploadPurger(configuration *configuration.Configuration) {
+	purging := configuration.Maintenance.UploadPurging
+	if !purging.Enabled {
+		return
+	}
+
+	age := purging.Age
+	if age <= 0 {
+		age = defaultUploadPurgeAge
+	}
+
+	interval := purging.Interval
+	if interval <= 0 {
+		interval = defaultUploadPurgeInterval
+	}
+
+	storage.StartUploadPurger(app, app.driver, age, interval, purging.DryRun, app.ReadOnly)
+}
+
+// configureDelete enables manifest deletion if it is turned on in the storage
+// delete section.
+func (app *App) configureDelete(configuration *configuration.Configuration) {
+	if dc, ok := configuration.Storage["delete"]; ok {
+		if enabled, ok := dc["enabled"].(bool); ok {
+			app.deleteEnabled = enabled
+		}
+	}
+
+	if app.deleteEnabled {
+		ctxu.GetLogger(app).Infof("manifest deletion enabled")
+	}
+}
+
 func (app *App) configureRedis(configuration *configuration.Configuration) {
 	if configuration.Redis.Addr == "" {
 		ctxu.GetLogger(app).Infof("redis not configured")
@@ -324,6 +493,13 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 			return
 		}
 
+		if app.ReadOnly() && r.Method != "GET" && r.Method != "HEAD" {
+			context.Errors.Push(v2.ErrorCodeUnsupported, "registry is in read-only mode")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			serveJSON(w, context.Errors)
+			return
+		}
+
 		if app.nameRequired(r) {
 			repository, err := app.registry.Repository(context, getName(context))
 
@@ -412,14 +588,15 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 	if repo != "" {
 		accessRecords = appendAccessRecords(accessRecords, r.Method, repo)
 	} else {
-		// Only allow the name not to be set on the base route.
+		// Only allow the name not to be set on the base and catalog routes.
 		if app.nameRequired(r) {
 			// For this to be properly secured, repo must always be set for a
-			// resource that may make a modification. The only condition under
-			// which name is not set and we still allow access is when the
-			// base route is accessed. This section prevents us from making
-			// that mistake elsewhere in the code, allowing any operation to
-			// proceed.
+			// resource that may make a modification. The only conditions
+			// under which name is not set and we still allow access are when
+			// the base or catalog routes are accessed. The catalog filters
+			// its response by pull access to each repository. This section
+			// prevents us from making that mistake elsewhere in the code,
+			// allowing any operation to proceed.
 			w.Header().Set("Content-Type", "application/json; charset=utf-8")
 			w.WriteHeader(http.StatusForbidden)
 
@@ -441,12 +618,22 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 			errs.Push(v2.ErrorCodeUnauthorized, accessRecords)
 			serveJSON(w, errs)
 		default:
-			// This condition is a potential security problem either in
-			// the configuration or whatever is backing the access
-			// controller. Just return a bad request with no information
-			// to avoid exposure. The request should not proceed.
-			ctxu.GetLogger(context).Errorf("error checking authorization: %v", err)
-			w.WriteHeader(http.StatusBadRequest)
+			if err == auth.ErrAccessDenied {
+				// The client is known, but may not do what it asked for.
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.WriteHeader(http.StatusForbidden)
+
+				var errs v2.Errors
+				errs.Push(v2.ErrorCodeDenied, accessRecords)
+				serveJSON(w, errs)
+			} else {
+				// This condition is a potential security problem either in
+				// the configuration or whatever is backing the access
+				// controller. Just return a bad request with no information
+				// to avoid exposure. The request should not proceed.
+				ctxu.GetLogger(context).Errorf("error checking authorization: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+			}
 		}
 
 		return err
@@ -474,7 +661,12 @@ func (app *App) eventBridge(ctx *Context, r *http.Request) notifications.Listene
 // nameRequired returns true if the route requires a name.
 func (app *App) nameRequired(r *http.Request) bool {
 	route := mux.CurrentRoute(r)
-	return route == nil || route.GetName() != v2.RouteNameBase
+	if route == nil {
+		return true
+	}
+
+	routeName := route.GetName()
+	return routeName != v2.RouteNameBase && routeName != v2.RouteNameCatalog
 }
 
 // apiBase implements a simple yes-man for doing overall checks against the
@@ -2,13 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/health"
 	"github.com/docker/distribution/registry/api/v2"
 	"github.com/docker/distribution/registry/auth"
 	_ "github.com/docker/distribution/registry/auth/silly"
@@ -269,3 +273,108 @@ func TestAppendAccessRecords(t *testing.T) {
 	}
 
 }
+
+// TestRegisterHealthChecks ensures that the configured checks are registered
+// and take the application out of rotation when they fail.
+func TestRegisterHealthChecks(t *testing.T) {
+	disable, err := ioutil.TempFile("", "registry-health")
+	if err != nil {
+		t.Fatalf("unexpected error creating file: %v", err)
+	}
+	disable.Close()
+	defer os.Remove(disable.Name())
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": nil,
+		},
+		Health: configuration.Health{
+			StorageDriver: configuration.HealthChecker{
+				Enabled:  true,
+				Interval: 10 * time.Millisecond,
+			},
+			FileCheckers: []configuration.FileChecker{
+				{File: disable.Name(), Interval: 10 * time.Millisecond},
+			},
+		},
+	}
+
+	app := NewApp(context.Background(), config)
+	app.RegisterHealthChecks()
+
+	server := httptest.NewServer(health.Handler(app))
+	defer server.Close()
+
+	waitForStatus := func(expected int) {
+		var status int
+		for i := 0; i < 100; i++ {
+			resp, err := http.Get(server.URL + "/v2/")
+			if err != nil {
+				t.Fatalf("unexpected error during GET: %v", err)
+			}
+			resp.Body.Close()
+
+			status = resp.StatusCode
+			if status == expected {
+				return
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		t.Fatalf("unexpected status code: %d != %d, checks: %v", status, expected, health.CheckStatus())
+	}
+
+	// The file exists, so the registry is out of rotation.
+	waitForStatus(http.StatusServiceUnavailable)
+
+	if _, ok := health.CheckStatus()["storagedriver_inmemory"]; ok {
+		t.Fatalf("unexpected storage driver check failure: %v", health.CheckStatus())
+	}
+
+	os.Remove(disable.Name())
+	waitForStatus(http.StatusOK)
+}
+
+// TestRequestMetrics ensures that requests are counted by route name, method
+// and status code.
+func TestRequestMetrics(t *testing.T) {
+	app := NewApp(context.Background(), configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": nil,
+		},
+	})
+	server := httptest.NewServer(app)
+	defer server.Close()
+
+	builder, err := v2.NewURLBuilderFromString(server.URL)
+	if err != nil {
+		t.Fatalf("error creating urlbuilder: %v", err)
+	}
+
+	tagsURL, err := builder.BuildTagsURL("foo/metrics")
+	if err != nil {
+		t.Fatalf("error building tags url: %v", err)
+	}
+
+	before := httpRequests.Value(v2.RouteNameTags, "GET", "404")
+	count := httpRequestDuration.Count(v2.RouteNameTags, "GET")
+
+	resp, err := http.Get(tagsURL)
+	if err != nil {
+		t.Fatalf("unexpected error during GET: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if after := httpRequests.Value(v2.RouteNameTags, "GET", "404"); after != before+1 {
+		t.Fatalf("request not counted: %v != %v", after, before+1)
+	}
+
+	if after := httpRequestDuration.Count(v2.RouteNameTags, "GET"); after != count+1 {
+		t.Fatalf("request duration not observed: %v != %v", after, count+1)
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/handlers"
+)
+
+// maximumReturnedEntries bounds the number of repositories returned in a
+// single catalog response.
+const maximumReturnedEntries = 100
+
+// catalogDispatcher constructs the catalog handler api endpoint.
+func catalogDispatcher(ctx *Context, r *http.Request) http.Handler {
+	catalogHandler := &catalogHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(catalogHandler.GetCatalog),
+	}
+}
+
+// catalogHandler handles requests for the catalog of repositories.
+type catalogHandler struct {
+	*Context
+}
+
+type catalogAPIResponse struct {
+	Repositories []string `json:"repositories"`
+}
+
+// GetCatalog returns a json list of the repositories in the registry that
+// the client may pull, paginated according to the "n" and "last" query
+// parameters.
+func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	maxEntries := maximumReturnedEntries
+	if n, err := strconv.Atoi(q.Get("n")); err == nil && n > 0 && n < maxEntries {
+		maxEntries = n
+	}
+
+	pullAuthorized, err := ch.pullFilter()
+	if err != nil {
+		ch.Errors.PushErr(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var (
+		repos       = make([]string, 0, maxEntries)
+		page        = make([]string, maxEntries)
+		last        = q.Get("last")
+		moreEntries = true
+	)
+
+	// Repositories the client may not pull are dropped from each page, so
+	// keep reading until the response is full or the catalog is exhausted.
+	for moreEntries && len(repos) < maxEntries {
+		n, err := ch.App.registry.Repositories(ch, page[:maxEntries-len(repos)], last)
+		if err == io.EOF {
+			moreEntries = false
+		} else if err != nil {
+			ch.Errors.PushErr(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		for _, name := range page[:n] {
+			if pullAuthorized(name) {
+				repos = append(repos, name)
+			}
+		}
+
+		if n > 0 {
+			last = page[n-1]
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	// Link to the next page, starting after the last repository returned.
+	if moreEntries {
+		urlStr, err := ch.urlBuilder.BuildCatalogURL(url.Values{
+			"n":    []string{strconv.Itoa(maxEntries)},
+			"last": []string{repos[len(repos)-1]},
+		})
+		if err != nil {
+			ch.Errors.PushErr(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", urlStr))
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(catalogAPIResponse{
+		Repositories: repos,
+	}); err != nil {
+		ch.Errors.PushErr(err)
+		return
+	}
+}
@@ -8,6 +8,7 @@ import (
 	ctxu "github.com/docker/distribution/context"
 	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/auth"
 	"golang.org/x/net/context"
 )
 
@@ -41,6 +42,51 @@ func (ctx *Context) Value(key interface{}) interface{} {
 	return ctx.Context.Value(key)
 }
 
+// pullAuthorized returns true if the client may pull from the named
+// repository, which need not be the repository of the request. Without an
+// access controller, every repository may be pulled.
+func (ctx *Context) pullAuthorized(name string) bool {
+	if ctx.App.accessController == nil {
+		return true
+	}
+
+	_, err := ctx.App.accessController.Authorized(ctx, auth.Access{
+		Resource: auth.Resource{
+			Type: "repository",
+			Name: name,
+		},
+		Action: "pull",
+	})
+
+	return err == nil
+}
+
+// pullFilter returns a function reporting whether the client may pull from
+// the named repository. When the access controller supports it, the access
+// is checked against the authorization of the request, so that the client is
+// authenticated once rather than once per repository.
+func (ctx *Context) pullFilter() (func(name string) bool, error) {
+	filter, ok := ctx.App.accessController.(auth.AccessFilter)
+	if !ok {
+		return ctx.pullAuthorized, nil
+	}
+
+	allowed, err := filter.Filter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(name string) bool {
+		return allowed(auth.Access{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: name,
+			},
+			Action: "pull",
+		})
+	}, nil
+}
+
 func getName(ctx context.Context) (name string) {
 	return ctxu.GetStringValue(ctx, "vars.name")
 }
@@ -130,6 +130,12 @@ func (imh *imageManifestHandler) PutImageManifest(w http.ResponseWriter, r *http
 	}
 
 	if err := manifests.Put(&manifest); err != nil {
+		if err == distribution.ErrUnsupported {
+			imh.Errors.Push(v2.ErrorCodeUnsupported)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
 		// TODO(stevvooe): These error handling switches really need to be
 		// handled by an app global mapper.
 		switch err := err.(type) {
@@ -172,17 +178,46 @@ func (imh *imageManifestHandler) PutImageManifest(w http.ResponseWriter, r *http
 	w.WriteHeader(http.StatusAccepted)
 }
 
-// DeleteImageManifest removes the image with the given tag from the registry.
+// DeleteImageManifest removes the manifest revision identified by digest
+// from the registry. Tags pointing at the revision are removed along with it.
+// If a tag is given instead, only the tag is removed.
 func (imh *imageManifestHandler) DeleteImageManifest(w http.ResponseWriter, r *http.Request) {
 	ctxu.GetLogger(imh).Debug("DeleteImageManifest")
 
-	// TODO(stevvooe): Unfortunately, at this point, manifest deletes are
-	// unsupported. There are issues with schema version 1 that make removing
-	// tag index entries a serious problem in eventually consistent storage.
-	// Once we work out schema version 2, the full deletion system will be
-	// worked out and we can add support back.
-	imh.Errors.Push(v2.ErrorCodeUnsupported)
-	w.WriteHeader(http.StatusBadRequest)
+	if !imh.App.deleteEnabled {
+		imh.Errors.Push(v2.ErrorCodeUnsupported, "manifest deletion is disabled")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	manifests := imh.Repository.Manifests()
+
+	var err error
+	if imh.Tag != "" {
+		err = manifests.DeleteTag(imh.Tag)
+	} else {
+		err = manifests.Delete(imh.Digest)
+	}
+
+	if err != nil {
+		if err == distribution.ErrUnsupported {
+			imh.Errors.Push(v2.ErrorCodeUnsupported)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch err := err.(type) {
+		case distribution.ErrUnknownManifestRevision, distribution.ErrManifestUnknown:
+			imh.Errors.Push(v2.ErrorCodeManifestUnknown, err)
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			imh.Errors.PushErr(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
 }
 
 // digestManifest takes a digest of the given manifest. This belongs somewhere
@@ -120,11 +120,24 @@ type layerUploadHandler struct {
 }
 
 // StartLayerUpload begins the layer upload process and allocates a server-
-// side upload session.
+// side upload session. If the request asks to mount a layer from another
+// repository and the mount succeeds, no upload session is needed.
 func (luh *layerUploadHandler) StartLayerUpload(w http.ResponseWriter, r *http.Request) {
+	if mount, from := r.FormValue("mount"), r.FormValue("from"); mount != "" && from != "" {
+		if luh.mountLayer(w, mount, from) {
+			return
+		}
+	}
+
 	layers := luh.Repository.Layers()
 	upload, err := layers.Upload()
 	if err != nil {
+		if err == distribution.ErrUnsupported {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			luh.Errors.Push(v2.ErrorCodeUnsupported)
+			return
+		}
+
 		w.WriteHeader(http.StatusInternalServerError) // Error conditions here?
 		luh.Errors.Push(v2.ErrorCodeUnknown, err)
 		return
@@ -143,6 +156,59 @@ func (luh *layerUploadHandler) StartLayerUpload(w http.ResponseWriter, r *http.R
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// mountLayer links the layer with the digest mount from the repository
+// named from into the repository of the request. It returns true if the
+// response was written, either with 201 Created after a successful mount or
+// with an error. False is returned if the client may not pull from the
+// source or the source does not have the layer, in which case a regular
+// upload should be started.
+func (luh *layerUploadHandler) mountLayer(w http.ResponseWriter, mount, from string) bool {
+	dgst, err := digest.ParseDigest(mount)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		luh.Errors.Push(v2.ErrorCodeDigestInvalid, err)
+		return true
+	}
+
+	if err := v2.ValidateRespositoryName(from); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		luh.Errors.Push(v2.ErrorCodeNameInvalid, err)
+		return true
+	}
+
+	if !luh.pullAuthorized(from) {
+		ctxu.GetLogger(luh).Infof("not mounting layer %s: pull access to %s denied", dgst, from)
+		return false
+	}
+
+	layer, err := luh.Repository.Layers().Mount(from, dgst)
+	if err != nil {
+		if _, ok := err.(distribution.ErrUnknownLayer); ok || err == distribution.ErrUnsupported {
+			ctxu.GetLogger(luh).Infof("not mounting layer %s from %s: %v", dgst, from, err)
+			return false
+		}
+
+		ctxu.GetLogger(luh).Errorf("error mounting layer %s from %s: %v", dgst, from, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		luh.Errors.Push(v2.ErrorCodeUnknown, err)
+		return true
+	}
+	defer layer.Close()
+
+	layerURL, err := luh.urlBuilder.BuildBlobURL(luh.Repository.Name(), layer.Digest())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		luh.Errors.Push(v2.ErrorCodeUnknown, err)
+		return true
+	}
+
+	w.Header().Set("Location", layerURL)
+	w.Header().Set("Content-Length", "0")
+	w.Header().Set("Docker-Content-Digest", layer.Digest().String())
+	w.WriteHeader(http.StatusCreated)
+	return true
+}
+
 // GetUploadStatus returns the status of a given upload, identified by uuid.
 func (luh *layerUploadHandler) GetUploadStatus(w http.ResponseWriter, r *http.Request) {
 	if luh.Upload == nil {
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	ctxu "github.com/docker/distribution/context"
+)
+
+// ReadOnly returns true if the registry is in read-only mode, refusing all
+// requests that would modify repositories.
+func (app *App) ReadOnly() bool {
+	return atomic.LoadInt32(&app.readOnly) != 0
+}
+
+// SetReadOnly enables or disables the read-only mode of the registry.
+func (app *App) SetReadOnly(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+
+	if atomic.SwapInt32(&app.readOnly, v) != v {
+		ctxu.GetLogger(app).Infof("read-only mode enabled: %v", enabled)
+	}
+}
+
+// ReadOnlyHandler reports the read-only mode of the registry as JSON. A POST
+// request sets the mode from the "enabled" form value. It is meant to be
+// served on the debug server only:
+//
+//	http.HandleFunc("/debug/maintenance/readonly", app.ReadOnlyHandler)
+func (app *App) ReadOnlyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+		if err != nil {
+			http.Error(w, "invalid enabled value: "+strconv.Quote(r.FormValue("enabled")), http.StatusBadRequest)
+			return
+		}
+
+		app.SetReadOnly(enabled)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(struct {
+		Enabled bool `json:"enabled"`
+	}{
+		Enabled: app.ReadOnly(),
+	})
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker/distribution/metrics"
+)
+
+var (
+	// httpRequests counts the requests served, by route name, method and
+	// response status code.
+	httpRequests = metrics.NewCounter("registry_http_requests_total",
+		"The number of HTTP requests served.", "route", "method", "code")
+
+	// httpRequestDuration tracks the latency of the requests served, by route
+	// name and method.
+	httpRequestDuration = metrics.NewHistogram("registry_http_request_duration_seconds",
+		"The latency of HTTP requests.", metrics.DefaultBuckets, "route", "method")
+)
+
+func init() {
+	metrics.Register(httpRequests)
+	metrics.Register(httpRequestDuration)
+}
+
+// instrumentHandler records the request metrics of the handler for the named
+// route.
+func instrumentHandler(routeName string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		srw := &statusRecordingResponseWriter{ResponseWriter: w}
+
+		handler.ServeHTTP(srw, r)
+
+		status := srw.status
+		if status == 0 {
+			status = http.StatusOK // nothing written at all
+		}
+
+		httpRequests.Inc(routeName, r.Method, strconv.Itoa(status))
+		httpRequestDuration.Observe(time.Since(start).Seconds(), routeName, r.Method)
+	})
+}
+
+// statusRecordingResponseWriter records the status of the response.
+type statusRecordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (srw *statusRecordingResponseWriter) WriteHeader(status int) {
+	if srw.status == 0 {
+		srw.status = status
+	}
+	srw.ResponseWriter.WriteHeader(status)
+}
+
+func (srw *statusRecordingResponseWriter) Write(p []byte) (int, error) {
+	if srw.status == 0 {
+		srw.status = http.StatusOK
+	}
+	return srw.ResponseWriter.Write(p)
+}
+
+func (srw *statusRecordingResponseWriter) Flush() {
+	if flusher, ok := srw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/registry/api/v2"
@@ -30,12 +33,29 @@ type tagsAPIResponse struct {
 	Tags []string `json:"tags"`
 }
 
-// GetTags returns a json list of tags for a specific image name.
+// GetTags returns a json list of tags for a specific image name. If the "n"
+// query parameter is set, at most n tags are returned, with a Link header
+// pointing to the next page if more remain. Without it, all tags are
+// returned, as older clients do not follow links.
 func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	manifests := th.Repository.Manifests()
 
-	tags, err := manifests.Tags()
+	q := r.URL.Query()
+	last := q.Get("last")
+
+	var maxEntries int
+	if n, err := strconv.Atoi(q.Get("n")); err == nil && n > 0 {
+		maxEntries = n
+	}
+
+	// Request one extra tag to find out whether there is a next page.
+	limit := 0
+	if maxEntries > 0 {
+		limit = maxEntries + 1
+	}
+
+	tags, err := manifests.Tags(limit, last)
 	if err != nil {
 		switch err := err.(type) {
 		case distribution.ErrRepositoryUnknown:
@@ -47,8 +67,27 @@ func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if tags == nil {
+		tags = []string{}
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
+	if maxEntries > 0 && len(tags) > maxEntries {
+		tags = tags[:maxEntries]
+
+		urlStr, err := th.urlBuilder.BuildTagsURL(th.Repository.Name(), url.Values{
+			"n":    []string{strconv.Itoa(maxEntries)},
+			"last": []string{tags[len(tags)-1]},
+		})
+		if err != nil {
+			th.Errors.PushErr(err)
+			return
+		}
+
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", urlStr))
+	}
+
 	enc := json.NewEncoder(w)
 	if err := enc.Encode(tagsAPIResponse{
 		Name: th.Repository.Name(),
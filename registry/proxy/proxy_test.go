@@ -0,0 +1,218 @@
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest"
+	"github.com/docker/distribution/registry/client"
+	"github.com/docker/distribution/registry/handlers"
+	"github.com/docker/distribution/registry/middleware/registry"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/testutil"
+	"github.com/docker/libtrust"
+	"golang.org/x/net/context"
+)
+
+// newUpstream starts an in-process registry to act as the remote registry.
+func newUpstream(t *testing.T) *httptest.Server {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+	}
+
+	return httptest.NewServer(handlers.NewApp(context.Background(), config))
+}
+
+// pushImage pushes a random layer and a signed manifest referencing it to
+// the remote registry, returning the layer content and the manifest digest.
+func pushImage(t *testing.T, remote client.Client, name, tag string) ([]byte, digest.Digest) {
+	rs, dgstStr, err := testutil.CreateRandomTarFile()
+	if err != nil {
+		t.Fatalf("error creating random layer: %v", err)
+	}
+	layerDigest := digest.Digest(dgstStr)
+
+	content, err := ioutil.ReadAll(rs)
+	if err != nil {
+		t.Fatalf("error reading random layer: %v", err)
+	}
+
+	location, err := remote.InitiateBlobUpload(name)
+	if err != nil {
+		t.Fatalf("error starting upload: %v", err)
+	}
+
+	if err := remote.UploadBlob(location, ioutil.NopCloser(bytes.NewReader(content)), len(content), layerDigest); err != nil {
+		t.Fatalf("error uploading layer: %v", err)
+	}
+
+	pk, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating private key: %v", err)
+	}
+
+	sm, err := manifest.Sign(&manifest.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 1,
+		},
+		Name: name,
+		Tag:  tag,
+		FSLayers: []manifest.FSLayer{
+			{
+				BlobSum: layerDigest,
+			},
+		},
+	}, pk)
+	if err != nil {
+		t.Fatalf("error signing manifest: %v", err)
+	}
+
+	if err := remote.PutImageManifest(name, tag, sm); err != nil {
+		t.Fatalf("error putting manifest: %v", err)
+	}
+
+	dgst, err := manifestDigest(sm)
+	if err != nil {
+		t.Fatalf("error digesting manifest: %v", err)
+	}
+
+	return content, dgst
+}
+
+func TestProxyPullThrough(t *testing.T) {
+	ctx := context.Background()
+	name := "foo/bar"
+
+	upstream := newUpstream(t)
+	defer upstream.Close()
+
+	remote, err := client.New(upstream.URL)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	content, dgst := pushImage(t, remote, name, "latest")
+
+	local := storage.NewRegistryWithDriver(inmemory.New(), nil)
+	proxied, err := middleware.Get("proxy", map[string]interface{}{"remoteurl": upstream.URL}, local)
+	if err != nil {
+		t.Fatalf("error configuring proxy: %v", err)
+	}
+
+	repo, err := proxied.Repository(ctx, name)
+	if err != nil {
+		t.Fatalf("error getting repository: %v", err)
+	}
+
+	localRepo, err := local.Repository(ctx, name)
+	if err != nil {
+		t.Fatalf("error getting local repository: %v", err)
+	}
+
+	if _, err := localRepo.Manifests().GetByTag("latest"); err == nil {
+		t.Fatalf("expected local cache to be empty")
+	}
+
+	sm, err := repo.Manifests().GetByTag("latest")
+	if err != nil {
+		t.Fatalf("error fetching manifest through proxy: %v", err)
+	}
+
+	if fetched, err := manifestDigest(sm); err != nil || fetched != dgst {
+		t.Fatalf("unexpected manifest digest: %v != %v (%v)", fetched, dgst, err)
+	}
+
+	// The manifest and its layer are now served from local storage.
+	if _, err := localRepo.Manifests().Get(dgst); err != nil {
+		t.Fatalf("manifest not cached locally: %v", err)
+	}
+
+	layerDigest := sm.FSLayers[0].BlobSum
+	checkLayer(t, localRepo.Layers(), layerDigest, content)
+	checkLayer(t, repo.Layers(), layerDigest, content)
+
+	tags, err := repo.Manifests().Tags(0, "")
+	if err != nil {
+		t.Fatalf("error listing tags through proxy: %v", err)
+	}
+
+	if len(tags) != 1 || tags[0] != "latest" {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+
+	// Content that the remote registry does not have is reported as missing.
+	if _, err := repo.Manifests().Get(digest.Digest("sha256:" + string(bytes.Repeat([]byte("0"), 64)))); err == nil {
+		t.Fatalf("expected error fetching unknown manifest")
+	} else if _, ok := err.(distribution.ErrUnknownManifestRevision); !ok {
+		t.Fatalf("unexpected error fetching unknown manifest: %v", err)
+	}
+
+	if _, err := repo.Manifests().GetByTag("missing"); err == nil {
+		t.Fatalf("expected error fetching unknown tag")
+	} else if _, ok := err.(distribution.ErrManifestUnknown); !ok {
+		t.Fatalf("unexpected error fetching unknown tag: %v", err)
+	}
+
+	// The proxy is read only.
+	if _, err := repo.Layers().Upload(); err != distribution.ErrUnsupported {
+		t.Fatalf("expected upload to be unsupported: %v", err)
+	}
+
+	if err := repo.Manifests().Put(sm); err != distribution.ErrUnsupported {
+		t.Fatalf("expected put to be unsupported: %v", err)
+	}
+
+	if err := repo.Manifests().Delete(dgst); err != distribution.ErrUnsupported {
+		t.Fatalf("expected delete to be unsupported: %v", err)
+	}
+
+	// Once the remote registry is gone, cached content is still served.
+	upstream.Close()
+
+	if _, err := repo.Manifests().GetByTag("latest"); err != nil {
+		t.Fatalf("error fetching cached manifest by tag: %v", err)
+	}
+
+	if _, err := repo.Manifests().Get(dgst); err != nil {
+		t.Fatalf("error fetching cached manifest by digest: %v", err)
+	}
+
+	checkLayer(t, repo.Layers(), layerDigest, content)
+}
+
+func TestProxyConfiguration(t *testing.T) {
+	local := storage.NewRegistryWithDriver(inmemory.New(), nil)
+
+	if _, err := middleware.Get("proxy", map[string]interface{}{}, local); err == nil {
+		t.Fatalf("expected error configuring proxy without remoteurl")
+	}
+
+	if _, err := middleware.Get("proxy", map[string]interface{}{"remoteurl": 1}, local); err == nil {
+		t.Fatalf("expected error configuring proxy with invalid remoteurl")
+	}
+}
+
+func checkLayer(t *testing.T, layers distribution.LayerService, dgst digest.Digest, expected []byte) {
+	layer, err := layers.Fetch(dgst)
+	if err != nil {
+		t.Fatalf("error fetching layer %s: %v", dgst, err)
+	}
+	defer layer.Close()
+
+	content, err := ioutil.ReadAll(layer)
+	if err != nil {
+		t.Fatalf("error reading layer %s: %v", dgst, err)
+	}
+
+	if !bytes.Equal(content, expected) {
+		t.Fatalf("unexpected content for layer %s", dgst)
+	}
+}
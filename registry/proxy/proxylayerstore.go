@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"io"
+
+	"github.com/docker/distribution"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest"
+	"github.com/docker/distribution/registry/client"
+	"golang.org/x/net/context"
+)
+
+// proxyLayerStore serves layers from local storage, fetching them from the
+// remote registry on a cache miss.
+type proxyLayerStore struct {
+	ctx         context.Context
+	name        string
+	localLayers distribution.LayerService
+	remote      client.Client
+}
+
+var _ distribution.LayerService = &proxyLayerStore{}
+
+// Exists returns true if the layer is available locally or from the remote
+// registry.
+func (pls *proxyLayerStore) Exists(dgst digest.Digest) (bool, error) {
+	exists, err := pls.localLayers.Exists(dgst)
+	if err != nil || exists {
+		return exists, err
+	}
+
+	length, err := pls.remote.BlobLength(pls.name, dgst)
+	if err != nil {
+		return false, err
+	}
+
+	// The client reports a missing blob with a negative length.
+	return length >= 0, nil
+}
+
+// Fetch returns the layer from local storage, copying it from the remote
+// registry first if it is not yet available locally.
+func (pls *proxyLayerStore) Fetch(dgst digest.Digest) (distribution.Layer, error) {
+	layer, err := pls.localLayers.Fetch(dgst)
+	if _, ok := err.(distribution.ErrUnknownLayer); !ok {
+		return layer, err
+	}
+
+	if err := pls.fetchRemote(dgst); err != nil {
+		return nil, err
+	}
+
+	return pls.localLayers.Fetch(dgst)
+}
+
+// Upload is not supported by the proxy.
+func (pls *proxyLayerStore) Upload() (distribution.LayerUpload, error) {
+	return nil, distribution.ErrUnsupported
+}
+
+// Resume is not supported by the proxy.
+func (pls *proxyLayerStore) Resume(uuid string) (distribution.LayerUpload, error) {
+	return nil, distribution.ErrUnsupported
+}
+
+// Mount is not supported by the proxy.
+func (pls *proxyLayerStore) Mount(sourceRepo string, dgst digest.Digest) (distribution.Layer, error) {
+	return nil, distribution.ErrUnsupported
+}
+
+// fetchRemote copies the layer identified by dgst from the remote registry
+// into local storage. The content is verified against dgst before the layer
+// becomes available.
+func (pls *proxyLayerStore) fetchRemote(dgst digest.Digest) error {
+	ctxu.GetLogger(pls.ctx).Infof("fetching layer %s of %s from remote registry", dgst, pls.name)
+
+	rc, _, err := pls.remote.GetBlob(pls.name, dgst, 0)
+	if err != nil {
+		switch err.(type) {
+		case *client.BlobNotFoundError:
+			return distribution.ErrUnknownLayer{
+				FSLayer: manifest.FSLayer{BlobSum: dgst},
+			}
+		default:
+			return err
+		}
+	}
+	defer rc.Close()
+
+	upload, err := pls.localLayers.Upload()
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(upload, rc); err != nil {
+		upload.Cancel()
+		return err
+	}
+
+	if _, err := upload.Finish(dgst); err != nil {
+		upload.Cancel()
+		return err
+	}
+
+	return nil
+}
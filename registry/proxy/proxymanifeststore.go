@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/docker/distribution"
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest"
+	"github.com/docker/distribution/registry/client"
+	"golang.org/x/net/context"
+)
+
+// proxyManifestStore serves manifests from local storage, fetching them from
+// the remote registry on a cache miss. Tags are mutable, so they are always
+// resolved against the remote registry first, falling back to the local
+// copy only when the remote registry cannot be reached.
+type proxyManifestStore struct {
+	ctx            context.Context
+	name           string
+	localManifests distribution.ManifestService
+	layers         *proxyLayerStore
+	remote         client.Client
+}
+
+var _ distribution.ManifestService = &proxyManifestStore{}
+
+// Exists returns true if the manifest revision is available locally or from
+// the remote registry.
+func (pms *proxyManifestStore) Exists(dgst digest.Digest) (bool, error) {
+	if _, err := pms.Get(dgst); err != nil {
+		switch err.(type) {
+		case distribution.ErrUnknownManifestRevision:
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Get retrieves the manifest revision, fetching it from the remote registry
+// if it is not available locally.
+func (pms *proxyManifestStore) Get(dgst digest.Digest) (*manifest.SignedManifest, error) {
+	sm, err := pms.localManifests.Get(dgst)
+	if _, ok := err.(distribution.ErrUnknownManifestRevision); !ok {
+		return sm, err
+	}
+
+	sm, err = pms.fetchRemote(dgst.String())
+	if err != nil {
+		switch err.(type) {
+		case *client.ImageManifestNotFoundError, *client.RepositoryNotFoundError:
+			return nil, distribution.ErrUnknownManifestRevision{
+				Name:     pms.name,
+				Revision: dgst,
+			}
+		default:
+			return nil, err
+		}
+	}
+
+	// Never cache content that does not match the requested revision.
+	remoteDigest, err := manifestDigest(sm)
+	if err != nil {
+		return nil, err
+	}
+
+	if remoteDigest != dgst {
+		return nil, fmt.Errorf("remote manifest digest %s does not match requested digest %s", remoteDigest, dgst)
+	}
+
+	if err := pms.store(sm); err != nil {
+		return nil, err
+	}
+
+	return sm, nil
+}
+
+// Put is not supported by the proxy.
+func (pms *proxyManifestStore) Put(sm *manifest.SignedManifest) error {
+	return distribution.ErrUnsupported
+}
+
+// Delete is not supported by the proxy.
+func (pms *proxyManifestStore) Delete(dgst digest.Digest) error {
+	return distribution.ErrUnsupported
+}
+
+// DeleteTag is not supported by the proxy.
+func (pms *proxyManifestStore) DeleteTag(tag string) error {
+	return distribution.ErrUnsupported
+}
+
+// Tags lists the tags of the repository in the remote registry, or the
+// locally cached tags if the remote registry cannot be reached.
+func (pms *proxyManifestStore) Tags(n int, last string) ([]string, error) {
+	tags, err := pms.remote.ListImageTags(pms.name, n, last)
+	if err != nil {
+		switch err.(type) {
+		case *client.RepositoryNotFoundError:
+			return nil, distribution.ErrRepositoryUnknown{Name: pms.name}
+		default:
+			ctxu.GetLogger(pms.ctx).Warnf("error listing tags of %s from remote registry, using local tags: %v", pms.name, err)
+			return pms.localManifests.Tags(n, last)
+		}
+	}
+
+	return tags, nil
+}
+
+// ExistsByTag returns true if the tag resolves to a manifest.
+func (pms *proxyManifestStore) ExistsByTag(tag string) (bool, error) {
+	if _, err := pms.GetByTag(tag); err != nil {
+		switch err.(type) {
+		case distribution.ErrManifestUnknown:
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// GetByTag resolves the tag against the remote registry, caching the
+// resulting manifest. If the remote registry cannot be reached, the locally
+// cached manifest for the tag is returned.
+func (pms *proxyManifestStore) GetByTag(tag string) (*manifest.SignedManifest, error) {
+	sm, err := pms.fetchRemote(tag)
+	if err != nil {
+		switch err.(type) {
+		case *client.ImageManifestNotFoundError, *client.RepositoryNotFoundError:
+			return nil, distribution.ErrManifestUnknown{Name: pms.name, Tag: tag}
+		default:
+			ctxu.GetLogger(pms.ctx).Warnf("error fetching %s:%s from remote registry, using local copy: %v", pms.name, tag, err)
+			return pms.localManifests.GetByTag(tag)
+		}
+	}
+
+	if err := pms.store(sm); err != nil {
+		return nil, err
+	}
+
+	return sm, nil
+}
+
+// fetchRemote retrieves the manifest identified by reference, a tag or a
+// digest, from the remote registry.
+func (pms *proxyManifestStore) fetchRemote(reference string) (*manifest.SignedManifest, error) {
+	ctxu.GetLogger(pms.ctx).Infof("fetching manifest %s:%s from remote registry", pms.name, reference)
+	return pms.remote.GetImageManifest(pms.name, reference)
+}
+
+// store saves the manifest in local storage. The local manifest service
+// verifies that every referenced layer is present, so the layers are fetched
+// first.
+func (pms *proxyManifestStore) store(sm *manifest.SignedManifest) error {
+	for _, fsLayer := range sm.FSLayers {
+		exists, err := pms.layers.localLayers.Exists(fsLayer.BlobSum)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			continue
+		}
+
+		if err := pms.layers.fetchRemote(fsLayer.BlobSum); err != nil {
+			return err
+		}
+	}
+
+	return pms.localManifests.Put(sm)
+}
+
+// manifestDigest returns the digest of the signed manifest payload.
+func manifestDigest(sm *manifest.SignedManifest) (digest.Digest, error) {
+	payload, err := sm.Payload()
+	if err != nil {
+		return "", err
+	}
+
+	return digest.FromBytes(payload)
+}
@@ -0,0 +1,100 @@
+// Package proxy implements a pull through cache of a remote registry as a
+// registry middleware. Manifests and layers missing from the wrapped
+// namespace are fetched from the remote registry, stored locally and then
+// served. Pushes and deletes are refused.
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/client"
+	"github.com/docker/distribution/registry/middleware/registry"
+	"golang.org/x/net/context"
+)
+
+// proxyingRegistry wraps a local namespace, filling it from a remote
+// registry on demand.
+type proxyingRegistry struct {
+	distribution.Namespace
+	remote client.Client
+}
+
+// newProxyingRegistry returns a namespace that caches the content of the
+// remote registry at remoteURL in local.
+func newProxyingRegistry(local distribution.Namespace, options map[string]interface{}) (distribution.Namespace, error) {
+	remoteURL, ok := options["remoteurl"]
+	if !ok {
+		return nil, fmt.Errorf("no remoteurl provided")
+	}
+
+	remoteURLStr, ok := remoteURL.(string)
+	if !ok || remoteURLStr == "" {
+		return nil, fmt.Errorf("remoteurl must be a non-empty string")
+	}
+
+	remote, err := client.New(remoteURLStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proxyingRegistry{
+		Namespace: local,
+		remote:    remote,
+	}, nil
+}
+
+// Repository returns the named repository, backed by the local repository
+// of the same name and filled from the remote registry.
+func (pr *proxyingRegistry) Repository(ctx context.Context, name string) (distribution.Repository, error) {
+	local, err := pr.Namespace.Repository(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proxiedRepository{
+		Repository: local,
+		ctx:        ctx,
+		remote:     pr.remote,
+	}, nil
+}
+
+// proxiedRepository provides proxied manifest and layer services for a single
+// repository.
+type proxiedRepository struct {
+	distribution.Repository
+	ctx    context.Context
+	remote client.Client
+}
+
+// Manifests returns a manifest service that fetches missing manifests, and
+// the layers they reference, from the remote registry.
+func (pr *proxiedRepository) Manifests() distribution.ManifestService {
+	return &proxyManifestStore{
+		ctx:            pr.ctx,
+		name:           pr.Name(),
+		localManifests: pr.Repository.Manifests(),
+		layers:         pr.layers(),
+		remote:         pr.remote,
+	}
+}
+
+// Layers returns a layer service that fetches missing layers from the
+// remote registry.
+func (pr *proxiedRepository) Layers() distribution.LayerService {
+	return pr.layers()
+}
+
+func (pr *proxiedRepository) layers() *proxyLayerStore {
+	return &proxyLayerStore{
+		ctx:         pr.ctx,
+		name:        pr.Name(),
+		localLayers: pr.Repository.Layers(),
+		remote:      pr.remote,
+	}
+}
+
+// init registers the proxy middleware.
+func init() {
+	middleware.Register("proxy", middleware.InitFunc(newProxyingRegistry))
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"errors"
+	"io"
+
+	"golang.org/x/net/context"
+)
+
+// errFinishedWalk is returned by the walk function of Repositories to stop
+// the walk once the page is full.
+var errFinishedWalk = errors.New("finished walk")
+
+// Repositories returns a lexically sorted page of the repositories in the
+// registry, starting after last. The catalog is built by walking the
+// repositories tree of the storage driver, which stops once the page is full.
+// When the returned page reaches the end of the catalog, err is io.EOF.
+func (reg *registry) Repositories(ctx context.Context, repos []string, last string) (n int, err error) {
+	if len(repos) == 0 {
+		return 0, errors.New("no space in slice")
+	}
+
+	err = walkRepositoriesAfter(reg.driver, reg.pm, last, func(name string) error {
+		if n == len(repos) {
+			// Another repository follows the page.
+			return errFinishedWalk
+		}
+
+		repos[n] = name
+		n++
+		return nil
+	})
+
+	switch err {
+	case errFinishedWalk:
+		return n, nil
+	case nil:
+		return n, io.EOF
+	default:
+		return 0, err
+	}
+}
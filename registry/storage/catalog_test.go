@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"golang.org/x/net/context"
+)
+
+func TestCatalog(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	reg := NewRegistryWithDriver(driver, nil)
+
+	repos := make([]string, 10)
+	n, err := reg.Repositories(ctx, repos, "")
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF listing an empty registry: %v", err)
+	}
+
+	if n != 0 {
+		t.Fatalf("unexpected repositories in empty registry: %v", repos[:n])
+	}
+
+	// "foo/bar" is nested below "foo" and must still sort after "foo-baz".
+	names := []string{"foo/bar", "foo", "bar", "foo-baz", "baz/qux/quux"}
+	for _, name := range names {
+		p, err := defaultPathMapper.path(manifestTagCurrentPathSpec{name: name, tag: "latest"})
+		if err != nil {
+			t.Fatalf("unexpected error mapping path: %v", err)
+		}
+
+		if err := driver.PutContent(p, []byte("sha256:abc")); err != nil {
+			t.Fatalf("unexpected error writing tag link: %v", err)
+		}
+	}
+
+	expected := []string{"bar", "baz/qux/quux", "foo", "foo-baz", "foo/bar"}
+
+	n, err = reg.Repositories(ctx, repos, "")
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF listing the full catalog: %v", err)
+	}
+
+	if !reflect.DeepEqual(repos[:n], expected) {
+		t.Fatalf("unexpected catalog: %v != %v", repos[:n], expected)
+	}
+
+	// Page through the catalog two at a time.
+	var (
+		page = make([]string, 2)
+		last string
+		all  []string
+	)
+
+	for {
+		n, err := reg.Repositories(ctx, page, last)
+		if err != nil && err != io.EOF {
+			t.Fatalf("unexpected error listing catalog: %v", err)
+		}
+
+		all = append(all, page[:n]...)
+		if err == io.EOF {
+			break
+		}
+
+		if n != len(page) {
+			t.Fatalf("short page without io.EOF: %v", page[:n])
+		}
+
+		last = page[n-1]
+	}
+
+	if !reflect.DeepEqual(all, expected) {
+		t.Fatalf("unexpected paginated catalog: %v != %v", all, expected)
+	}
+
+	n, err = reg.Repositories(ctx, repos, "foo-baz")
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF at end of catalog: %v", err)
+	}
+
+	if !reflect.DeepEqual(repos[:n], []string{"foo/bar"}) {
+		t.Fatalf("unexpected catalog after last: %v", repos[:n])
+	}
+
+	if _, err := reg.Repositories(ctx, nil, ""); err == nil {
+		t.Fatalf("expected error listing into an empty slice")
+	}
+}
+
+// listingDriver records the directories listed on the wrapped driver.
+type listingDriver struct {
+	driver.StorageDriver
+	listed map[string]bool
+}
+
+func (d *listingDriver) List(path string) ([]string, error) {
+	d.listed[path] = true
+	return d.StorageDriver.List(path)
+}
+
+func TestCatalogWalk(t *testing.T) {
+	ctx := context.Background()
+	driver := &listingDriver{StorageDriver: inmemory.New()}
+	reg := NewRegistryWithDriver(driver, nil)
+
+	for _, name := range []string{"bar/baz", "foo", "foo/bar", "qux/quux"} {
+		p, err := defaultPathMapper.path(manifestTagCurrentPathSpec{name: name, tag: "latest"})
+		if err != nil {
+			t.Fatalf("unexpected error mapping path: %v", err)
+		}
+
+		if err := driver.PutContent(p, []byte("sha256:abc")); err != nil {
+			t.Fatalf("unexpected error writing tag link: %v", err)
+		}
+	}
+
+	root, err := defaultPathMapper.path(repositoriesRootPathSpec{})
+	if err != nil {
+		t.Fatalf("unexpected error mapping path: %v", err)
+	}
+
+	for _, tc := range []struct {
+		last      string
+		size      int
+		expected  []string
+		listed    []string
+		notListed []string
+	}{
+		// The walk stops once the page is full and another repository
+		// was found.
+		{"", 1, []string{"bar/baz"}, []string{"bar/baz", "foo"}, []string{"foo/bar", "qux/quux"}},
+		// Directories holding repositories up to last are not entered.
+		{"foo", 10, []string{"foo/bar", "qux/quux"}, []string{"foo/bar", "qux/quux"}, []string{"bar/baz"}},
+	} {
+		driver.listed = make(map[string]bool)
+		repos := make([]string, tc.size)
+		n, err := reg.Repositories(ctx, repos, tc.last)
+		if err != nil && err != io.EOF {
+			t.Fatalf("unexpected error listing catalog: %v", err)
+		}
+
+		if !reflect.DeepEqual(repos[:n], tc.expected) {
+			t.Fatalf("unexpected catalog after %q: %v != %v", tc.last, repos[:n], tc.expected)
+		}
+
+		for _, name := range tc.listed {
+			if !driver.listed[root+"/"+name] {
+				t.Fatalf("expected %q to be listed after %q", name, tc.last)
+			}
+		}
+
+		for _, name := range tc.notListed {
+			if driver.listed[root+"/"+name] {
+				t.Fatalf("unexpected listing of %q after %q", name, tc.last)
+			}
+		}
+	}
+}
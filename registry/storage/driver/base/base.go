@@ -39,6 +39,7 @@ package base
 
 import (
 	"io"
+	"time"
 
 	"github.com/docker/distribution/context"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
@@ -59,7 +60,11 @@ func (base *Base) GetContent(path string) ([]byte, error) {
 		return nil, storagedriver.InvalidPathError{Path: path}
 	}
 
-	return base.StorageDriver.GetContent(path)
+	start := time.Now()
+	content, err := base.StorageDriver.GetContent(path)
+	base.observe("GetContent", start, err)
+
+	return content, err
 }
 
 // PutContent wraps PutContent of underlying storage driver.
@@ -71,7 +76,11 @@ func (base *Base) PutContent(path string, content []byte) error {
 		return storagedriver.InvalidPathError{Path: path}
 	}
 
-	return base.StorageDriver.PutContent(path, content)
+	start := time.Now()
+	err := base.StorageDriver.PutContent(path, content)
+	base.observe("PutContent", start, err)
+
+	return err
 }
 
 // ReadStream wraps ReadStream of underlying storage driver.
@@ -87,7 +96,11 @@ func (base *Base) ReadStream(path string, offset int64) (io.ReadCloser, error) {
 		return nil, storagedriver.InvalidPathError{Path: path}
 	}
 
-	return base.StorageDriver.ReadStream(path, offset)
+	start := time.Now()
+	rc, err := base.StorageDriver.ReadStream(path, offset)
+	base.observe("ReadStream", start, err)
+
+	return rc, err
 }
 
 // WriteStream wraps WriteStream of underlying storage driver.
@@ -103,7 +116,11 @@ func (base *Base) WriteStream(path string, offset int64, reader io.Reader) (nn i
 		return 0, storagedriver.InvalidPathError{Path: path}
 	}
 
-	return base.StorageDriver.WriteStream(path, offset, reader)
+	start := time.Now()
+	nn, err = base.StorageDriver.WriteStream(path, offset, reader)
+	base.observe("WriteStream", start, err)
+
+	return nn, err
 }
 
 // Stat wraps Stat of underlying storage driver.
@@ -115,7 +132,11 @@ func (base *Base) Stat(path string) (storagedriver.FileInfo, error) {
 		return nil, storagedriver.InvalidPathError{Path: path}
 	}
 
-	return base.StorageDriver.Stat(path)
+	start := time.Now()
+	fi, err := base.StorageDriver.Stat(path)
+	base.observe("Stat", start, err)
+
+	return fi, err
 }
 
 // List wraps List of underlying storage driver.
@@ -127,7 +148,11 @@ func (base *Base) List(path string) ([]string, error) {
 		return nil, storagedriver.InvalidPathError{Path: path}
 	}
 
-	return base.StorageDriver.List(path)
+	start := time.Now()
+	entries, err := base.StorageDriver.List(path)
+	base.observe("List", start, err)
+
+	return entries, err
 }
 
 // Move wraps Move of underlying storage driver.
@@ -141,7 +166,11 @@ func (base *Base) Move(sourcePath string, destPath string) error {
 		return storagedriver.InvalidPathError{Path: destPath}
 	}
 
-	return base.StorageDriver.Move(sourcePath, destPath)
+	start := time.Now()
+	err := base.StorageDriver.Move(sourcePath, destPath)
+	base.observe("Move", start, err)
+
+	return err
 }
 
 // Delete wraps Delete of underlying storage driver.
@@ -153,7 +182,11 @@ func (base *Base) Delete(path string) error {
 		return storagedriver.InvalidPathError{Path: path}
 	}
 
-	return base.StorageDriver.Delete(path)
+	start := time.Now()
+	err := base.StorageDriver.Delete(path)
+	base.observe("Delete", start, err)
+
+	return err
 }
 
 // URLFor wraps URLFor of underlying storage driver.
@@ -165,5 +198,9 @@ func (base *Base) URLFor(path string, options map[string]interface{}) (string, e
 		return "", storagedriver.InvalidPathError{Path: path}
 	}
 
-	return base.StorageDriver.URLFor(path, options)
+	start := time.Now()
+	url, err := base.StorageDriver.URLFor(path, options)
+	base.observe("URLFor", start, err)
+
+	return url, err
 }
@@ -0,0 +1,66 @@
+package base
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution/metrics"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+var (
+	// storageActionDuration tracks the latency of the calls to the storage
+	// drivers, by driver and method.
+	storageActionDuration = metrics.NewHistogram("registry_storage_action_seconds",
+		"The latency of storage driver calls.", metrics.DefaultBuckets, "driver", "action")
+
+	// storageActionErrors counts the calls to the storage drivers that
+	// failed, by driver and method.
+	storageActionErrors = metrics.NewCounter("registry_storage_errors_total",
+		"The number of failed storage driver calls.", "driver", "action")
+)
+
+func init() {
+	metrics.Register(storageActionDuration)
+	metrics.Register(storageActionErrors)
+}
+
+// namer is implemented by the drivers reporting a human-readable name,
+// useful in metrics and logging. By convention, this is the registration
+// name of the driver.
+type namer interface {
+	Name() string
+}
+
+// DriverName returns the name of driver, if it reports one through a Name
+// method, or its type otherwise.
+func DriverName(driver storagedriver.StorageDriver) string {
+	if namer, ok := driver.(namer); ok {
+		return namer.Name()
+	}
+	return fmt.Sprintf("%T", driver)
+}
+
+// Name returns the name of the underlying driver, as returned by DriverName.
+func (base *Base) Name() string {
+	return DriverName(base.StorageDriver)
+}
+
+// observe records the duration of the call to action of the underlying
+// driver, started at start, and whether it failed.
+func (base *Base) observe(action string, start time.Time, err error) {
+	driverName := base.Name()
+	storageActionDuration.Observe(time.Since(start).Seconds(), driverName, action)
+
+	if err == nil || err == storagedriver.ErrUnsupportedMethod {
+		return
+	}
+
+	// Missing paths are an expected outcome, such as when checking for the
+	// existence of a layer, rather than a failure of the driver.
+	if _, ok := err.(storagedriver.PathNotFoundError); ok {
+		return
+	}
+
+	storageActionErrors.Inc(driverName, action)
+}
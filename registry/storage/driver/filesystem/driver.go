@@ -71,6 +71,10 @@ func New(rootDirectory string) *Driver {
 
 // Implement the storagedriver.StorageDriver interface
 
+func (d *driver) Name() string {
+	return driverName
+}
+
 // GetContent retrieves the content stored at "path" as a []byte.
 func (d *driver) GetContent(path string) ([]byte, error) {
 	rc, err := d.ReadStream(path, 0)
@@ -0,0 +1,184 @@
+package gcs
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTokenURI is the OAuth2 token endpoint used when the key file
+	// does not name one.
+	defaultTokenURI = "https://accounts.google.com/o/oauth2/token"
+
+	// storageScope is the OAuth2 scope granting read and write access to
+	// the bucket.
+	storageScope = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+// serviceAccount holds the credentials of a Google service account, as found
+// in the JSON key file downloaded from the developers console.
+type serviceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+// loadServiceAccount reads and parses the JSON key file at filename.
+func loadServiceAccount(filename string) (*serviceAccount, error) {
+	p, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var sa serviceAccount
+	if err := json.Unmarshal(p, &sa); err != nil {
+		return nil, fmt.Errorf("invalid key file %q: %v", filename, err)
+	}
+
+	if sa.ClientEmail == "" {
+		return nil, fmt.Errorf("invalid key file %q: no client_email", filename)
+	}
+
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("invalid key file %q: no PEM encoded private_key", filename)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		// Older key files hold PKCS#1 encoded keys.
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key file %q: %v", filename, err)
+		}
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid key file %q: private_key is not an RSA key", filename)
+	}
+	sa.key = rsaKey
+
+	if sa.TokenURI == "" {
+		sa.TokenURI = defaultTokenURI
+	}
+
+	return &sa, nil
+}
+
+// sign returns the RSA SHA256 signature of p with the key of the account.
+func (sa *serviceAccount) sign(p []byte) ([]byte, error) {
+	sum := sha256.Sum256(p)
+	return rsa.SignPKCS1v15(rand.Reader, sa.key, crypto.SHA256, sum[:])
+}
+
+// tokenSource fetches OAuth2 access tokens for a service account using the
+// JWT bearer grant, caching each token until shortly before it expires.
+type tokenSource struct {
+	account *serviceAccount
+	client  *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// Token returns a valid access token, fetching a new one if needed.
+func (ts *tokenSource) Token() (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.token != "" && time.Now().Before(ts.expires) {
+		return ts.token, nil
+	}
+
+	assertion, err := ts.assertion(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := ts.client.PostForm(ts.account.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("gcs: unable to fetch access token: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var tr struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", err
+	}
+
+	if tr.AccessToken == "" {
+		return "", fmt.Errorf("gcs: no access token in token response")
+	}
+
+	// Renew a minute early so that requests in flight do not use an
+	// expired token.
+	ts.token = tr.AccessToken
+	ts.expires = time.Now().Add(time.Duration(tr.ExpiresIn)*time.Second - time.Minute)
+
+	return ts.token, nil
+}
+
+// assertion returns the signed JWT exchanged for an access token.
+func (ts *tokenSource) assertion(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   ts.account.ClientEmail,
+		"scope": storageScope,
+		"aud":   ts.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64URLEncode(header) + "." + base64URLEncode(claims)
+
+	signature, err := ts.account.sign([]byte(payload))
+	if err != nil {
+		return "", err
+	}
+
+	return payload + "." + base64URLEncode(signature), nil
+}
+
+// base64URLEncode encodes b with the url base64 encoding, without the
+// trailing '=' characters, as JSON web tokens require.
+func base64URLEncode(b []byte) string {
+	return strings.TrimRight(base64.URLEncoding.EncodeToString(b), "=")
+}
@@ -0,0 +1,891 @@
+// Package gcs provides a storagedriver.StorageDriver implementation to
+// store blobs in Google Cloud Storage.
+//
+// The driver talks to the JSON API of Google Cloud Storage directly,
+// authenticating with the key of a service account. Without a key file,
+// requests are sent unauthenticated, which is only useful against public
+// buckets or a local emulator.
+//
+// Streams are written with resumable uploads. Appending to an object uploads
+// the new data to a temporary object, which is then composed onto the end of
+// the existing one, so that resuming a layer upload does not transfer the
+// data already written again. Writes at any other offset rewrite the object.
+//
+// Because Cloud Storage is a key, value store the Stat call does not support
+// last modification time for directories (directories are an abstraction for
+// key, value stores).
+package gcs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/base"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	"github.com/docker/distribution/registry/storage/driver/internal/driverutil"
+)
+
+const driverName = "gcs"
+
+// defaultEndpoint serves both the JSON API and the signed URLs.
+const defaultEndpoint = "https://storage.googleapis.com"
+
+// minChunkSize is the granularity of resumable uploads: every chunk but the
+// last must be a multiple of 256KiB.
+const minChunkSize = 256 << 10
+
+const defaultChunkSize = 64 * minChunkSize
+
+// maxComponents is the largest number of components a composite object may
+// have. Objects reaching it are rewritten rather than appended to.
+const maxComponents = 1024
+
+// listMax is the largest amount of objects requested in a single list call
+const listMax = 1000
+
+// statusResumeIncomplete is the status of resumable upload responses that
+// have not received all the data of the object yet. It is the 308 Permanent
+// Redirect of later HTTP revisions, unknown to older versions of net/http.
+const statusResumeIncomplete = 308
+
+// DriverParameters A struct that encapsulates all of the driver parameters after all values have been set
+type DriverParameters struct {
+	Bucket        string
+	KeyFile       string
+	Endpoint      string
+	ChunkSize     int64
+	RootDirectory string
+}
+
+func init() {
+	factory.Register(driverName, &gcsDriverFactory{})
+}
+
+// gcsDriverFactory implements the factory.StorageDriverFactory interface
+type gcsDriverFactory struct{}
+
+func (factory *gcsDriverFactory) Create(parameters map[string]interface{}) (storagedriver.StorageDriver, error) {
+	return FromParameters(parameters)
+}
+
+type driver struct {
+	client        *http.Client
+	endpoint      string
+	bucket        string
+	chunkSize     int64
+	rootDirectory string
+
+	// account and tokens are nil when requests are sent unauthenticated.
+	account *serviceAccount
+	tokens  *tokenSource
+}
+
+type baseEmbed struct {
+	base.Base
+}
+
+// Driver is a storagedriver.StorageDriver implementation backed by Google
+// Cloud Storage. Objects are stored at absolute keys in the provided bucket.
+type Driver struct {
+	baseEmbed
+}
+
+// FromParameters constructs a new Driver with a given parameters map
+// Required parameters:
+// - bucket
+// Optional parameters:
+// - keyfile
+// - endpoint
+// - chunksize
+// - rootdirectory
+func FromParameters(parameters map[string]interface{}) (*Driver, error) {
+	bucket, ok := parameters["bucket"]
+	if !ok || fmt.Sprint(bucket) == "" {
+		return nil, fmt.Errorf("No bucket parameter provided")
+	}
+
+	keyFile, ok := parameters["keyfile"]
+	if !ok {
+		keyFile = ""
+	}
+
+	endpoint, ok := parameters["endpoint"]
+	if !ok || fmt.Sprint(endpoint) == "" {
+		endpoint = defaultEndpoint
+	}
+
+	chunkSize := int64(defaultChunkSize)
+	chunkSizeParam, ok := parameters["chunksize"]
+	if ok {
+		switch v := chunkSizeParam.(type) {
+		case int:
+			chunkSize = int64(v)
+		case int64:
+			chunkSize = v
+		default:
+			return nil, fmt.Errorf("The chunksize parameter should be a number")
+		}
+
+		if chunkSize < minChunkSize || chunkSize%minChunkSize != 0 {
+			return nil, fmt.Errorf("The chunksize parameter should be a multiple of %d", minChunkSize)
+		}
+	}
+
+	rootDirectory, ok := parameters["rootdirectory"]
+	if !ok {
+		rootDirectory = ""
+	}
+
+	params := DriverParameters{
+		fmt.Sprint(bucket),
+		fmt.Sprint(keyFile),
+		fmt.Sprint(endpoint),
+		chunkSize,
+		fmt.Sprint(rootDirectory),
+	}
+
+	return New(params)
+}
+
+// New constructs a new Driver with the given service account key file, bucket
+// and endpoint.
+func New(params DriverParameters) (*Driver, error) {
+	if params.Endpoint == "" {
+		params.Endpoint = defaultEndpoint
+	}
+
+	if params.ChunkSize == 0 {
+		params.ChunkSize = defaultChunkSize
+	}
+
+	d := &driver{
+		client:        http.DefaultClient,
+		endpoint:      strings.TrimRight(params.Endpoint, "/"),
+		bucket:        params.Bucket,
+		chunkSize:     params.ChunkSize,
+		rootDirectory: params.RootDirectory,
+	}
+
+	if params.KeyFile != "" {
+		account, err := loadServiceAccount(params.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		d.account = account
+		d.tokens = &tokenSource{account: account, client: d.client}
+	}
+
+	// Validate that the given credentials have at least read permissions in the
+	// given bucket scope.
+	if _, err := d.list(d.objectName("/"), "", "", 1); err != nil {
+		return nil, err
+	}
+
+	return &Driver{
+		baseEmbed: baseEmbed{
+			Base: base.Base{
+				StorageDriver: d,
+			},
+		},
+	}, nil
+}
+
+// Implement the storagedriver.StorageDriver interface
+
+func (d *driver) Name() string {
+	return driverName
+}
+
+// GetContent retrieves the content stored at "path" as a []byte.
+func (d *driver) GetContent(path string) ([]byte, error) {
+	rc, err := d.ReadStream(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
+}
+
+// PutContent stores the []byte content at a location designated by "path".
+func (d *driver) PutContent(path string, contents []byte) error {
+	u := d.uploadURL(url.Values{
+		"uploadType": {"media"},
+		"name":       {d.objectName(path)},
+	})
+
+	req, err := http.NewRequest("POST", u, bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := d.do(req)
+	if err != nil {
+		return parseError(path, err)
+	}
+	driverutil.Drain(resp)
+
+	return nil
+}
+
+// ReadStream retrieves an io.ReadCloser for the content stored at "path" with a
+// given byte offset.
+func (d *driver) ReadStream(path string, offset int64) (io.ReadCloser, error) {
+	rc, err := d.readObject(d.objectName(path), offset)
+	if err != nil {
+		return nil, parseError(path, err)
+	}
+
+	return rc, nil
+}
+
+// WriteStream stores the contents of the provided io.ReadCloser at a
+// location designated by the given path. The driver will know it has
+// received the full contents when the reader returns io.EOF. The number
+// of successfully READ bytes will be returned, even if an error is
+// returned. May be used to resume writing a stream by providing a nonzero
+// offset. Offsets past the current size will write from the position
+// beyond the end of the file, filling the gap with zeros.
+func (d *driver) WriteStream(path string, offset int64, reader io.Reader) (totalRead int64, err error) {
+	name := d.objectName(path)
+
+	if offset == 0 {
+		nn, err := d.upload(name, reader)
+		return nn, parseError(path, err)
+	}
+
+	obj, err := d.object(name)
+	if err != nil {
+		if !isNotFound(err) {
+			return 0, err
+		}
+		obj = &object{Name: name}
+	}
+
+	if offset == obj.Size && obj.Size > 0 && obj.ComponentCount < maxComponents-1 {
+		return d.append(path, name, reader)
+	}
+
+	return d.rewrite(path, obj, offset, reader)
+}
+
+// append uploads the contents of reader to a temporary object and composes it
+// onto the end of the object name.
+func (d *driver) append(path, name string, reader io.Reader) (int64, error) {
+	tmp, err := temporaryName(name)
+	if err != nil {
+		return 0, err
+	}
+
+	nn, err := d.upload(tmp, reader)
+	if err != nil {
+		return nn, parseError(path, err)
+	}
+	defer d.deleteObject(tmp)
+
+	if nn == 0 {
+		return 0, nil
+	}
+
+	if err := d.compose(name, name, tmp); err != nil {
+		return 0, parseError(path, err)
+	}
+
+	return nn, nil
+}
+
+// rewrite uploads obj again with the contents of reader written at offset,
+// keeping the existing data before and after them. Any gap between the end of
+// obj and offset is filled with zeros.
+func (d *driver) rewrite(path string, obj *object, offset int64, reader io.Reader) (int64, error) {
+	var readers []io.Reader
+
+	if keep := driverutil.Min(offset, obj.Size); keep > 0 {
+		head, err := d.readObject(obj.Name, 0)
+		if err != nil {
+			return 0, parseError(path, err)
+		}
+		defer head.Close()
+
+		readers = append(readers, io.LimitReader(head, keep))
+	}
+
+	if offset > obj.Size {
+		readers = append(readers, io.LimitReader(driverutil.ZeroReader{}, offset-obj.Size))
+	}
+
+	counter := &driverutil.CountingReader{Reader: reader}
+	readers = append(readers, counter)
+
+	// The tail of obj not overwritten by reader can only be located once
+	// reader is exhausted.
+	tail := &driverutil.LazyReader{Open: func() (io.ReadCloser, error) {
+		start := offset + counter.N
+		if start >= obj.Size {
+			return ioutil.NopCloser(bytes.NewReader(nil)), nil
+		}
+		return d.readObject(obj.Name, start)
+	}}
+	defer tail.Close()
+	readers = append(readers, tail)
+
+	if _, err := d.upload(obj.Name, io.MultiReader(readers...)); err != nil {
+		return counter.N, parseError(path, err)
+	}
+
+	return counter.N, nil
+}
+
+// Stat retrieves the FileInfo for the given path, including the current size
+// in bytes and the creation time.
+func (d *driver) Stat(path string) (storagedriver.FileInfo, error) {
+	fi := storagedriver.FileInfoFields{
+		Path: path,
+	}
+
+	obj, err := d.object(d.objectName(path))
+	switch {
+	case err == nil:
+		fi.Size = obj.Size
+		fi.ModTime = obj.Updated
+	case isNotFound(err):
+		lr, err := d.list(d.objectName(path)+"/", "", "", 1)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(lr.Items) == 0 {
+			return nil, storagedriver.PathNotFoundError{Path: path}
+		}
+		fi.IsDir = true
+	default:
+		return nil, err
+	}
+
+	return storagedriver.FileInfoInternal{FileInfoFields: fi}, nil
+}
+
+// List returns a list of the objects that are direct descendants of the given path.
+func (d *driver) List(path string) ([]string, error) {
+	prefix := d.objectName(path)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	files := []string{}
+	directories := []string{}
+
+	pageToken := ""
+	for {
+		lr, err := d.list(prefix, "/", pageToken, listMax)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range lr.Items {
+			files = append(files, d.keyToPath(item.Name))
+		}
+
+		for _, p := range lr.Prefixes {
+			directories = append(directories, d.keyToPath(strings.TrimSuffix(p, "/")))
+		}
+
+		if lr.NextPageToken == "" {
+			break
+		}
+		pageToken = lr.NextPageToken
+	}
+
+	if path != "/" && len(files) == 0 && len(directories) == 0 {
+		return nil, storagedriver.PathNotFoundError{Path: path}
+	}
+
+	return append(files, directories...), nil
+}
+
+// Move moves an object stored at sourcePath to destPath, removing the original
+// object.
+func (d *driver) Move(sourcePath string, destPath string) error {
+	source, dest := d.objectName(sourcePath), d.objectName(destPath)
+
+	req, err := http.NewRequest("POST", d.objectURL(source)+"/copyTo/b/"+driverutil.Escape(d.bucket)+"/o/"+driverutil.Escape(dest), strings.NewReader("{}"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.do(req)
+	if err != nil {
+		return parseError(sourcePath, err)
+	}
+	driverutil.Drain(resp)
+
+	return parseError(sourcePath, d.deleteObject(source))
+}
+
+// Delete recursively deletes all objects stored at "path" and its subpaths.
+func (d *driver) Delete(path string) error {
+	name := d.objectName(path)
+
+	var names []string
+	if _, err := d.object(name); err == nil {
+		names = append(names, name)
+	} else if !isNotFound(err) {
+		return err
+	}
+
+	// Collect all children before deleting, so that deletions do not
+	// invalidate the page tokens.
+	pageToken := ""
+	for {
+		lr, err := d.list(name+"/", "", pageToken, listMax)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range lr.Items {
+			names = append(names, item.Name)
+		}
+
+		if lr.NextPageToken == "" {
+			break
+		}
+		pageToken = lr.NextPageToken
+	}
+
+	if len(names) == 0 {
+		return storagedriver.PathNotFoundError{Path: path}
+	}
+
+	for _, name := range names {
+		if err := d.deleteObject(name); err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// URLFor returns a URL which may be used to retrieve the content stored at the given path.
+// May return an UnsupportedMethodErr in certain StorageDriver implementations.
+func (d *driver) URLFor(path string, options map[string]interface{}) (string, error) {
+	if d.account == nil {
+		// Signing requires the key of a service account.
+		return "", storagedriver.ErrUnsupportedMethod
+	}
+
+	methodString := "GET"
+	method, ok := options["method"]
+	if ok {
+		methodString, ok = method.(string)
+		if !ok || (methodString != "GET" && methodString != "HEAD") {
+			return "", storagedriver.ErrUnsupportedMethod
+		}
+	}
+
+	expiresTime := time.Now().Add(20 * time.Minute)
+	expires, ok := options["expiry"]
+	if ok {
+		et, ok := expires.(time.Time)
+		if ok {
+			expiresTime = et
+		}
+	}
+
+	resource := "/" + d.bucket + "/" + driverutil.EscapePath(d.objectName(path))
+	expiry := strconv.FormatInt(expiresTime.Unix(), 10)
+
+	signature, err := d.account.sign([]byte(methodString + "\n\n\n" + expiry + "\n" + resource))
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"GoogleAccessId": {d.account.ClientEmail},
+		"Expires":        {expiry},
+		"Signature":      {base64.StdEncoding.EncodeToString(signature)},
+	}
+
+	return d.endpoint + resource + "?" + query.Encode(), nil
+}
+
+func (d *driver) objectName(path string) string {
+	return strings.TrimLeft(strings.TrimRight(d.rootDirectory, "/")+path, "/")
+}
+
+// keyToPath returns the storage driver path of the object name.
+func (d *driver) keyToPath(name string) string {
+	return "/" + strings.TrimPrefix(name, d.objectName("/"))
+}
+
+// GCSBucketKey returns the object name in the bucket for the given storage
+// driver path.
+func (d *Driver) GCSBucketKey(path string) string {
+	return d.StorageDriver.(*driver).objectName(path)
+}
+
+// object is the metadata of an object, as returned by the JSON API.
+type object struct {
+	Name           string    `json:"name"`
+	Size           int64     `json:"size,string"`
+	Updated        time.Time `json:"updated"`
+	ComponentCount int       `json:"componentCount"`
+}
+
+// listResponse is a page of the listing of the objects in the bucket.
+type listResponse struct {
+	Items         []object `json:"items"`
+	Prefixes      []string `json:"prefixes"`
+	NextPageToken string   `json:"nextPageToken"`
+}
+
+// object returns the metadata of the object name.
+func (d *driver) object(name string) (*object, error) {
+	req, err := http.NewRequest("GET", d.objectURL(name), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var obj object
+	if err := d.doJSON(req, &obj); err != nil {
+		return nil, err
+	}
+
+	return &obj, nil
+}
+
+// readObject returns the content of the object name, starting at offset.
+// Reading at or past the end of the object yields no data.
+func (d *driver) readObject(name string, offset int64) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", d.objectURL(name)+"?alt=media", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+
+	resp, err := d.do(req)
+	if err != nil {
+		if apiErr, ok := err.(*apiError); ok && apiErr.Code == http.StatusRequestedRangeNotSatisfiable {
+			return ioutil.NopCloser(bytes.NewReader(nil)), nil
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusPartialContent && offset > 0 {
+		// The range was ignored, skip to the offset.
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, offset); err != nil && err != io.EOF {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+
+	return resp.Body, nil
+}
+
+// list returns a page of the objects whose name starts with prefix. With a
+// delimiter, objects below the next delimiter are rolled up into prefixes.
+func (d *driver) list(prefix, delimiter, pageToken string, maxResults int) (*listResponse, error) {
+	query := url.Values{
+		"prefix":     {prefix},
+		"maxResults": {strconv.Itoa(maxResults)},
+	}
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	if pageToken != "" {
+		query.Set("pageToken", pageToken)
+	}
+
+	req, err := http.NewRequest("GET", d.endpoint+"/storage/v1/b/"+driverutil.Escape(d.bucket)+"/o?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var lr listResponse
+	if err := d.doJSON(req, &lr); err != nil {
+		return nil, err
+	}
+
+	return &lr, nil
+}
+
+// compose concatenates the sources into the object dest.
+func (d *driver) compose(dest string, sources ...string) error {
+	type sourceObject struct {
+		Name string `json:"name"`
+	}
+
+	var request struct {
+		SourceObjects []sourceObject  `json:"sourceObjects"`
+		Destination   json.RawMessage `json:"destination"`
+	}
+	for _, source := range sources {
+		request.SourceObjects = append(request.SourceObjects, sourceObject{Name: source})
+	}
+	request.Destination = json.RawMessage(`{"contentType":"application/octet-stream"}`)
+
+	p, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", d.objectURL(dest)+"/compose", bytes.NewReader(p))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return d.doJSON(req, nil)
+}
+
+func (d *driver) deleteObject(name string) error {
+	req, err := http.NewRequest("DELETE", d.objectURL(name), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.do(req)
+	if err != nil {
+		return err
+	}
+	driverutil.Drain(resp)
+
+	return nil
+}
+
+// upload writes the contents of reader to the object name with a resumable
+// upload, sending it in chunks of the configured size. The object only
+// replaces an existing one once the upload completes. The number of bytes
+// read from reader is returned.
+func (d *driver) upload(name string, reader io.Reader) (int64, error) {
+	session, err := d.startUpload(name)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		buf       = make([]byte, d.chunkSize)
+		pending   int   // bytes of buf not yet committed
+		committed int64 // bytes committed to the upload
+	)
+
+	for {
+		n, err := io.ReadFull(reader, buf[pending:])
+		pending += n
+
+		final := false
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			final = true
+		default:
+			return committed + int64(pending), err
+		}
+
+		n, done, err := d.putChunk(session, buf[:pending], committed, final)
+		if err != nil {
+			return committed + int64(pending), err
+		}
+
+		if done {
+			return committed + int64(pending), nil
+		}
+
+		// Keep what the server did not commit for the next chunk.
+		copy(buf, buf[n:pending])
+		pending -= n
+		committed += int64(n)
+	}
+}
+
+// startUpload initiates a resumable upload to the object name and returns the
+// URL of the upload session.
+func (d *driver) startUpload(name string) (string, error) {
+	p, err := json.Marshal(map[string]string{
+		"name":        name,
+		"contentType": "application/octet-stream",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", d.uploadURL(url.Values{"uploadType": {"resumable"}}), bytes.NewReader(p))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Upload-Content-Type", "application/octet-stream")
+
+	resp, err := d.do(req)
+	if err != nil {
+		return "", err
+	}
+	driverutil.Drain(resp)
+
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return "", fmt.Errorf("gcs: no upload session returned for %q", name)
+	}
+
+	return session, nil
+}
+
+// putChunk sends p to the upload session at offset. If final is true, p ends
+// the upload. The number of bytes of p committed by the server is returned,
+// along with whether the upload is complete.
+func (d *driver) putChunk(session string, p []byte, offset int64, final bool) (int, bool, error) {
+	req, err := http.NewRequest("PUT", session, bytes.NewReader(p))
+	if err != nil {
+		return 0, false, err
+	}
+
+	total := "*"
+	if final {
+		total = strconv.FormatInt(offset+int64(len(p)), 10)
+	}
+
+	if len(p) == 0 {
+		req.Header.Set("Content-Range", "bytes */"+total)
+	} else {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%s", offset, offset+int64(len(p))-1, total))
+	}
+
+	resp, err := d.do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	driverutil.Drain(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return len(p), true, nil
+	case statusResumeIncomplete:
+		// The Range header holds the bytes persisted so far, if any.
+		var persisted int64
+		if r := resp.Header.Get("Range"); r != "" {
+			var last int64
+			if _, err := fmt.Sscanf(r, "bytes=0-%d", &last); err != nil {
+				return 0, false, fmt.Errorf("gcs: invalid range %q in upload response", r)
+			}
+			persisted = last + 1
+		}
+
+		if persisted < offset || persisted > offset+int64(len(p)) {
+			return 0, false, fmt.Errorf("gcs: upload session lost data: %d bytes persisted, %d expected", persisted, offset)
+		}
+
+		return int(persisted - offset), false, nil
+	default:
+		return 0, false, fmt.Errorf("gcs: unexpected upload response: %s", resp.Status)
+	}
+}
+
+// do sends req, authenticating it with an access token if the driver has a
+// service account. Responses with an error status are returned as an
+// *apiError.
+func (d *driver) do(req *http.Request) (*http.Response, error) {
+	if d.tokens != nil {
+		token, err := d.tokens.Token()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, newAPIError(resp)
+	}
+
+	return resp, nil
+}
+
+// doJSON sends req and decodes the JSON response into v, if not nil.
+func (d *driver) doJSON(req *http.Request, v interface{}) error {
+	resp, err := d.do(req)
+	if err != nil {
+		return err
+	}
+	defer driverutil.Drain(resp)
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (d *driver) objectURL(name string) string {
+	return d.endpoint + "/storage/v1/b/" + driverutil.Escape(d.bucket) + "/o/" + driverutil.Escape(name)
+}
+
+func (d *driver) uploadURL(query url.Values) string {
+	return d.endpoint + "/upload/storage/v1/b/" + driverutil.Escape(d.bucket) + "/o?" + query.Encode()
+}
+
+// apiError is an error response of the JSON API.
+type apiError struct {
+	Code    int
+	Message string
+}
+
+func newAPIError(resp *http.Response) error {
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+
+	apiErr := &apiError{Code: resp.StatusCode, Message: resp.Status}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil && body.Error.Message != "" {
+		apiErr.Message = body.Error.Message
+	}
+
+	return apiErr
+}
+
+func (err *apiError) Error() string {
+	return fmt.Sprintf("gcs: %d %s", err.Code, err.Message)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.Code == http.StatusNotFound
+}
+
+func parseError(path string, err error) error {
+	if isNotFound(err) {
+		return storagedriver.PathNotFoundError{Path: path}
+	}
+
+	return err
+}
+
+// temporaryName returns a unique name for a temporary object next to name.
+func temporaryName(name string) (string, error) {
+	p := make([]byte, 8)
+	if _, err := rand.Read(p); err != nil {
+		return "", err
+	}
+
+	return name + ".tmp-" + hex.EncodeToString(p), nil
+}
@@ -0,0 +1,575 @@
+package gcs
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/testsuites"
+
+	"gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { check.TestingT(t) }
+
+const (
+	testBucket = "registry-test"
+	testToken  = "test-access-token"
+	testEmail  = "registry@test.iam.gserviceaccount.com"
+)
+
+func init() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	server := httptest.NewServer(newFakeGCS(testBucket, &key.PublicKey))
+
+	keyFile, err := writeKeyFile(key, server.URL+"/token")
+	if err != nil {
+		panic(err)
+	}
+
+	root, err := ioutil.TempDir("", "driver-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(root)
+
+	gcsDriverConstructor := func() (storagedriver.StorageDriver, error) {
+		return New(DriverParameters{
+			Bucket:        testBucket,
+			KeyFile:       keyFile,
+			Endpoint:      server.URL,
+			ChunkSize:     minChunkSize,
+			RootDirectory: root,
+		})
+	}
+
+	testsuites.RegisterInProcessSuite(gcsDriverConstructor, testsuites.NeverSkip)
+}
+
+// writeKeyFile writes a service account key file for key to a temporary file
+// and returns its name.
+func writeKeyFile(key *rsa.PrivateKey, tokenURI string) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": testEmail,
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenURI,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	f, err := ioutil.TempFile("", "gcs-key-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(p); err != nil {
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+func TestFromParameters(t *testing.T) {
+	for _, parameters := range []map[string]interface{}{
+		{},
+		{"bucket": ""},
+		{"bucket": testBucket, "chunksize": 1000},
+		{"bucket": testBucket, "chunksize": "large"},
+		{"bucket": testBucket, "keyfile": "/nonexistent/key.json"},
+	} {
+		if _, err := FromParameters(parameters); err == nil {
+			t.Fatalf("expected error for parameters %v", parameters)
+		}
+	}
+}
+
+// TestAppendComposes ensures that appending to an object composes the new
+// data onto it, without leaving temporary objects behind.
+func TestAppendComposes(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := newFakeGCS(testBucket, &key.PublicKey)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	d, err := New(DriverParameters{Bucket: testBucket, Endpoint: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	if _, err := d.WriteStream("/a/b", 0, strings.NewReader("hello, ")); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+
+	nn, err := d.WriteStream("/a/b", 7, strings.NewReader("world"))
+	if err != nil {
+		t.Fatalf("unexpected error appending: %v", err)
+	}
+	if nn != 5 {
+		t.Fatalf("unexpected number of bytes written: %d != 5", nn)
+	}
+
+	content, err := d.GetContent("/a/b")
+	if err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if string(content) != "hello, world" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if len(fake.objects) != 1 {
+		t.Fatalf("unexpected objects left in bucket: %d", len(fake.objects))
+	}
+	if c := fake.objects["a/b"].componentCount; c != 2 {
+		t.Fatalf("object was not composed: component count %d", c)
+	}
+
+	if _, err := d.URLFor("/a/b", nil); err != storagedriver.ErrUnsupportedMethod {
+		t.Fatalf("expected unsupported URLFor without a key file, got %v", err)
+	}
+}
+
+// fakeGCS implements the subset of the Cloud Storage JSON API used by the
+// driver, keeping a single bucket in memory.
+type fakeGCS struct {
+	bucket string
+	key    *rsa.PublicKey
+
+	mu       sync.Mutex
+	objects  map[string]*fakeObject
+	sessions map[string]*fakeSession
+	nextID   int
+}
+
+type fakeObject struct {
+	data           []byte
+	updated        time.Time
+	componentCount int
+}
+
+type fakeSession struct {
+	name string
+	data []byte
+}
+
+func newFakeGCS(bucket string, key *rsa.PublicKey) *fakeGCS {
+	return &fakeGCS{
+		bucket:   bucket,
+		key:      key,
+		objects:  make(map[string]*fakeObject),
+		sessions: make(map[string]*fakeSession),
+	}
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Object names are sent as escaped path segments, so the path must be
+	// split before unescaping.
+	segments := strings.Split(strings.TrimPrefix(escapedPath(r), "/"), "/")
+	for i, segment := range segments {
+		segments[i], _ = url.QueryUnescape(segment)
+	}
+
+	if r.URL.Path == "/token" {
+		f.token(w, r)
+		return
+	}
+
+	if r.URL.Query().Get("Signature") != "" {
+		f.signed(w, r)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "" && r.Header.Get("Authorization") != "Bearer "+testToken {
+		f.error(w, http.StatusUnauthorized, "Invalid Credentials")
+		return
+	}
+
+	switch {
+	case len(segments) == 5 && segments[0] == "storage" && segments[4] == "o" && r.Method == "GET":
+		f.list(w, r)
+	case len(segments) == 6 && segments[0] == "storage":
+		f.object(w, r, segments[5])
+	case len(segments) == 7 && segments[0] == "storage" && segments[6] == "compose" && r.Method == "POST":
+		f.compose(w, r, segments[5])
+	case len(segments) == 11 && segments[0] == "storage" && segments[6] == "copyTo" && r.Method == "POST":
+		f.copy(w, segments[5], segments[10])
+	case len(segments) == 6 && segments[0] == "upload" && r.Method == "POST":
+		f.startUpload(w, r)
+	case len(segments) == 6 && segments[0] == "upload" && r.Method == "PUT":
+		f.putChunk(w, r)
+	default:
+		f.error(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (f *fakeGCS) error(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"error":{"code":%d,"message":%q}}`, code, message)
+}
+
+func (f *fakeGCS) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeGCS) resource(name string, obj *fakeObject) map[string]interface{} {
+	return map[string]interface{}{
+		"name":           name,
+		"bucket":         f.bucket,
+		"size":           strconv.Itoa(len(obj.data)),
+		"updated":        obj.updated.Format(time.RFC3339Nano),
+		"componentCount": obj.componentCount,
+	}
+}
+
+// store replaces the object name with data. Must be called with mu held.
+func (f *fakeGCS) store(name string, data []byte, componentCount int) *fakeObject {
+	obj := &fakeObject{data: data, updated: time.Now(), componentCount: componentCount}
+	f.objects[name] = obj
+	return obj
+}
+
+func (f *fakeGCS) token(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+		f.error(w, http.StatusBadRequest, "invalid grant type")
+		return
+	}
+
+	parts := strings.Split(r.FormValue("assertion"), ".")
+	if len(parts) != 3 {
+		f.error(w, http.StatusBadRequest, "invalid assertion")
+		return
+	}
+
+	signature, err := base64.URLEncoding.DecodeString(parts[2] + strings.Repeat("=", (4-len(parts[2])%4)%4))
+	if err != nil || !f.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		f.error(w, http.StatusBadRequest, "invalid assertion signature")
+		return
+	}
+
+	f.writeJSON(w, map[string]interface{}{
+		"access_token": testToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+// escapedPath returns the path of the request as sent by the client, before
+// unescaping.
+func escapedPath(r *http.Request) string {
+	return strings.SplitN(r.RequestURI, "?", 2)[0]
+}
+
+func (f *fakeGCS) verify(p, signature []byte) bool {
+	sum := sha256.Sum256(p)
+	return rsa.VerifyPKCS1v15(f.key, crypto.SHA256, sum[:], signature) == nil
+}
+
+func (f *fakeGCS) signed(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	expires, err := strconv.ParseInt(query.Get("Expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		f.error(w, http.StatusBadRequest, "expired")
+		return
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(query.Get("Signature"))
+	if err != nil || query.Get("GoogleAccessId") != testEmail ||
+		!f.verify([]byte(r.Method+"\n\n\n"+query.Get("Expires")+"\n"+escapedPath(r)), signature) {
+		f.error(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/"+f.bucket+"/")
+
+	f.mu.Lock()
+	obj, ok := f.objects[name]
+	f.mu.Unlock()
+
+	if !ok {
+		f.error(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+	w.Write(obj.data)
+}
+
+func (f *fakeGCS) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+
+	maxResults, err := strconv.Atoi(query.Get("maxResults"))
+	if err != nil || maxResults <= 0 {
+		maxResults = listMax
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Entries are either object names or prefixes ending in the delimiter,
+	// paged through in order.
+	seen := make(map[string]bool)
+	var entries []string
+	for name := range f.objects {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		entry := name
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				entry = name[:len(prefix)+i+len(delimiter)]
+			}
+		}
+
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+	sort.Strings(entries)
+
+	start := 0
+	if token := query.Get("pageToken"); token != "" {
+		start = sort.SearchStrings(entries, token)
+	}
+
+	items := []interface{}{}
+	prefixes := []string{}
+	response := map[string]interface{}{}
+	for i := start; i < len(entries); i++ {
+		if i-start == maxResults {
+			response["nextPageToken"] = entries[i]
+			break
+		}
+
+		if obj, ok := f.objects[entries[i]]; ok {
+			items = append(items, f.resource(entries[i], obj))
+		} else {
+			prefixes = append(prefixes, entries[i])
+		}
+	}
+	response["items"] = items
+	response["prefixes"] = prefixes
+
+	f.writeJSON(w, response)
+}
+
+func (f *fakeGCS) object(w http.ResponseWriter, r *http.Request, name string) {
+	f.mu.Lock()
+	obj, ok := f.objects[name]
+	if ok && r.Method == "DELETE" {
+		delete(f.objects, name)
+	}
+	f.mu.Unlock()
+
+	if !ok {
+		f.error(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	switch {
+	case r.Method == "DELETE":
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "GET" && r.URL.Query().Get("alt") == "media":
+		var offset int
+		if rng := r.Header.Get("Range"); rng != "" {
+			fmt.Sscanf(rng, "bytes=%d-", &offset)
+			if offset >= len(obj.data) {
+				f.error(w, http.StatusRequestedRangeNotSatisfiable, "Requested range not satisfiable")
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(obj.data)-1, len(obj.data)))
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		w.Write(obj.data[offset:])
+	case r.Method == "GET":
+		f.writeJSON(w, f.resource(name, obj))
+	default:
+		f.error(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (f *fakeGCS) compose(w http.ResponseWriter, r *http.Request, dest string) {
+	var request struct {
+		SourceObjects []struct {
+			Name string `json:"name"`
+		} `json:"sourceObjects"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		f.error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var data []byte
+	var componentCount int
+	for _, source := range request.SourceObjects {
+		obj, ok := f.objects[source.Name]
+		if !ok {
+			f.error(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		data = append(data, obj.data...)
+		if obj.componentCount > 1 {
+			componentCount += obj.componentCount
+		} else {
+			componentCount++
+		}
+	}
+
+	if componentCount > maxComponents {
+		f.error(w, http.StatusBadRequest, "too many components")
+		return
+	}
+
+	f.writeJSON(w, f.resource(dest, f.store(dest, data, componentCount)))
+}
+
+func (f *fakeGCS) copy(w http.ResponseWriter, source, dest string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	obj, ok := f.objects[source]
+	if !ok {
+		f.error(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	f.writeJSON(w, f.resource(dest, f.store(dest, obj.data, obj.componentCount)))
+}
+
+func (f *fakeGCS) startUpload(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	switch query.Get("uploadType") {
+	case "media":
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			f.error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		f.mu.Lock()
+		obj := f.store(query.Get("name"), data, 0)
+		f.mu.Unlock()
+
+		f.writeJSON(w, f.resource(query.Get("name"), obj))
+	case "resumable":
+		var metadata struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil || metadata.Name == "" {
+			f.error(w, http.StatusBadRequest, "invalid object metadata")
+			return
+		}
+
+		f.mu.Lock()
+		f.nextID++
+		id := strconv.Itoa(f.nextID)
+		f.sessions[id] = &fakeSession{name: metadata.Name}
+		f.mu.Unlock()
+
+		w.Header().Set("Location", "http://"+r.Host+r.URL.Path+"?uploadType=resumable&upload_id="+id)
+		w.WriteHeader(http.StatusOK)
+	default:
+		f.error(w, http.StatusBadRequest, "unsupported upload type")
+	}
+}
+
+func (f *fakeGCS) putChunk(w http.ResponseWriter, r *http.Request) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		f.error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := r.URL.Query().Get("upload_id")
+	session, ok := f.sessions[id]
+	if !ok {
+		f.error(w, http.StatusNotFound, "No such upload")
+		return
+	}
+
+	var start, end int64
+	var total string
+	contentRange := r.Header.Get("Content-Range")
+	if strings.HasPrefix(contentRange, "bytes */") {
+		start, end = int64(len(session.data)), int64(len(session.data))-1
+		total = strings.TrimPrefix(contentRange, "bytes */")
+	} else if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%s", &start, &end, &total); err != nil {
+		f.error(w, http.StatusBadRequest, "invalid Content-Range")
+		return
+	}
+
+	if start != int64(len(session.data)) || end-start+1 != int64(len(data)) {
+		f.error(w, http.StatusBadRequest, "chunk does not continue the upload")
+		return
+	}
+
+	if total == "*" && len(data)%minChunkSize != 0 {
+		f.error(w, http.StatusBadRequest, "chunk size not a multiple of 256KiB")
+		return
+	}
+
+	session.data = append(session.data, data...)
+
+	if total == "*" {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(session.data)-1))
+		w.WriteHeader(statusResumeIncomplete)
+		return
+	}
+
+	if total != strconv.Itoa(len(session.data)) {
+		f.error(w, http.StatusBadRequest, "upload size mismatch")
+		return
+	}
+
+	delete(f.sessions, id)
+	f.writeJSON(w, f.resource(session.name, f.store(session.name, session.data, 0)))
+}
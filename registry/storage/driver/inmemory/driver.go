@@ -64,6 +64,10 @@ func New() *Driver {
 
 // Implement the storagedriver.StorageDriver interface.
 
+func (d *driver) Name() string {
+	return driverName
+}
+
 // GetContent retrieves the content stored at "path" as a []byte.
 func (d *driver) GetContent(path string) ([]byte, error) {
 	d.mutex.RLock()
@@ -0,0 +1,90 @@
+// Package driverutil provides helpers shared by the storage drivers talking
+// to object stores over HTTP.
+package driverutil
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Escape escapes s for use as a single segment of a URL path. Spaces are
+// escaped as %20 since a + is only a space in query strings.
+func Escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// EscapePath escapes the object name s for use in a URL path, keeping the
+// slashes separating its components.
+func EscapePath(s string) string {
+	parts := strings.Split(s, "/")
+	for i, part := range parts {
+		parts[i] = Escape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// Drain discards the rest of the response body and closes it, so that the
+// connection can be reused.
+func Drain(resp *http.Response) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// Min returns the smaller of a and b.
+func Min(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// ZeroReader is an infinite source of zeros.
+type ZeroReader struct{}
+
+func (ZeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// CountingReader counts in N the bytes read from the embedded reader.
+type CountingReader struct {
+	io.Reader
+	N int64
+}
+
+func (r *CountingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.N += int64(n)
+	return n, err
+}
+
+// LazyReader calls Open to open the underlying reader on the first read.
+type LazyReader struct {
+	Open func() (io.ReadCloser, error)
+	rc   io.ReadCloser
+}
+
+func (r *LazyReader) Read(p []byte) (int, error) {
+	if r.rc == nil {
+		rc, err := r.Open()
+		if err != nil {
+			return 0, err
+		}
+		r.rc = rc
+	}
+
+	return r.rc.Read(p)
+}
+
+// Close closes the underlying reader, if it was opened.
+func (r *LazyReader) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	return r.rc.Close()
+}
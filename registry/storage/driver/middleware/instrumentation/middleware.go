@@ -0,0 +1,229 @@
+// Package middleware - instrumentation wrapper for storage drivers, logging
+// and measuring every call made to the wrapped driver.
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/metrics"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/base"
+	storagemiddleware "github.com/docker/distribution/registry/storage/driver/middleware"
+)
+
+// defaultSlowThreshold is the duration after which a call is considered slow,
+// if none is configured.
+const defaultSlowThreshold = time.Second
+
+var (
+	// slowActions counts the calls that took longer than the slow threshold,
+	// by driver and method.
+	slowActions = metrics.NewCounter("registry_storage_slow_actions_total",
+		"The number of storage driver calls slower than the configured threshold.", "driver", "action")
+
+	// actionBytes tracks the amount of data transferred by the calls that
+	// read or write content, by driver and method.
+	actionBytes = metrics.NewHistogram("registry_storage_action_bytes",
+		"The size of the content read or written by storage driver calls.",
+		[]float64{1 << 10, 1 << 14, 1 << 18, 1 << 20, 1 << 22, 1 << 24, 1 << 26, 1 << 28, 1 << 30},
+		"driver", "action")
+)
+
+// instrumentedStorageMiddleware logs the duration of every call to the wrapped
+// storage driver, along with the paths and sizes involved. Calls slower than
+// the threshold are logged as warnings.
+type instrumentedStorageMiddleware struct {
+	storagedriver.StorageDriver
+	name          string
+	ctx           context.Context
+	slowThreshold time.Duration
+}
+
+var _ storagedriver.StorageDriver = &instrumentedStorageMiddleware{}
+
+// newInstrumentedStorageMiddleware constructs and returns a new
+// instrumentation middleware wrapping storageDriver.
+// Optional options: slowthreshold
+func newInstrumentedStorageMiddleware(storageDriver storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
+	slowThreshold := defaultSlowThreshold
+	if t, ok := options["slowthreshold"]; ok {
+		switch t := t.(type) {
+		case time.Duration:
+			slowThreshold = t
+		case string:
+			d, err := time.ParseDuration(t)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid slowthreshold: %s", err)
+			}
+			slowThreshold = d
+		default:
+			return nil, fmt.Errorf("slowthreshold must be a duration string")
+		}
+	}
+
+	if slowThreshold <= 0 {
+		return nil, fmt.Errorf("slowthreshold must be positive")
+	}
+
+	return &instrumentedStorageMiddleware{
+		StorageDriver: storageDriver,
+		name:          base.DriverName(storageDriver),
+		ctx:           context.Background(),
+		slowThreshold: slowThreshold,
+	}, nil
+}
+
+// Name returns the name of the underlying storage driver, which labels the
+// logs and metrics of its calls.
+func (im *instrumentedStorageMiddleware) Name() string {
+	return im.name
+}
+
+// GetContent wraps GetContent of the underlying storage driver.
+func (im *instrumentedStorageMiddleware) GetContent(path string) ([]byte, error) {
+	start := time.Now()
+	content, err := im.StorageDriver.GetContent(path)
+	im.done("GetContent", start, err, map[string]interface{}{
+		"storage.path": path,
+		"storage.size": len(content),
+	})
+	actionBytes.Observe(float64(len(content)), im.Name(), "GetContent")
+
+	return content, err
+}
+
+// PutContent wraps PutContent of the underlying storage driver.
+func (im *instrumentedStorageMiddleware) PutContent(path string, content []byte) error {
+	start := time.Now()
+	err := im.StorageDriver.PutContent(path, content)
+	im.done("PutContent", start, err, map[string]interface{}{
+		"storage.path": path,
+		"storage.size": len(content),
+	})
+	actionBytes.Observe(float64(len(content)), im.Name(), "PutContent")
+
+	return err
+}
+
+// ReadStream wraps ReadStream of the underlying storage driver. Only opening
+// the stream is measured.
+func (im *instrumentedStorageMiddleware) ReadStream(path string, offset int64) (io.ReadCloser, error) {
+	start := time.Now()
+	rc, err := im.StorageDriver.ReadStream(path, offset)
+	im.done("ReadStream", start, err, map[string]interface{}{
+		"storage.path":   path,
+		"storage.offset": offset,
+	})
+
+	return rc, err
+}
+
+// WriteStream wraps WriteStream of the underlying storage driver.
+func (im *instrumentedStorageMiddleware) WriteStream(path string, offset int64, reader io.Reader) (int64, error) {
+	start := time.Now()
+	nn, err := im.StorageDriver.WriteStream(path, offset, reader)
+	im.done("WriteStream", start, err, map[string]interface{}{
+		"storage.path":   path,
+		"storage.offset": offset,
+		"storage.size":   nn,
+	})
+	actionBytes.Observe(float64(nn), im.Name(), "WriteStream")
+
+	return nn, err
+}
+
+// Stat wraps Stat of the underlying storage driver.
+func (im *instrumentedStorageMiddleware) Stat(path string) (storagedriver.FileInfo, error) {
+	start := time.Now()
+	fi, err := im.StorageDriver.Stat(path)
+
+	fields := map[string]interface{}{
+		"storage.path": path,
+	}
+	if fi != nil {
+		fields["storage.size"] = fi.Size()
+	}
+	im.done("Stat", start, err, fields)
+
+	return fi, err
+}
+
+// List wraps List of the underlying storage driver.
+func (im *instrumentedStorageMiddleware) List(path string) ([]string, error) {
+	start := time.Now()
+	entries, err := im.StorageDriver.List(path)
+	im.done("List", start, err, map[string]interface{}{
+		"storage.path":    path,
+		"storage.entries": len(entries),
+	})
+
+	return entries, err
+}
+
+// Move wraps Move of the underlying storage driver.
+func (im *instrumentedStorageMiddleware) Move(sourcePath string, destPath string) error {
+	start := time.Now()
+	err := im.StorageDriver.Move(sourcePath, destPath)
+	im.done("Move", start, err, map[string]interface{}{
+		"storage.path":     sourcePath,
+		"storage.destpath": destPath,
+	})
+
+	return err
+}
+
+// Delete wraps Delete of the underlying storage driver.
+func (im *instrumentedStorageMiddleware) Delete(path string) error {
+	start := time.Now()
+	err := im.StorageDriver.Delete(path)
+	im.done("Delete", start, err, map[string]interface{}{
+		"storage.path": path,
+	})
+
+	return err
+}
+
+// URLFor wraps URLFor of the underlying storage driver.
+func (im *instrumentedStorageMiddleware) URLFor(path string, options map[string]interface{}) (string, error) {
+	start := time.Now()
+	url, err := im.StorageDriver.URLFor(path, options)
+	im.done("URLFor", start, err, map[string]interface{}{
+		"storage.path": path,
+	})
+
+	return url, err
+}
+
+// done logs the completion of the call to action, started at start. Calls
+// slower than the threshold are logged as warnings and counted.
+func (im *instrumentedStorageMiddleware) done(action string, start time.Time, err error, fields map[string]interface{}) {
+	duration := time.Since(start)
+
+	fields["storage.driver"] = im.Name()
+	fields["storage.action"] = action
+	fields["storage.duration"] = duration
+	if err != nil {
+		fields["storage.error"] = err
+	}
+
+	logger := context.GetLoggerWithFields(im.ctx, fields)
+
+	if duration >= im.slowThreshold {
+		slowActions.Inc(im.Name(), action)
+		logger.Warnf("slow storage driver call: %s", action)
+		return
+	}
+
+	logger.Debugf("storage driver call: %s", action)
+}
+
+// init registers the instrumentation storage middleware.
+func init() {
+	metrics.Register(slowActions)
+	metrics.Register(actionBytes)
+
+	storagemiddleware.Register("instrumentation", storagemiddleware.InitFunc(newInstrumentedStorageMiddleware))
+}
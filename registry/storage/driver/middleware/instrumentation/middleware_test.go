@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestInstrumentedStorageMiddleware(t *testing.T) {
+	driver, err := newInstrumentedStorageMiddleware(inmemory.New(), map[string]interface{}{
+		"slowthreshold": "1ns",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	slow := slowActions.Value("inmemory", "PutContent")
+	sizes := actionBytes.Count("inmemory", "GetContent")
+
+	content := []byte("instrumented content")
+	if err := driver.PutContent("/a/file", content); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+
+	p, err := driver.GetContent("/a/file")
+	if err != nil {
+		t.Fatalf("unexpected error getting content: %v", err)
+	}
+
+	if !bytes.Equal(p, content) {
+		t.Fatalf("unexpected content: %q != %q", p, content)
+	}
+
+	if _, err := driver.Stat("/a/missing"); err == nil {
+		t.Fatalf("expected error stating missing path")
+	} else if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		t.Fatalf("error not passed through: %v", err)
+	}
+
+	// Every call is slower than a nanosecond.
+	if v := slowActions.Value("inmemory", "PutContent"); v != slow+1 {
+		t.Fatalf("slow call not counted: %v != %v", v, slow+1)
+	}
+
+	if c := actionBytes.Count("inmemory", "GetContent"); c != sizes+1 {
+		t.Fatalf("content size not observed: %v != %v", c, sizes+1)
+	}
+}
+
+func TestInstrumentedStorageMiddlewareOptions(t *testing.T) {
+	driver, err := newInstrumentedStorageMiddleware(inmemory.New(), map[string]interface{}{
+		"slowthreshold": 2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	if threshold := driver.(*instrumentedStorageMiddleware).slowThreshold; threshold != 2*time.Second {
+		t.Fatalf("unexpected slow threshold: %v", threshold)
+	}
+
+	driver, err = newInstrumentedStorageMiddleware(inmemory.New(), map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("unexpected error creating middleware: %v", err)
+	}
+
+	if threshold := driver.(*instrumentedStorageMiddleware).slowThreshold; threshold != defaultSlowThreshold {
+		t.Fatalf("unexpected default slow threshold: %v", threshold)
+	}
+
+	for _, threshold := range []interface{}{"soon", "-1s", 10} {
+		if _, err := newInstrumentedStorageMiddleware(inmemory.New(), map[string]interface{}{
+			"slowthreshold": threshold,
+		}); err == nil {
+			t.Fatalf("expected error with slowthreshold %v", threshold)
+		}
+	}
+}
+
+// unnamedDriver hides the name of the wrapped driver, as out-of-tree drivers
+// may not report one.
+type unnamedDriver struct {
+	storagedriver.StorageDriver
+}
+
+func TestInstrumentedStorageMiddlewareName(t *testing.T) {
+	for wrapped, expected := range map[storagedriver.StorageDriver]string{
+		inmemory.New():                "inmemory",
+		unnamedDriver{inmemory.New()}: "middleware.unnamedDriver",
+	} {
+		driver, err := newInstrumentedStorageMiddleware(wrapped, map[string]interface{}{})
+		if err != nil {
+			t.Fatalf("unexpected error creating middleware: %v", err)
+		}
+
+		if name := driver.(*instrumentedStorageMiddleware).Name(); name != expected {
+			t.Fatalf("unexpected driver name: %q != %q", name, expected)
+		}
+	}
+}
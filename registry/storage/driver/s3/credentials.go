@@ -0,0 +1,217 @@
+package s3
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AdRoll/goamz/aws"
+)
+
+// instanceMetadataURL is the base URL of the EC2 instance metadata service.
+var instanceMetadataURL = "http://169.254.169.254/latest/meta-data/"
+
+// credentialsRefreshWindow is how long before their expiration credentials
+// are refreshed.
+const credentialsRefreshWindow = 5 * time.Minute
+
+// credentialsRetryInterval is how long to wait before retrying a failed
+// refresh, while the current credentials are still in use.
+const credentialsRetryInterval = 10 * time.Second
+
+// credentials are the AWS credentials used to sign requests. A zero
+// expiration means they never expire.
+type credentials struct {
+	AccessKey  string
+	SecretKey  string
+	Token      string
+	Expiration time.Time
+}
+
+// auth returns the credentials as an aws.Auth.
+func (c credentials) auth() aws.Auth {
+	return *aws.NewAuth(c.AccessKey, c.SecretKey, c.Token, c.Expiration)
+}
+
+// expiring reports whether the credentials must be refreshed at the given
+// time.
+func (c credentials) expiring(now time.Time) bool {
+	return !c.Expiration.IsZero() && now.Add(credentialsRefreshWindow).After(c.Expiration)
+}
+
+// credentialsProvider returns the credentials found in a single source, or
+// an error if there are none.
+type credentialsProvider func() (credentials, error)
+
+// resolveCredentials returns the credentials of the first provider of the
+// chain that has any.
+func resolveCredentials(chain []credentialsProvider) (credentials, error) {
+	var errs []string
+	for _, provider := range chain {
+		creds, err := provider()
+		if err == nil {
+			return creds, nil
+		}
+		errs = append(errs, err.Error())
+	}
+
+	return credentials{}, fmt.Errorf("No valid AWS credentials found: %s", strings.Join(errs, "; "))
+}
+
+// credentialsChain returns the providers looked up in order: the access and
+// secret keys given in the configuration, the environment, the shared
+// credentials file and finally the instance role of the EC2 instance.
+func credentialsChain(accessKey, secretKey string) []credentialsProvider {
+	return []credentialsProvider{
+		staticCredentials(accessKey, secretKey),
+		envCredentials,
+		sharedCredentials,
+		instanceCredentials,
+	}
+}
+
+func staticCredentials(accessKey, secretKey string) credentialsProvider {
+	return func() (credentials, error) {
+		if accessKey == "" || secretKey == "" {
+			return credentials{}, fmt.Errorf("no access and secret keys configured")
+		}
+		return credentials{AccessKey: accessKey, SecretKey: secretKey}, nil
+	}
+}
+
+// envCredentials reads the credentials from the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func envCredentials() (credentials, error) {
+	creds := credentials{
+		AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		Token:     os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKey == "" {
+		creds.AccessKey = os.Getenv("AWS_ACCESS_KEY")
+	}
+	if creds.SecretKey == "" {
+		creds.SecretKey = os.Getenv("AWS_SECRET_KEY")
+	}
+
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return credentials{}, fmt.Errorf("no credentials in environment")
+	}
+	return creds, nil
+}
+
+// sharedCredentials reads the credentials of the AWS_PROFILE profile, or
+// "default", from the shared credentials file named by
+// AWS_SHARED_CREDENTIALS_FILE, or ~/.aws/credentials.
+func sharedCredentials() (credentials, error) {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		u, err := user.Current()
+		if err != nil {
+			return credentials{}, err
+		}
+		path = filepath.Join(u.HomeDir, ".aws", "credentials")
+	}
+
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		return credentials{}, err
+	}
+
+	values := make(map[string]string)
+	section := ""
+	for _, line := range strings.Split(string(p), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSpace(line[1 : len(line)-1])
+		case section == profile:
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) == 2 {
+				values[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			}
+		}
+	}
+
+	creds := credentials{
+		AccessKey: values["aws_access_key_id"],
+		SecretKey: values["aws_secret_access_key"],
+		Token:     values["aws_session_token"],
+	}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return credentials{}, fmt.Errorf("no credentials for profile %q in %s", profile, path)
+	}
+	return creds, nil
+}
+
+// metadataClient is used to query the instance metadata service, which
+// answers quickly when it is reachable at all.
+var metadataClient = &http.Client{Timeout: 5 * time.Second}
+
+func getMetadata(path string) ([]byte, error) {
+	resp, err := metadataClient.Get(instanceMetadataURL + path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("instance metadata %s: %s", path, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// instanceCredentials fetches the temporary credentials of the IAM role of
+// the EC2 instance from the instance metadata service.
+func instanceCredentials() (credentials, error) {
+	const credentialsPath = "iam/security-credentials/"
+
+	roles, err := getMetadata(credentialsPath)
+	if err != nil {
+		return credentials{}, err
+	}
+
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return credentials{}, fmt.Errorf("no IAM role attached to the instance")
+	}
+
+	p, err := getMetadata(credentialsPath + role)
+	if err != nil {
+		return credentials{}, err
+	}
+
+	var response struct {
+		Code            string
+		AccessKeyId     string
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+	if err := json.Unmarshal(p, &response); err != nil {
+		return credentials{}, err
+	}
+
+	if response.Code != "Success" {
+		return credentials{}, fmt.Errorf("instance credentials of role %q unavailable: %s", role, response.Code)
+	}
+
+	return credentials{
+		AccessKey:  response.AccessKeyId,
+		SecretKey:  response.SecretAccessKey,
+		Token:      response.Token,
+		Expiration: response.Expiration,
+	}, nil
+}
@@ -0,0 +1,245 @@
+package s3
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setenv sets the environment variables, unsetting those with empty values,
+// and returns a function restoring their previous values.
+func setenv(vars map[string]string) func() {
+	previous := make(map[string]string)
+	for name, value := range vars {
+		previous[name] = os.Getenv(name)
+		os.Setenv(name, value)
+		if value == "" {
+			os.Unsetenv(name)
+		}
+	}
+
+	return func() {
+		for name, value := range previous {
+			os.Setenv(name, value)
+			if value == "" {
+				os.Unsetenv(name)
+			}
+		}
+	}
+}
+
+// fakeMetadata serves the instance credentials of a single role.
+type fakeMetadata struct {
+	mu          sync.Mutex
+	accessKey   string
+	expiration  time.Time
+	unavailable bool
+}
+
+func (f *fakeMetadata) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.unavailable {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/latest/meta-data/iam/security-credentials/":
+		w.Write([]byte("registry-role"))
+	case "/latest/meta-data/iam/security-credentials/registry-role":
+		json.NewEncoder(w).Encode(map[string]string{
+			"Code":            "Success",
+			"Type":            "AWS-HMAC",
+			"AccessKeyId":     f.accessKey,
+			"SecretAccessKey": "secret-" + f.accessKey,
+			"Token":           "token-" + f.accessKey,
+			"Expiration":      f.expiration.UTC().Format(time.RFC3339),
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeMetadata) set(accessKey string, expiration time.Time, unavailable bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.accessKey, f.expiration, f.unavailable = accessKey, expiration, unavailable
+}
+
+func TestCredentialsChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3-credentials-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	credentialsFile := filepath.Join(dir, "credentials")
+	if err := ioutil.WriteFile(credentialsFile, []byte(`
+[default]
+aws_access_key_id = default-key
+aws_secret_access_key = default-secret
+
+# Temporary credentials
+[registry]
+aws_access_key_id=registry-key
+aws_secret_access_key=registry-secret
+aws_session_token=registry-token
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer setenv(map[string]string{
+		"AWS_ACCESS_KEY_ID":           "",
+		"AWS_SECRET_ACCESS_KEY":       "",
+		"AWS_SESSION_TOKEN":           "",
+		"AWS_ACCESS_KEY":              "",
+		"AWS_SECRET_KEY":              "",
+		"AWS_PROFILE":                 "",
+		"AWS_SHARED_CREDENTIALS_FILE": credentialsFile,
+	})()
+
+	for _, testcase := range []struct {
+		env       map[string]string
+		accessKey string
+		expected  credentials
+	}{
+		{
+			accessKey: "static-key",
+			expected:  credentials{AccessKey: "static-key", SecretKey: "static-secret"},
+		},
+		{
+			env:      map[string]string{"AWS_ACCESS_KEY_ID": "env-key", "AWS_SECRET_ACCESS_KEY": "env-secret", "AWS_SESSION_TOKEN": "env-token"},
+			expected: credentials{AccessKey: "env-key", SecretKey: "env-secret", Token: "env-token"},
+		},
+		{
+			expected: credentials{AccessKey: "default-key", SecretKey: "default-secret"},
+		},
+		{
+			env:      map[string]string{"AWS_PROFILE": "registry"},
+			expected: credentials{AccessKey: "registry-key", SecretKey: "registry-secret", Token: "registry-token"},
+		},
+	} {
+		restore := setenv(testcase.env)
+		secretKey := ""
+		if testcase.accessKey != "" {
+			secretKey = "static-secret"
+		}
+
+		creds, err := resolveCredentials(credentialsChain(testcase.accessKey, secretKey))
+		restore()
+		if err != nil {
+			t.Errorf("unexpected error resolving credentials with %v: %v", testcase.env, err)
+			continue
+		}
+		if creds != testcase.expected {
+			t.Errorf("unexpected credentials with %v: %+v != %+v", testcase.env, creds, testcase.expected)
+		}
+	}
+}
+
+func TestInstanceCredentialsRefresh(t *testing.T) {
+	metadata := &fakeMetadata{}
+	metadata.set("key-1", time.Now().Add(time.Hour), false)
+	server := httptest.NewServer(metadata)
+	defer server.Close()
+
+	defer func(previous string) { instanceMetadataURL = previous }(instanceMetadataURL)
+	instanceMetadataURL = server.URL + "/latest/meta-data/"
+
+	defer setenv(map[string]string{
+		"AWS_ACCESS_KEY_ID":           "",
+		"AWS_SECRET_ACCESS_KEY":       "",
+		"AWS_ACCESS_KEY":              "",
+		"AWS_SECRET_KEY":              "",
+		"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(os.TempDir(), "s3-credentials-missing"),
+	})()
+
+	fake := httptest.NewServer(newFakeS3("registry"))
+	defer fake.Close()
+
+	d, err := FromParameters(map[string]interface{}{
+		"regionendpoint": fake.URL,
+		"bucket":         "registry",
+		"secure":         false,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	drv := d.baseEmbed.Base.StorageDriver.(*driver)
+
+	checkKey := func(expected string) {
+		auth := drv.bucket().S3.Auth
+		if auth.AccessKey != expected || auth.SecretKey != "secret-"+expected || auth.Token() != "token-"+expected {
+			t.Fatalf("unexpected credentials: %s, %s, %s, expected %s", auth.AccessKey, auth.SecretKey, auth.Token(), expected)
+		}
+	}
+	checkKey("key-1")
+
+	// Credentials far from their expiration are not refreshed.
+	metadata.set("key-2", time.Now().Add(2*time.Minute), false)
+	checkKey("key-1")
+
+	// Credentials about to expire are refreshed.
+	drv.mu.Lock()
+	drv.credentials.Expiration = time.Now().Add(time.Minute)
+	drv.mu.Unlock()
+	checkKey("key-2")
+
+	// Failed refreshes keep the current credentials until a retry succeeds.
+	metadata.set("key-3", time.Now().Add(time.Hour), true)
+	checkKey("key-2")
+	metadata.set("key-3", time.Now().Add(time.Hour), false)
+	checkKey("key-2")
+
+	drv.mu.Lock()
+	drv.retryRefresh = time.Now()
+	drv.mu.Unlock()
+	checkKey("key-3")
+
+	// Other requests go on with the current credentials during a refresh.
+	metadata.set("key-4", time.Now().Add(time.Hour), false)
+	drv.mu.Lock()
+	drv.credentials.Expiration = time.Now().Add(time.Minute)
+	drv.mu.Unlock()
+
+	metadata.mu.Lock()
+	refreshed := make(chan struct{})
+	go func() {
+		drv.bucket()
+		close(refreshed)
+	}()
+
+	for refreshing := false; !refreshing; {
+		time.Sleep(time.Millisecond)
+		drv.mu.Lock()
+		refreshing = drv.refreshing
+		drv.mu.Unlock()
+	}
+
+	current := make(chan struct{})
+	go func() {
+		checkKey("key-3")
+		close(current)
+	}()
+	select {
+	case <-current:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("request blocked by the refresh of the credentials")
+	}
+
+	metadata.mu.Unlock()
+	<-refreshed
+	checkKey("key-4")
+
+	if err := d.PutContent("/content", []byte("content")); err != nil {
+		t.Fatalf("unexpected error writing content: %v", err)
+	}
+}
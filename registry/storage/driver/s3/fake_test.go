@@ -0,0 +1,537 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeS3 is an in-memory S3 compatible service, addressing buckets in the
+// path of the requests. It does not verify request signatures, but checks
+// the server-side encryption headers as S3 does.
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string]*fakeObject
+	uploads map[string]*fakeUpload
+	nextID  int
+}
+
+type fakeObject struct {
+	data       []byte
+	etag       string
+	modTime    time.Time
+	encryption fakeEncryption
+}
+
+type fakeUpload struct {
+	key        string
+	parts      map[int][]byte
+	encryption fakeEncryption
+}
+
+// fakeEncryption is the server-side encryption of an object.
+type fakeEncryption struct {
+	// mode is "", "AES256", "aws:kms" or "SSE-C".
+	mode           string
+	keyID          string
+	customerKeyMD5 string
+}
+
+const (
+	sseHeader         = "x-amz-server-side-encryption"
+	sseCustomerHeader = "x-amz-server-side-encryption-customer-"
+	sseCopyHeader     = "x-amz-copy-source-server-side-encryption-customer-"
+)
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{
+		bucket:  bucket,
+		objects: make(map[string]*fakeObject),
+		uploads: make(map[string]*fakeUpload),
+	}
+}
+
+func etagOf(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if parts[0] != f.bucket {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	query := r.URL.Query()
+	if len(parts) == 1 || parts[1] == "" {
+		switch {
+		case r.Method == "GET":
+			f.list(w, query)
+		case r.Method == "POST" && hasParam(query, "delete"):
+			f.deleteMulti(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	key := parts[1]
+	switch {
+	case r.Method == "POST" && hasParam(query, "uploads"):
+		encryption, ok := parseEncryption(r)
+		if !ok {
+			writeS3Error(w, http.StatusBadRequest, "InvalidArgument")
+			return
+		}
+		f.nextID++
+		id := strconv.Itoa(f.nextID)
+		f.uploads[id] = &fakeUpload{key: key, parts: make(map[int][]byte), encryption: encryption}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: f.bucket, Key: key, UploadId: id})
+	case r.Method == "POST" && hasParam(query, "uploadId"):
+		f.completeUpload(w, r, query.Get("uploadId"))
+	case r.Method == "PUT" && hasParam(query, "uploadId"):
+		f.putPart(w, r, query)
+	case r.Method == "DELETE" && hasParam(query, "uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "PUT" && r.Header.Get("x-amz-copy-source") != "":
+		encryption, ok := parseEncryption(r)
+		if !ok {
+			writeS3Error(w, http.StatusBadRequest, "InvalidArgument")
+			return
+		}
+		data, ok := f.copySource(w, r)
+		if !ok {
+			return
+		}
+		obj := f.store(key, data, encryption)
+		writeEncryptionHeaders(w, obj.encryption)
+		writeXML(w, struct {
+			XMLName      xml.Name `xml:"CopyObjectResult"`
+			ETag         string
+			LastModified string
+		}{ETag: obj.etag, LastModified: obj.modTime.Format(time.RFC3339Nano)})
+	case r.Method == "PUT":
+		encryption, ok := parseEncryption(r)
+		if !ok {
+			writeS3Error(w, http.StatusBadRequest, "InvalidArgument")
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		obj := f.store(key, data, encryption)
+		writeEncryptionHeaders(w, obj.encryption)
+		w.Header().Set("ETag", obj.etag)
+	case r.Method == "GET" || r.Method == "HEAD":
+		f.get(w, r, key)
+	case r.Method == "DELETE":
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func hasParam(query url.Values, name string) bool {
+	_, ok := query[name]
+	return ok
+}
+
+func (f *fakeS3) store(key string, data []byte, encryption fakeEncryption) *fakeObject {
+	obj := &fakeObject{data: data, etag: etagOf(data), modTime: time.Now().UTC(), encryption: encryption}
+	f.objects[key] = obj
+	return obj
+}
+
+// v4Signed reports whether the request is signed with signature version 4,
+// which KMS encrypted objects require.
+func v4Signed(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256") ||
+		r.URL.Query().Get("X-Amz-Algorithm") == "AWS4-HMAC-SHA256"
+}
+
+// customerKey returns the MD5 of the customer-provided key given in the
+// headers starting with prefix, if any, checking the key is valid.
+func customerKey(r *http.Request, prefix string) (md5sum string, ok bool) {
+	algorithm := r.Header.Get(prefix + "algorithm")
+	key := r.Header.Get(prefix + "key")
+	keyMD5 := r.Header.Get(prefix + "key-MD5")
+	if algorithm == "" && key == "" && keyMD5 == "" {
+		return "", true
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if algorithm != "AES256" || err != nil || len(decoded) != 32 {
+		return "", false
+	}
+
+	sum := md5.Sum(decoded)
+	if base64.StdEncoding.EncodeToString(sum[:]) != keyMD5 {
+		return "", false
+	}
+	return keyMD5, true
+}
+
+// parseEncryption returns the encryption requested for the object written.
+func parseEncryption(r *http.Request) (fakeEncryption, bool) {
+	keyMD5, ok := customerKey(r, sseCustomerHeader)
+	if !ok {
+		return fakeEncryption{}, false
+	}
+
+	mode, keyID := r.Header.Get(sseHeader), r.Header.Get(sseHeader+"-aws-kms-key-id")
+	switch {
+	case keyMD5 != "":
+		if mode != "" {
+			return fakeEncryption{}, false
+		}
+		return fakeEncryption{mode: "SSE-C", customerKeyMD5: keyMD5}, true
+	case mode == "aws:kms":
+		if !v4Signed(r) {
+			return fakeEncryption{}, false
+		}
+		if keyID == "" {
+			keyID = "aws/s3"
+		}
+		return fakeEncryption{mode: mode, keyID: keyID}, true
+	case (mode == "" || mode == "AES256") && keyID == "":
+		return fakeEncryption{mode: mode}, true
+	}
+
+	return fakeEncryption{}, false
+}
+
+// readable reports whether the request may read an object with the given
+// encryption.
+func readable(r *http.Request, prefix string, encryption fakeEncryption) bool {
+	keyMD5, ok := customerKey(r, prefix)
+	if !ok || keyMD5 != encryption.customerKeyMD5 {
+		return false
+	}
+	return encryption.mode != "aws:kms" || v4Signed(r)
+}
+
+func writeEncryptionHeaders(w http.ResponseWriter, encryption fakeEncryption) {
+	switch encryption.mode {
+	case "SSE-C":
+		w.Header().Set(sseCustomerHeader+"algorithm", "AES256")
+		w.Header().Set(sseCustomerHeader+"key-MD5", encryption.customerKeyMD5)
+	case "aws:kms":
+		w.Header().Set(sseHeader, encryption.mode)
+		w.Header().Set(sseHeader+"-aws-kms-key-id", encryption.keyID)
+	case "AES256":
+		w.Header().Set(sseHeader, encryption.mode)
+	}
+}
+
+func (f *fakeS3) get(w http.ResponseWriter, r *http.Request, key string) {
+	obj, ok := f.objects[key]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	if !readable(r, sseCustomerHeader, obj.encryption) {
+		writeS3Error(w, http.StatusBadRequest, "InvalidRequest")
+		return
+	}
+
+	data := obj.data
+	status := http.StatusOK
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		start, end, ok := parseRange(rangeHeader, int64(len(data)))
+		if !ok {
+			writeS3Error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+		data = data[start : end+1]
+		status = http.StatusPartialContent
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("ETag", obj.etag)
+	w.Header().Set("Last-Modified", obj.modTime.Format(http.TimeFormat))
+	writeEncryptionHeaders(w, obj.encryption)
+	w.WriteHeader(status)
+	if r.Method == "GET" {
+		w.Write(data)
+	}
+}
+
+// parseRange parses a "bytes=start-[end]" range against an object of the
+// given size.
+func parseRange(rangeHeader string, size int64) (start, end int64, ok bool) {
+	spec := strings.SplitN(strings.TrimPrefix(rangeHeader, "bytes="), "-", 2)
+	if len(spec) != 2 {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(spec[0], 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+
+	end = size - 1
+	if spec[1] != "" {
+		end, err = strconv.ParseInt(spec[1], 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return start, end, true
+}
+
+func (f *fakeS3) copySource(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	source, err := url.QueryUnescape(r.Header.Get("x-amz-copy-source"))
+	if err != nil || !strings.HasPrefix(source, f.bucket+"/") {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument")
+		return nil, false
+	}
+
+	obj, ok := f.objects[strings.TrimPrefix(source, f.bucket+"/")]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+		return nil, false
+	}
+
+	if !readable(r, sseCopyHeader, obj.encryption) {
+		writeS3Error(w, http.StatusBadRequest, "InvalidRequest")
+		return nil, false
+	}
+
+	data := obj.data
+	if rangeHeader := r.Header.Get("x-amz-copy-source-range"); rangeHeader != "" {
+		start, end, ok := parseRange(rangeHeader, int64(len(data)))
+		if !ok {
+			writeS3Error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return nil, false
+		}
+		data = data[start : end+1]
+	}
+
+	return append([]byte(nil), data...), true
+}
+
+func (f *fakeS3) putPart(w http.ResponseWriter, r *http.Request, query url.Values) {
+	upload, ok := f.uploads[query.Get("uploadId")]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	n, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+
+	// Parts are encrypted as configured when the upload was initiated,
+	// only the customer-provided key must be given again.
+	keyMD5, ok := customerKey(r, sseCustomerHeader)
+	if !ok || keyMD5 != upload.encryption.customerKeyMD5 || r.Header.Get(sseHeader) != "" {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+
+	if r.Header.Get("x-amz-copy-source") != "" {
+		data, ok := f.copySource(w, r)
+		if !ok {
+			return
+		}
+		upload.parts[n] = data
+		writeXML(w, struct {
+			XMLName      xml.Name `xml:"CopyPartResult"`
+			ETag         string
+			LastModified string
+		}{ETag: etagOf(data), LastModified: time.Now().UTC().Format(time.RFC3339Nano)})
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	upload.parts[n] = data
+	w.Header().Set("ETag", etagOf(data))
+}
+
+func (f *fakeS3) completeUpload(w http.ResponseWriter, r *http.Request, id string) {
+	upload, ok := f.uploads[id]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	var request struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeS3Error(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	var buf bytes.Buffer
+	for _, part := range request.Parts {
+		data, ok := upload.parts[part.PartNumber]
+		if !ok || etagOf(data) != part.ETag {
+			writeS3Error(w, http.StatusBadRequest, "InvalidPart")
+			return
+		}
+		buf.Write(data)
+	}
+
+	delete(f.uploads, id)
+	obj := f.store(upload.key, buf.Bytes(), upload.encryption)
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+		ETag    string
+	}{Bucket: f.bucket, Key: upload.key, ETag: obj.etag})
+}
+
+func (f *fakeS3) deleteMulti(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Objects []struct {
+			Key string
+		} `xml:"Object"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeS3Error(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	for _, object := range request.Objects {
+		delete(f.objects, object.Key)
+	}
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"DeleteResult"`
+	}{})
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, query url.Values) {
+	prefix, delimiter, marker := query.Get("prefix"), query.Get("delimiter"), query.Get("marker")
+	maxKeys := 1000
+	if n, err := strconv.Atoi(query.Get("max-keys")); err == nil && n > 0 {
+		maxKeys = n
+	}
+
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	type listKey struct {
+		Key          string
+		LastModified string
+		Size         int64
+		ETag         string
+	}
+	type commonPrefix struct {
+		Prefix string
+	}
+	var response struct {
+		XMLName        xml.Name `xml:"ListBucketResult"`
+		Name           string
+		Prefix         string
+		Marker         string
+		MaxKeys        int
+		IsTruncated    bool
+		NextMarker     string `xml:",omitempty"`
+		Contents       []listKey
+		CommonPrefixes []commonPrefix
+	}
+	response.Name, response.Prefix, response.Marker, response.MaxKeys = f.bucket, prefix, marker, maxKeys
+
+	seen := make(map[string]bool)
+	count := 0
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || key <= marker {
+			continue
+		}
+
+		entry := key
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				entry = key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if entry <= marker || seen[entry] {
+			continue
+		}
+
+		if count == maxKeys {
+			response.IsTruncated = true
+			break
+		}
+		seen[entry] = true
+		count++
+		response.NextMarker = entry
+
+		if entry != key {
+			response.CommonPrefixes = append(response.CommonPrefixes, commonPrefix{entry})
+			continue
+		}
+		obj := f.objects[key]
+		response.Contents = append(response.Contents, listKey{
+			Key:          key,
+			LastModified: obj.modTime.Format(time.RFC3339Nano),
+			Size:         int64(len(obj.data)),
+			ETag:         obj.etag,
+		})
+	}
+	if !response.IsTruncated {
+		response.NextMarker = ""
+	}
+
+	writeXML(w, response)
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	p, err := xml.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(append([]byte(xml.Header), p...))
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%s<Error><Code>%s</Code><Message>%s</Message></Error>", xml.Header, code, code)
+}
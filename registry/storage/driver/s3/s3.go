@@ -16,16 +16,23 @@ package s3
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/AdRoll/goamz/aws"
 	"github.com/AdRoll/goamz/s3"
+	"github.com/docker/distribution/context"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/registry/storage/driver/base"
 	"github.com/docker/distribution/registry/storage/driver/factory"
@@ -53,6 +60,101 @@ type DriverParameters struct {
 	V4Auth        bool
 	ChunkSize     int64
 	RootDirectory string
+
+	// RegionEndpoint, if set, replaces the endpoint of Region, to use an
+	// S3 compatible service.
+	RegionEndpoint string
+
+	// PathStyle addresses the bucket in the path of the requests, rather
+	// than in the host name.
+	PathStyle bool
+
+	// SkipBucketCheck skips checking that the bucket can be listed when
+	// the driver is created.
+	SkipBucketCheck bool
+
+	// EncryptionMode is the server-side encryption of the objects written:
+	// "aes256", "kms" or "sse-c". If empty, Encrypt selects "kms" if KeyID
+	// is set and "aes256" otherwise.
+	EncryptionMode string
+
+	// KeyID is the id of the KMS key used with the "kms" encryption mode.
+	// The default KMS key of the account is used if empty.
+	KeyID string
+
+	// CustomerKey is the base64 encoded 256 bits key used with the "sse-c"
+	// encryption mode.
+	CustomerKey string
+}
+
+const (
+	encryptionAES256 = "aes256"
+	encryptionKMS    = "kms"
+	encryptionSSEC   = "sse-c"
+)
+
+// The prefixes of the headers giving the customer-provided key of the object
+// read or written, and of the source object of copies.
+const (
+	sseCustomerPrefix           = "x-amz-server-side-encryption-customer-"
+	sseCopySourceCustomerPrefix = "x-amz-copy-source-server-side-encryption-customer-"
+)
+
+// requestExpiry is the validity of the URLs presigned for the requests the
+// driver sends itself.
+const requestExpiry = 15 * time.Minute
+
+// serverSideEncryption is the encryption of the objects written, requested
+// from S3 through headers.
+type serverSideEncryption struct {
+	mode           string // empty or one of the encryption modes
+	keyID          string
+	customerKey    string
+	customerKeyMD5 string
+}
+
+// goamzOptions returns the options passing e to the goamz client, which only
+// sends the headers of the AES256 mode. ok is false for the other modes.
+func (e serverSideEncryption) goamzOptions() (options s3.Options, ok bool) {
+	switch e.mode {
+	case "":
+		return s3.Options{}, true
+	case encryptionAES256:
+		return s3.Options{SSE: true}, true
+	}
+
+	return s3.Options{}, false
+}
+
+// headers returns the headers requesting the encryption of the objects
+// written.
+func (e serverSideEncryption) headers() http.Header {
+	headers := make(http.Header)
+	switch e.mode {
+	case encryptionAES256:
+		headers["x-amz-server-side-encryption"] = []string{"AES256"}
+	case encryptionKMS:
+		headers["x-amz-server-side-encryption"] = []string{"aws:kms"}
+		if e.keyID != "" {
+			headers["x-amz-server-side-encryption-aws-kms-key-id"] = []string{e.keyID}
+		}
+	case encryptionSSEC:
+		return e.customerHeaders(sseCustomerPrefix)
+	}
+	return headers
+}
+
+// customerHeaders returns the headers, starting with prefix, of the
+// customer-provided key, if any. They must be sent to read the objects
+// encrypted with it and to write the parts of their uploads.
+func (e serverSideEncryption) customerHeaders(prefix string) http.Header {
+	headers := make(http.Header)
+	if e.mode == encryptionSSEC {
+		headers[prefix+"algorithm"] = []string{"AES256"}
+		headers[prefix+"key"] = []string{e.customerKey}
+		headers[prefix+"key-MD5"] = []string{e.customerKeyMD5}
+	}
+	return headers
 }
 
 func init() {
@@ -70,8 +172,18 @@ type driver struct {
 	S3            *s3.S3
 	Bucket        *s3.Bucket
 	ChunkSize     int64
-	Encrypt       bool
+	SSE           serverSideEncryption
 	RootDirectory string
+
+	// mu protects S3 and Bucket, which are replaced when the credentials
+	// are refreshed.
+	mu              sync.Mutex
+	region          aws.Region
+	signature       int
+	credentialChain []credentialsProvider
+	credentials     credentials
+	retryRefresh    time.Time
+	refreshing      bool
 }
 
 type baseEmbed struct {
@@ -88,9 +200,17 @@ type Driver struct {
 // Required parameters:
 // - accesskey
 // - secretkey
-// - region
+// - region, unless regionendpoint is set
 // - bucket
 // - encrypt
+// Optional parameters:
+// - regionendpoint
+// - pathstyle
+// - signatureversion
+// - skipbucketcheck
+// - encryptionmode
+// - keyid
+// - customerkey
 func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 	// Providing no values for these is valid in case the user is authenticating
 	// with an IAM on an ec2 instance (in which case the instance credentials will
@@ -104,13 +224,29 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 		secretKey = ""
 	}
 
+	regionEndpoint, ok := parameters["regionendpoint"]
+	if !ok {
+		regionEndpoint = ""
+	}
+
 	regionName, ok := parameters["region"]
-	if !ok || fmt.Sprint(regionName) == "" {
-		return nil, fmt.Errorf("No region parameter provided")
+	if !ok {
+		regionName = ""
 	}
-	region := aws.GetRegion(fmt.Sprint(regionName))
-	if region.Name == "" {
-		return nil, fmt.Errorf("Invalid region provided: %v", region)
+
+	var region aws.Region
+	if fmt.Sprint(regionEndpoint) != "" {
+		// S3 compatible services accept any region name, which is only
+		// used to sign requests.
+		region.Name = fmt.Sprint(regionName)
+	} else {
+		if fmt.Sprint(regionName) == "" {
+			return nil, fmt.Errorf("No region parameter provided")
+		}
+		region = aws.GetRegion(fmt.Sprint(regionName))
+		if region.Name == "" {
+			return nil, fmt.Errorf("Invalid region provided: %v", regionName)
+		}
 	}
 
 	bucket, ok := parameters["bucket"]
@@ -119,14 +255,35 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 	}
 
 	encryptBool := false
-	encrypt, ok := parameters["encrypt"]
-	if ok {
+	encrypt, encryptSet := parameters["encrypt"]
+	if encryptSet {
 		encryptBool, ok = encrypt.(bool)
 		if !ok {
 			return nil, fmt.Errorf("The encrypt parameter should be a boolean")
 		}
 	}
 
+	encryptionMode, ok := parameters["encryptionmode"]
+	if !ok {
+		encryptionMode = ""
+	}
+	if fmt.Sprint(encryptionMode) != "" {
+		if encryptSet && !encryptBool {
+			return nil, fmt.Errorf("The encryptionmode parameter conflicts with encrypt set to false")
+		}
+		encryptBool = true
+	}
+
+	keyID, ok := parameters["keyid"]
+	if !ok {
+		keyID = ""
+	}
+
+	customerKey, ok := parameters["customerkey"]
+	if !ok {
+		customerKey = ""
+	}
+
 	secureBool := true
 	secure, ok := parameters["secure"]
 	if ok {
@@ -145,6 +302,38 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 		}
 	}
 
+	signatureVersion, ok := parameters["signatureversion"]
+	if ok {
+		switch fmt.Sprint(signatureVersion) {
+		case "2":
+			if v4AuthBool {
+				return nil, fmt.Errorf("The v4auth parameter conflicts with signatureversion 2")
+			}
+		case "4":
+			v4AuthBool = true
+		default:
+			return nil, fmt.Errorf("The signatureversion parameter should be 2 or 4")
+		}
+	}
+
+	pathStyleBool := true
+	pathStyle, ok := parameters["pathstyle"]
+	if ok {
+		pathStyleBool, ok = pathStyle.(bool)
+		if !ok {
+			return nil, fmt.Errorf("The pathstyle parameter should be a boolean")
+		}
+	}
+
+	skipBucketCheckBool := false
+	skipBucketCheck, ok := parameters["skipbucketcheck"]
+	if ok {
+		skipBucketCheckBool, ok = skipBucketCheck.(bool)
+		if !ok {
+			return nil, fmt.Errorf("The skipbucketcheck parameter should be a boolean")
+		}
+	}
+
 	chunkSize := int64(defaultChunkSize)
 	chunkSizeParam, ok := parameters["chunksize"]
 	if ok {
@@ -169,6 +358,12 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 		v4AuthBool,
 		chunkSize,
 		fmt.Sprint(rootDirectory),
+		fmt.Sprint(regionEndpoint),
+		pathStyleBool,
+		skipBucketCheckBool,
+		fmt.Sprint(encryptionMode),
+		fmt.Sprint(keyID),
+		fmt.Sprint(customerKey),
 	}
 
 	return New(params)
@@ -177,30 +372,71 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 // New constructs a new Driver with the given AWS credentials, region, encryption flag, and
 // bucketName
 func New(params DriverParameters) (*Driver, error) {
-	auth, err := aws.GetAuth(params.AccessKey, params.SecretKey, "", time.Time{})
+	chain := credentialsChain(params.AccessKey, params.SecretKey)
+	creds, err := resolveCredentials(chain)
 	if err != nil {
 		return nil, err
 	}
 
+	if params.RegionEndpoint != "" {
+		params.Region.S3Endpoint = params.RegionEndpoint
+		if !strings.Contains(params.RegionEndpoint, "://") {
+			params.Region.S3Endpoint = "https://" + params.RegionEndpoint
+		}
+
+		if params.Region.Name == "" {
+			params.Region.Name = "us-east-1"
+		}
+	}
+
+	if !params.PathStyle {
+		bucketEndpoint, err := virtualHostEndpoint(params.Region.S3Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		params.Region.S3BucketEndpoint = bucketEndpoint
+	}
+
 	if !params.Secure {
 		params.Region.S3Endpoint = strings.Replace(params.Region.S3Endpoint, "https", "http", 1)
+		params.Region.S3BucketEndpoint = strings.Replace(params.Region.S3BucketEndpoint, "https", "http", 1)
 	}
 
-	s3obj := s3.New(auth, params.Region)
-	bucket := s3obj.Bucket(params.Bucket)
+	sse, err := encryptionOptions(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if sse.mode == encryptionKMS && !params.V4Auth {
+		return nil, fmt.Errorf("The kms encryption mode only works with v4 authentication")
+	}
 
+	signature := aws.V2Signature
 	if params.V4Auth {
-		s3obj.Signature = aws.V4Signature
+		signature = aws.V4Signature
 	} else {
 		if params.Region.Name == "eu-central-1" {
 			return nil, fmt.Errorf("The eu-central-1 region only works with v4 authentication")
 		}
 	}
 
+	d := &driver{
+		ChunkSize:       params.ChunkSize,
+		SSE:             sse,
+		RootDirectory:   params.RootDirectory,
+		region:          params.Region,
+		signature:       signature,
+		credentialChain: chain,
+	}
+	d.setCredentials(params.Bucket, creds)
+	bucket := d.Bucket
+
 	// Validate that the given credentials have at least read permissions in the
 	// given bucket scope.
-	if _, err := bucket.List(strings.TrimRight(params.RootDirectory, "/"), "", "", 1); err != nil {
-		return nil, err
+	if !params.SkipBucketCheck {
+		if _, err := bucket.List(strings.TrimRight(params.RootDirectory, "/"), "", "", 1); err != nil {
+			return nil, err
+		}
 	}
 
 	// TODO Currently multipart uploads have no timestamps, so this would be unwise
@@ -218,14 +454,6 @@ func New(params DriverParameters) (*Driver, error) {
 	// 	}
 	// }
 
-	d := &driver{
-		S3:            s3obj,
-		Bucket:        bucket,
-		ChunkSize:     params.ChunkSize,
-		Encrypt:       params.Encrypt,
-		RootDirectory: params.RootDirectory,
-	}
-
 	return &Driver{
 		baseEmbed: baseEmbed{
 			Base: base.Base{
@@ -237,27 +465,37 @@ func New(params DriverParameters) (*Driver, error) {
 
 // Implement the storagedriver.StorageDriver interface
 
+func (d *driver) Name() string {
+	return driverName
+}
+
 // GetContent retrieves the content stored at "path" as a []byte.
 func (d *driver) GetContent(path string) ([]byte, error) {
-	content, err := d.Bucket.Get(d.s3Path(path))
+	resp, err := d.bucket().GetResponseWithHeaders(d.s3Path(path), d.getSSECustomerHeaders())
 	if err != nil {
 		return nil, parseError(path, err)
 	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
 	return content, nil
 }
 
 // PutContent stores the []byte content at a location designated by "path".
 func (d *driver) PutContent(path string, contents []byte) error {
-	return parseError(path, d.Bucket.Put(d.s3Path(path), contents, d.getContentType(), getPermissions(), d.getOptions()))
+	return parseError(path, d.putObject(d.bucket(), d.s3Path(path), contents))
 }
 
 // ReadStream retrieves an io.ReadCloser for the content stored at "path" with a
 // given byte offset.
 func (d *driver) ReadStream(path string, offset int64) (io.ReadCloser, error) {
-	headers := make(http.Header)
+	headers := d.getSSECustomerHeaders()
 	headers.Add("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
 
-	resp, err := d.Bucket.GetResponseWithHeaders(d.s3Path(path), headers)
+	resp, err := d.bucket().GetResponseWithHeaders(d.s3Path(path), headers)
 	if err != nil {
 		if s3Err, ok := err.(*s3.Error); ok && s3Err.Code == "InvalidRange" {
 			return ioutil.NopCloser(bytes.NewReader(nil)), nil
@@ -282,7 +520,8 @@ func (d *driver) WriteStream(path string, offset int64, reader io.Reader) (total
 	parts := []s3.Part{}
 	var part s3.Part
 
-	multi, err := d.Bucket.InitMulti(d.s3Path(path), d.getContentType(), getPermissions(), d.getOptions())
+	bucket := d.bucket()
+	multi, err := d.initMulti(bucket, d.s3Path(path))
 	if err != nil {
 		return 0, err
 	}
@@ -309,6 +548,9 @@ func (d *driver) WriteStream(path string, offset int64, reader io.Reader) (total
 				// Parts should be empty if the multi is not initialized
 				panic("Unreachable")
 			} else {
+				// The upload may have outlived the credentials it
+				// started with.
+				multi.Bucket = d.bucket()
 				if multi.Complete(parts) != nil {
 					multi.Abort()
 				}
@@ -370,7 +612,7 @@ func (d *driver) WriteStream(path string, offset int64, reader io.Reader) (total
 			// parts and partNumber are safe, because this function is the only one modifying them and we
 			// force it to be executed serially.
 			if bytesRead > 0 {
-				part, putErr := multi.PutPart(int(partNumber), bytes.NewReader(buf[0:int64(bytesRead)+from]))
+				part, putErr := d.putPart(multi, partNumber, buf[0:int64(bytesRead)+from])
 				if putErr != nil {
 					putErrChan <- putErr
 				}
@@ -386,7 +628,7 @@ func (d *driver) WriteStream(path string, offset int64, reader io.Reader) (total
 	}
 
 	if offset > 0 {
-		resp, err := d.Bucket.Head(d.s3Path(path), nil)
+		resp, err := bucket.Head(d.s3Path(path), d.getSSECustomerHeaders())
 		if err != nil {
 			if s3Err, ok := err.(*s3.Error); !ok || s3Err.Code != "NoSuchKey" {
 				return 0, err
@@ -414,9 +656,7 @@ func (d *driver) WriteStream(path string, offset int64, reader io.Reader) (total
 				}
 			} else {
 				// currentLength >= offset >= chunkSize
-				_, part, err = multi.PutPartCopy(partNumber,
-					s3.CopyOptions{CopySourceOptions: "bytes=0-" + strconv.FormatInt(offset-1, 10)},
-					d.Bucket.Name+"/"+d.s3Path(path))
+				part, err = d.putPartCopy(multi, partNumber, bucket.Name+"/"+d.s3Path(path), "bytes=0-"+strconv.FormatInt(offset-1, 10))
 				if err != nil {
 					return 0, err
 				}
@@ -443,7 +683,7 @@ func (d *driver) WriteStream(path string, offset int64, reader io.Reader) (total
 			fromZeroFillLarge := func(from, to int64) error {
 				bytesRead64 := int64(0)
 				for to-(from+bytesRead64) >= d.ChunkSize {
-					part, err := multi.PutPart(int(partNumber), bytes.NewReader(zeroBuf))
+					part, err := d.putPart(multi, partNumber, zeroBuf)
 					if err != nil {
 						return err
 					}
@@ -485,7 +725,7 @@ func (d *driver) WriteStream(path string, offset int64, reader io.Reader) (total
 						return totalRead, err
 					}
 
-					part, err = multi.PutPart(int(partNumber), bytes.NewReader(buf))
+					part, err = d.putPart(multi, partNumber, buf)
 					if err != nil {
 						return totalRead, err
 					}
@@ -508,9 +748,7 @@ func (d *driver) WriteStream(path string, offset int64, reader io.Reader) (total
 				}
 			} else {
 				// offset > currentLength >= chunkSize
-				_, part, err = multi.PutPartCopy(partNumber,
-					s3.CopyOptions{},
-					d.Bucket.Name+"/"+d.s3Path(path))
+				part, err = d.putPartCopy(multi, partNumber, bucket.Name+"/"+d.s3Path(path), "")
 				if err != nil {
 					return 0, err
 				}
@@ -551,7 +789,7 @@ func (d *driver) WriteStream(path string, offset int64, reader io.Reader) (total
 // Stat retrieves the FileInfo for the given path, including the current size
 // in bytes and the creation time.
 func (d *driver) Stat(path string) (storagedriver.FileInfo, error) {
-	listResponse, err := d.Bucket.List(d.s3Path(path), "", "", 1)
+	listResponse, err := d.bucket().List(d.s3Path(path), "", "", 1)
 	if err != nil {
 		return nil, err
 	}
@@ -596,7 +834,7 @@ func (d *driver) List(path string) ([]string, error) {
 		prefix = "/"
 	}
 
-	listResponse, err := d.Bucket.List(d.s3Path(path), "/", "", listMax)
+	listResponse, err := d.bucket().List(d.s3Path(path), "/", "", listMax)
 	if err != nil {
 		return nil, err
 	}
@@ -614,7 +852,7 @@ func (d *driver) List(path string) ([]string, error) {
 		}
 
 		if listResponse.IsTruncated {
-			listResponse, err = d.Bucket.List(d.s3Path(path), "/", listResponse.NextMarker, listMax)
+			listResponse, err = d.bucket().List(d.s3Path(path), "/", listResponse.NextMarker, listMax)
 			if err != nil {
 				return nil, err
 			}
@@ -630,9 +868,8 @@ func (d *driver) List(path string) ([]string, error) {
 // object.
 func (d *driver) Move(sourcePath string, destPath string) error {
 	/* This is terrible, but aws doesn't have an actual move. */
-	_, err := d.Bucket.PutCopy(d.s3Path(destPath), getPermissions(),
-		s3.CopyOptions{Options: d.getOptions(), ContentType: d.getContentType()}, d.Bucket.Name+"/"+d.s3Path(sourcePath))
-	if err != nil {
+	bucket := d.bucket()
+	if err := d.putCopy(bucket, d.s3Path(destPath), bucket.Name+"/"+d.s3Path(sourcePath)); err != nil {
 		return parseError(sourcePath, err)
 	}
 
@@ -641,7 +878,7 @@ func (d *driver) Move(sourcePath string, destPath string) error {
 
 // Delete recursively deletes all objects stored at "path" and its subpaths.
 func (d *driver) Delete(path string) error {
-	listResponse, err := d.Bucket.List(d.s3Path(path), "", "", listMax)
+	listResponse, err := d.bucket().List(d.s3Path(path), "", "", listMax)
 	if err != nil || len(listResponse.Contents) == 0 {
 		return storagedriver.PathNotFoundError{Path: path}
 	}
@@ -653,12 +890,12 @@ func (d *driver) Delete(path string) error {
 			s3Objects[index].Key = key.Key
 		}
 
-		err := d.Bucket.DelMulti(s3.Delete{Quiet: false, Objects: s3Objects[0:len(listResponse.Contents)]})
+		err := d.bucket().DelMulti(s3.Delete{Quiet: false, Objects: s3Objects[0:len(listResponse.Contents)]})
 		if err != nil {
 			return nil
 		}
 
-		listResponse, err = d.Bucket.List(d.s3Path(path), "", "", listMax)
+		listResponse, err = d.bucket().List(d.s3Path(path), "", "", listMax)
 		if err != nil {
 			return err
 		}
@@ -670,6 +907,12 @@ func (d *driver) Delete(path string) error {
 // URLFor returns a URL which may be used to retrieve the content stored at the given path.
 // May return an UnsupportedMethodErr in certain StorageDriver implementations.
 func (d *driver) URLFor(path string, options map[string]interface{}) (string, error) {
+	// Clients cannot be given the customer-provided encryption key needed
+	// to read the objects.
+	if d.SSE.mode == encryptionSSEC {
+		return "", storagedriver.ErrUnsupportedMethod
+	}
+
 	methodString := "GET"
 	method, ok := options["method"]
 	if ok {
@@ -688,7 +931,377 @@ func (d *driver) URLFor(path string, options map[string]interface{}) (string, er
 		}
 	}
 
-	return d.Bucket.SignedURLWithMethod(methodString, d.s3Path(path), expiresTime, nil, nil), nil
+	return d.bucket().SignedURLWithMethod(methodString, d.s3Path(path), expiresTime, nil, nil), nil
+}
+
+// The goamz client cannot send the KMS and customer-provided key headers of
+// the requests writing objects. With those encryption modes, these requests
+// are sent by the driver itself to URLs presigned by goamz with the headers,
+// and retried as goamz does. Otherwise they go through goamz, like the others,
+// with the objects put and copied, which goamz tries once, retried as well.
+
+// requestAttempts is the retry strategy of the goamz client, followed by the
+// requests the driver sends itself.
+var requestAttempts = aws.AttemptStrategy{
+	Min:   5,
+	Total: 5 * time.Second,
+	Delay: 200 * time.Millisecond,
+}
+
+// presignedClient sends the requests presigned by goamz. Its timeouts catch
+// unresponsive connections without bounding the upload of a large part.
+var presignedClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Minute,
+	},
+}
+
+// putObject writes contents to the object key of bucket.
+func (d *driver) putObject(bucket *s3.Bucket, key string, contents []byte) error {
+	if options, ok := d.SSE.goamzOptions(); ok {
+		return retry("PUT", func() error {
+			return bucket.Put(key, contents, d.getContentType(), getPermissions(), options)
+		})
+	}
+
+	return retry("PUT", func() error {
+		resp, err := d.do(bucket, "PUT", key, nil, d.objectHeaders(), contents)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		return nil
+	})
+}
+
+// putCopy copies the source object, given as "<bucket>/<key>", to the object
+// key of bucket.
+func (d *driver) putCopy(bucket *s3.Bucket, key, source string) error {
+	if options, ok := d.SSE.goamzOptions(); ok {
+		return retry("PUT", func() error {
+			_, err := bucket.PutCopy(key, getPermissions(), s3.CopyOptions{Options: options, ContentType: d.getContentType()}, source)
+			return err
+		})
+	}
+
+	headers := d.objectHeaders()
+	for k, v := range d.copySourceHeaders(source) {
+		headers[k] = v
+	}
+
+	_, err := d.copy(bucket, key, nil, headers)
+	return err
+}
+
+// initMulti starts a multipart upload to the object key of bucket.
+func (d *driver) initMulti(bucket *s3.Bucket, key string) (*s3.Multi, error) {
+	if options, ok := d.SSE.goamzOptions(); ok {
+		return bucket.InitMulti(key, d.getContentType(), getPermissions(), options)
+	}
+
+	var multi *s3.Multi
+	err := retry("POST", func() error {
+		resp, err := d.do(bucket, "POST", key, url.Values{"uploads": {""}}, d.objectHeaders(), nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		var result struct {
+			UploadID string `xml:"UploadId"`
+		}
+		if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return err
+		}
+
+		multi = &s3.Multi{Bucket: bucket, Key: key, UploadId: result.UploadID}
+		return nil
+	})
+
+	return multi, err
+}
+
+// putPart uploads data as part n of multi. The bucket is resolved again for
+// every part, so that long uploads switch to refreshed credentials.
+func (d *driver) putPart(multi *s3.Multi, n int, data []byte) (s3.Part, error) {
+	if _, ok := d.SSE.goamzOptions(); ok {
+		m := *multi
+		m.Bucket = d.bucket()
+		return m.PutPart(n, bytes.NewReader(data))
+	}
+
+	var part s3.Part
+	err := retry("PUT", func() error {
+		resp, err := d.do(d.bucket(), "PUT", multi.Key, partParams(multi, n), d.getSSECustomerHeaders(), data)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		etag := resp.Header.Get("ETag")
+		if etag == "" {
+			return fmt.Errorf("part upload succeeded with no ETag")
+		}
+
+		part = s3.Part{N: n, ETag: etag, Size: int64(len(data))}
+		return nil
+	})
+
+	return part, err
+}
+
+// putPartCopy copies byteRange of the source object, given as
+// "<bucket>/<key>", or all of it if byteRange is empty, as part n of multi.
+func (d *driver) putPartCopy(multi *s3.Multi, n int, source, byteRange string) (s3.Part, error) {
+	if options, ok := d.SSE.goamzOptions(); ok {
+		m := *multi
+		m.Bucket = d.bucket()
+		_, part, err := m.PutPartCopy(n, s3.CopyOptions{Options: options, CopySourceOptions: byteRange}, source)
+		return part, err
+	}
+
+	headers := d.getSSECustomerHeaders()
+	for k, v := range d.copySourceHeaders(source) {
+		headers[k] = v
+	}
+	if byteRange != "" {
+		headers["x-amz-copy-source-range"] = []string{byteRange}
+	}
+
+	etag, err := d.copy(d.bucket(), multi.Key, partParams(multi, n), headers)
+	if err != nil {
+		return s3.Part{}, err
+	}
+
+	return s3.Part{N: n, ETag: etag}, nil
+}
+
+// copy sends a copy request to the object key of bucket and returns the ETag
+// of the copy. S3 may report a failed copy in the body of a successful
+// response, which is returned as an *s3.Error as well.
+func (d *driver) copy(bucket *s3.Bucket, key string, params url.Values, headers http.Header) (string, error) {
+	var etag string
+	err := retry("PUT", func() error {
+		resp, err := d.do(bucket, "PUT", key, params, headers, nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		var result struct {
+			ETag    string
+			Code    string
+			Message string
+		}
+		if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return err
+		}
+
+		if result.Code != "" {
+			return &s3.Error{StatusCode: resp.StatusCode, Code: result.Code, Message: result.Message}
+		}
+		if result.ETag == "" {
+			return fmt.Errorf("copy succeeded with no ETag")
+		}
+
+		etag = result.ETag
+		return nil
+	})
+
+	return etag, err
+}
+
+// do sends a request for the object key of bucket, with the subresources in
+// params, the headers and body, to a URL presigned by goamz. Error responses
+// are returned as an *s3.Error.
+func (d *driver) do(bucket *s3.Bucket, method, key string, params url.Values, headers http.Header, body []byte) (*http.Response, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+
+	u := bucket.SignedURLWithMethod(method, key, time.Now().Add(requestExpiry), params, headers)
+
+	var r io.Reader
+	if len(body) > 0 {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+
+	resp, err := presignedClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+
+		s3Err := &s3.Error{}
+		xml.NewDecoder(resp.Body).Decode(s3Err)
+		s3Err.StatusCode = resp.StatusCode
+		if s3Err.Message == "" {
+			s3Err.Message = resp.Status
+		}
+		return nil, s3Err
+	}
+
+	return resp, nil
+}
+
+// retry calls f, which sends a request with method, until it succeeds, fails
+// for good or requestAttempts runs out.
+func retry(method string, f func() error) error {
+	var err error
+	for attempt := requestAttempts.Start(); attempt.Next(); {
+		err = f()
+		if !shouldRetry(method, err) || !attempt.HasNext() {
+			break
+		}
+	}
+
+	return err
+}
+
+// shouldRetry returns true if a request sent with method failed with a
+// transient error: a server error, or a failure to send a request other than
+// a POST, which is not idempotent.
+func shouldRetry(method string, err error) bool {
+	switch err := err.(type) {
+	case *s3.Error:
+		return err.StatusCode >= 500
+	case *url.Error:
+		return method != "POST"
+	}
+
+	return false
+}
+
+// objectHeaders returns the headers of the requests creating objects.
+func (d *driver) objectHeaders() http.Header {
+	headers := d.SSE.headers()
+	headers["Content-Type"] = []string{d.getContentType()}
+	headers["x-amz-acl"] = []string{string(getPermissions())}
+	return headers
+}
+
+// copySourceHeaders returns the headers of the source object, given as
+// "<bucket>/<key>", of a copy.
+func (d *driver) copySourceHeaders(source string) http.Header {
+	headers := d.SSE.customerHeaders(sseCopySourceCustomerPrefix)
+	headers["x-amz-copy-source"] = []string{url.QueryEscape(source)}
+	return headers
+}
+
+// partParams returns the subresources of part n of multi.
+func partParams(multi *s3.Multi, n int) url.Values {
+	return url.Values{
+		"uploadId":   {multi.UploadId},
+		"partNumber": {strconv.Itoa(n)},
+	}
+}
+
+// virtualHostEndpoint returns the endpoint addressing the bucket in the host
+// name, as "${bucket}.<host>", for the S3 endpoint.
+func virtualHostEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("Invalid S3 endpoint: %q", endpoint)
+	}
+
+	u.Host = "${bucket}." + u.Host
+	return strings.Replace(u.String(), "$%7Bbucket%7D", "${bucket}", 1), nil
+}
+
+// encryptionOptions returns the encryption of the objects written as
+// configured by params.
+func encryptionOptions(params DriverParameters) (serverSideEncryption, error) {
+	mode := strings.ToLower(params.EncryptionMode)
+	if mode == "" && params.Encrypt {
+		mode = encryptionAES256
+		if params.KeyID != "" {
+			mode = encryptionKMS
+		}
+	}
+
+	if params.KeyID != "" && mode != encryptionKMS {
+		return serverSideEncryption{}, fmt.Errorf("The keyid parameter requires the kms encryption mode")
+	}
+	if params.CustomerKey != "" && mode != encryptionSSEC {
+		return serverSideEncryption{}, fmt.Errorf("The customerkey parameter requires the sse-c encryption mode")
+	}
+
+	switch mode {
+	case "", encryptionAES256:
+		return serverSideEncryption{mode: mode}, nil
+	case encryptionKMS:
+		return serverSideEncryption{mode: mode, keyID: params.KeyID}, nil
+	case encryptionSSEC:
+		key, err := base64.StdEncoding.DecodeString(params.CustomerKey)
+		if err != nil || len(key) != 32 {
+			return serverSideEncryption{}, fmt.Errorf("The customerkey parameter should be a base64 encoded 256 bits key")
+		}
+		sum := md5.Sum(key)
+		return serverSideEncryption{
+			mode:           mode,
+			customerKey:    params.CustomerKey,
+			customerKeyMD5: base64.StdEncoding.EncodeToString(sum[:]),
+		}, nil
+	}
+
+	return serverSideEncryption{}, fmt.Errorf("Invalid encryption mode %q, should be one of %s, %s or %s", params.EncryptionMode, encryptionAES256, encryptionKMS, encryptionSSEC)
+}
+
+// setCredentials replaces the S3 client with one signing requests with the
+// given credentials. The caller must hold d.mu, or be the only user of d.
+func (d *driver) setCredentials(bucketName string, creds credentials) {
+	d.credentials = creds
+	d.S3 = s3.New(creds.auth(), d.region)
+	d.S3.Signature = d.signature
+	d.Bucket = d.S3.Bucket(bucketName)
+}
+
+// bucket returns the bucket to send requests to, refreshing the credentials
+// first if they are about to expire. The refresh is done without holding
+// d.mu, so that the other requests go on with the current credentials
+// meanwhile. If it fails, the current credentials are used until a retry
+// succeeds.
+func (d *driver) bucket() *s3.Bucket {
+	d.mu.Lock()
+	now := time.Now()
+	if d.refreshing || !d.credentials.expiring(now) || now.Before(d.retryRefresh) {
+		defer d.mu.Unlock()
+		return d.Bucket
+	}
+	d.refreshing = true
+	d.mu.Unlock()
+
+	creds, err := resolveCredentials(d.credentialChain)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.refreshing = false
+	if err != nil {
+		context.GetLogger(context.Background()).Errorf("s3: error refreshing credentials, retrying in %v: %v", credentialsRetryInterval, err)
+		d.retryRefresh = time.Now().Add(credentialsRetryInterval)
+	} else {
+		d.setCredentials(d.Bucket.Name, creds)
+	}
+
+	return d.Bucket
 }
 
 func (d *driver) s3Path(path string) string {
@@ -713,8 +1326,10 @@ func hasCode(err error, code string) bool {
 	return ok && s3err.Code == code
 }
 
-func (d *driver) getOptions() s3.Options {
-	return s3.Options{SSE: d.Encrypt}
+// getSSECustomerHeaders returns the headers of the customer-provided
+// encryption key, if any, to read objects with.
+func (d *driver) getSSECustomerHeaders() http.Header {
+	return d.SSE.customerHeaders(sseCustomerPrefix)
 }
 
 func getPermissions() s3.ACL {
@@ -1,9 +1,16 @@
 package s3
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/AdRoll/goamz/aws"
@@ -13,6 +20,9 @@ import (
 	"gopkg.in/check.v1"
 )
 
+// testCustomerKey is the key used to test the sse-c encryption mode.
+var testCustomerKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
 // Hook up gocheck into the "go test" runner.
 func Test(t *testing.T) { check.TestingT(t) }
 
@@ -67,6 +77,12 @@ func init() {
 			v4AuthBool,
 			minChunkSize,
 			rootDirectory,
+			"",
+			true,
+			false,
+			"",
+			"",
+			"",
 		}
 
 		return New(parameters)
@@ -92,6 +108,53 @@ func init() {
 
 	RegisterS3DriverSuite(s3DriverConstructor, skipCheck)
 
+	// Run the suites against a local S3 compatible service as well, which
+	// must be addressed through a region endpoint.
+	fake := httptest.NewServer(newFakeS3("registry"))
+	fakeDriverConstructor := func(rootDirectory string) (*Driver, error) {
+		return FromParameters(map[string]interface{}{
+			"accesskey":        "accesskey",
+			"secretkey":        "secretkey",
+			"region":           "local",
+			"regionendpoint":   fake.URL,
+			"bucket":           "registry",
+			"secure":           false,
+			"signatureversion": 4,
+			"chunksize":        int64(minChunkSize),
+			"rootdirectory":    rootDirectory,
+		})
+	}
+
+	testsuites.RegisterInProcessSuite(func() (storagedriver.StorageDriver, error) {
+		return fakeDriverConstructor(root)
+	}, testsuites.NeverSkip)
+
+	RegisterS3DriverSuite(fakeDriverConstructor, testsuites.NeverSkip)
+
+	// The suites run with each of the encryption modes needing other
+	// headers, which the fake checks.
+	for _, encryption := range []map[string]interface{}{
+		{"encryptionmode": "kms", "keyid": "registry-key"},
+		{"encryptionmode": "sse-c", "customerkey": testCustomerKey},
+	} {
+		encryption := encryption
+		testsuites.RegisterInProcessSuite(func() (storagedriver.StorageDriver, error) {
+			parameters := map[string]interface{}{
+				"accesskey":        "accesskey",
+				"secretkey":        "secretkey",
+				"regionendpoint":   fake.URL,
+				"bucket":           "registry",
+				"secure":           false,
+				"signatureversion": 4,
+				"rootdirectory":    root,
+			}
+			for k, v := range encryption {
+				parameters[k] = v
+			}
+			return FromParameters(parameters)
+		}, testsuites.NeverSkip)
+	}
+
 	// testsuites.RegisterIPCSuite(driverName, map[string]string{
 	// 	"accesskey": accessKey,
 	// 	"secretkey": secretKey,
@@ -148,3 +211,266 @@ func (suite *S3DriverSuite) TestEmptyRootList(c *check.C) {
 		c.Assert(storagedriver.PathRegexp.MatchString(path), check.Equals, true)
 	}
 }
+
+func TestFromParametersRegionEndpoint(t *testing.T) {
+	base := map[string]interface{}{
+		"accesskey":       "accesskey",
+		"secretkey":       "secretkey",
+		"bucket":          "registry",
+		"skipbucketcheck": true,
+	}
+	withParameters := func(extra map[string]interface{}) map[string]interface{} {
+		parameters := make(map[string]interface{})
+		for k, v := range base {
+			parameters[k] = v
+		}
+		for k, v := range extra {
+			parameters[k] = v
+		}
+		return parameters
+	}
+
+	for _, parameters := range []map[string]interface{}{
+		withParameters(nil),
+		withParameters(map[string]interface{}{"region": "local"}),
+		withParameters(map[string]interface{}{"regionendpoint": "http://localhost:9000", "pathstyle": "yes"}),
+		withParameters(map[string]interface{}{"regionendpoint": "http://localhost:9000", "signatureversion": 3}),
+		withParameters(map[string]interface{}{"regionendpoint": "http://localhost:9000", "signatureversion": "2", "v4auth": true}),
+		withParameters(map[string]interface{}{"regionendpoint": "http://localhost:9000", "skipbucketcheck": "true"}),
+	} {
+		if _, err := FromParameters(parameters); err == nil {
+			t.Errorf("expected error for parameters %v", parameters)
+		}
+	}
+
+	d, err := FromParameters(withParameters(map[string]interface{}{
+		"regionendpoint":   "localhost:9000",
+		"pathstyle":        false,
+		"signatureversion": "2",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	s3 := d.baseEmbed.Base.StorageDriver.(*driver).S3
+	if s3.Region.Name != "us-east-1" {
+		t.Errorf("unexpected region name: %q", s3.Region.Name)
+	}
+	if s3.Region.S3Endpoint != "https://localhost:9000" {
+		t.Errorf("unexpected endpoint: %q", s3.Region.S3Endpoint)
+	}
+	if s3.Region.S3BucketEndpoint != "https://${bucket}.localhost:9000" {
+		t.Errorf("unexpected bucket endpoint: %q", s3.Region.S3BucketEndpoint)
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	fake := newFakeS3("registry")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	newDriver := func(encryption map[string]interface{}) (*Driver, error) {
+		parameters := map[string]interface{}{
+			"accesskey":      "accesskey",
+			"secretkey":      "secretkey",
+			"regionendpoint": server.URL,
+			"bucket":         "registry",
+			"secure":         false,
+		}
+		for k, v := range encryption {
+			parameters[k] = v
+		}
+		return FromParameters(parameters)
+	}
+
+	for _, encryption := range []map[string]interface{}{
+		{"keyid": "registry-key", "v4auth": true},
+		{"encryptionmode": "kms"},
+		{"encryptionmode": "aes256", "encrypt": false},
+		{"encryptionmode": "sse-c"},
+		{"encryptionmode": "sse-c", "customerkey": "c2hvcnQ="},
+		{"encryptionmode": "aes256", "customerkey": testCustomerKey},
+		{"encryptionmode": "des"},
+	} {
+		if _, err := newDriver(encryption); err == nil {
+			t.Errorf("expected error for encryption parameters %v", encryption)
+		}
+	}
+
+	customerKey, _ := base64.StdEncoding.DecodeString(testCustomerKey)
+	customerKeyMD5 := md5.Sum(customerKey)
+
+	for _, testcase := range []struct {
+		parameters map[string]interface{}
+		expected   fakeEncryption
+	}{
+		{
+			parameters: map[string]interface{}{"encrypt": false},
+			expected:   fakeEncryption{},
+		},
+		{
+			parameters: map[string]interface{}{"encrypt": true},
+			expected:   fakeEncryption{mode: "AES256"},
+		},
+		{
+			parameters: map[string]interface{}{"encrypt": true, "keyid": "registry-key", "v4auth": true},
+			expected:   fakeEncryption{mode: "aws:kms", keyID: "registry-key"},
+		},
+		{
+			parameters: map[string]interface{}{"encryptionmode": "kms", "signatureversion": 4},
+			expected:   fakeEncryption{mode: "aws:kms", keyID: "aws/s3"},
+		},
+		{
+			parameters: map[string]interface{}{"encryptionmode": "sse-c", "customerkey": testCustomerKey},
+			expected:   fakeEncryption{mode: "SSE-C", customerKeyMD5: base64.StdEncoding.EncodeToString(customerKeyMD5[:])},
+		},
+	} {
+		fake.mu.Lock()
+		fake.objects = make(map[string]*fakeObject)
+		fake.mu.Unlock()
+
+		d, err := newDriver(testcase.parameters)
+		if err != nil {
+			t.Fatalf("unexpected error creating driver with %v: %v", testcase.parameters, err)
+		}
+
+		contents := bytes.Repeat([]byte("registry"), (minChunkSize+minChunkSize/2)/8)
+		if err := d.PutContent("/content", contents); err != nil {
+			t.Fatalf("unexpected error writing content with %v: %v", testcase.parameters, err)
+		}
+
+		// Resuming a stream larger than a part copies the written part.
+		if _, err := d.WriteStream("/stream", 0, bytes.NewReader(contents)); err != nil {
+			t.Fatalf("unexpected error writing stream with %v: %v", testcase.parameters, err)
+		}
+		if _, err := d.WriteStream("/stream", int64(len(contents)), bytes.NewReader(contents)); err != nil {
+			t.Fatalf("unexpected error resuming stream with %v: %v", testcase.parameters, err)
+		}
+
+		if err := d.Move("/content", "/moved"); err != nil {
+			t.Fatalf("unexpected error moving content with %v: %v", testcase.parameters, err)
+		}
+
+		stream, err := d.GetContent("/stream")
+		if err != nil {
+			t.Fatalf("unexpected error reading stream with %v: %v", testcase.parameters, err)
+		}
+		if !bytes.Equal(stream, append(contents, contents...)) {
+			t.Errorf("unexpected stream contents with %v", testcase.parameters)
+		}
+
+		fake.mu.Lock()
+		if len(fake.objects) != 2 {
+			t.Errorf("unexpected objects with %v: %v", testcase.parameters, fake.objects)
+		}
+		for key, obj := range fake.objects {
+			if obj.encryption != testcase.expected {
+				t.Errorf("unexpected encryption of %s with %v: %+v != %+v", key, testcase.parameters, obj.encryption, testcase.expected)
+			}
+		}
+		fake.mu.Unlock()
+
+		if testcase.expected.mode != "SSE-C" {
+			continue
+		}
+
+		if _, err := d.URLFor("/moved", nil); err != storagedriver.ErrUnsupportedMethod {
+			t.Errorf("unexpected error getting url of object encrypted with a customer-provided key: %v", err)
+		}
+
+		unencrypted, err := newDriver(nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating driver: %v", err)
+		}
+		if _, err := unencrypted.GetContent("/moved"); err == nil {
+			t.Errorf("expected error reading object encrypted with a customer-provided key without it")
+		}
+	}
+}
+
+// flakyS3 fails the first attempt of every request writing to the wrapped
+// service, as S3 does now and then.
+type flakyS3 struct {
+	http.Handler
+
+	mu       sync.Mutex
+	failNext bool
+	failures int
+}
+
+func (f *flakyS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "PUT" || r.Method == "POST" {
+		f.mu.Lock()
+		fail := !f.failNext
+		f.failNext = fail
+		if fail {
+			f.failures++
+		}
+		f.mu.Unlock()
+
+		if fail {
+			io.Copy(ioutil.Discard, r.Body)
+			writeS3Error(w, http.StatusInternalServerError, "InternalError")
+			return
+		}
+	}
+
+	f.Handler.ServeHTTP(w, r)
+}
+
+func TestRetry(t *testing.T) {
+	for _, encryption := range []map[string]interface{}{
+		nil,
+		{"encrypt": true},
+		{"encryptionmode": "kms"},
+		{"encryptionmode": "sse-c", "customerkey": testCustomerKey},
+	} {
+		flaky := &flakyS3{Handler: newFakeS3("registry")}
+		server := httptest.NewServer(flaky)
+
+		parameters := map[string]interface{}{
+			"accesskey":        "accesskey",
+			"secretkey":        "secretkey",
+			"regionendpoint":   server.URL,
+			"bucket":           "registry",
+			"secure":           false,
+			"signatureversion": 4,
+		}
+		for k, v := range encryption {
+			parameters[k] = v
+		}
+
+		d, err := FromParameters(parameters)
+		if err != nil {
+			t.Fatalf("unexpected error creating driver with %v: %v", encryption, err)
+		}
+
+		contents := bytes.Repeat([]byte("registry"), (minChunkSize+minChunkSize/2)/8)
+		if err := d.PutContent("/content", contents); err != nil {
+			t.Fatalf("unexpected error writing content with %v: %v", encryption, err)
+		}
+		if _, err := d.WriteStream("/stream", 0, bytes.NewReader(contents)); err != nil {
+			t.Fatalf("unexpected error writing stream with %v: %v", encryption, err)
+		}
+		if _, err := d.WriteStream("/stream", int64(len(contents)), bytes.NewReader(contents)); err != nil {
+			t.Fatalf("unexpected error resuming stream with %v: %v", encryption, err)
+		}
+		if err := d.Move("/content", "/moved"); err != nil {
+			t.Fatalf("unexpected error moving content with %v: %v", encryption, err)
+		}
+
+		stream, err := d.GetContent("/stream")
+		if err != nil {
+			t.Fatalf("unexpected error reading stream with %v: %v", encryption, err)
+		}
+		if !bytes.Equal(stream, append(contents, contents...)) {
+			t.Errorf("unexpected stream contents with %v", encryption)
+		}
+
+		if flaky.failures == 0 {
+			t.Errorf("no request failed with %v", encryption)
+		}
+
+		server.Close()
+	}
+}
@@ -0,0 +1,118 @@
+package swift
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// authenticate obtains a token and the URL of the object storage account,
+// using the v2.0 Keystone API if the auth URL names it and the v1.0 Swift
+// auth API otherwise.
+func (d *driver) authenticate() (storageURL, token string, err error) {
+	if strings.HasSuffix(strings.TrimRight(d.authURL, "/"), "v2.0") {
+		return d.authenticateKeystone()
+	}
+	return d.authenticateV1()
+}
+
+// authenticateV1 authenticates against the v1.0 auth API of Swift.
+func (d *driver) authenticateV1() (string, string, error) {
+	req, err := http.NewRequest("GET", d.authURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	user := d.username
+	if d.tenant != "" {
+		user = d.tenant + ":" + d.username
+	}
+	req.Header.Set("X-Auth-User", user)
+	req.Header.Set("X-Auth-Key", d.password)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", "", fmt.Errorf("swift: authentication failed: %s", resp.Status)
+	}
+
+	storageURL, token := resp.Header.Get("X-Storage-Url"), resp.Header.Get("X-Auth-Token")
+	if storageURL == "" || token == "" {
+		return "", "", fmt.Errorf("swift: no storage url or token in authentication response")
+	}
+
+	return storageURL, token, nil
+}
+
+// authenticateKeystone authenticates against the v2.0 Keystone API, looking
+// up the object store endpoint of the configured region in the service
+// catalog.
+func (d *driver) authenticateKeystone() (string, string, error) {
+	var request struct {
+		Auth struct {
+			PasswordCredentials struct {
+				Username string `json:"username"`
+				Password string `json:"password"`
+			} `json:"passwordCredentials"`
+			TenantName string `json:"tenantName,omitempty"`
+		} `json:"auth"`
+	}
+	request.Auth.PasswordCredentials.Username = d.username
+	request.Auth.PasswordCredentials.Password = d.password
+	request.Auth.TenantName = d.tenant
+
+	p, err := json.Marshal(request)
+	if err != nil {
+		return "", "", err
+	}
+
+	resp, err := d.client.Post(strings.TrimRight(d.authURL, "/")+"/tokens", "application/json", bytes.NewReader(p))
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", "", fmt.Errorf("swift: authentication failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var response struct {
+		Access struct {
+			Token struct {
+				ID string `json:"id"`
+			} `json:"token"`
+			ServiceCatalog []struct {
+				Type      string `json:"type"`
+				Endpoints []struct {
+					Region    string `json:"region"`
+					PublicURL string `json:"publicURL"`
+				} `json:"endpoints"`
+			} `json:"serviceCatalog"`
+		} `json:"access"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", "", err
+	}
+
+	for _, service := range response.Access.ServiceCatalog {
+		if service.Type != "object-store" {
+			continue
+		}
+
+		for _, endpoint := range service.Endpoints {
+			if d.region == "" || endpoint.Region == d.region {
+				return endpoint.PublicURL, response.Access.Token.ID, nil
+			}
+		}
+	}
+
+	return "", "", fmt.Errorf("swift: no object-store endpoint found for region %q", d.region)
+}
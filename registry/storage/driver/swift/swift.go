@@ -0,0 +1,967 @@
+// Package swift provides a storagedriver.StorageDriver implementation to
+// store blobs in OpenStack Swift object storage.
+//
+// The driver talks to the Swift API directly, authenticating with either the
+// v1.0 Swift auth API or the v2.0 Keystone API.
+//
+// Streams are written as Dynamic Large Objects: the content is uploaded in
+// segments to a separate "<container>_segments" container, and the object
+// itself is a manifest concatenating them. Appending to an object uploads new
+// segments only, so that resuming a layer upload does not transfer the data
+// already written again. Writes at any other offset rewrite the object into
+// a new set of segments.
+//
+// Because Swift is a key, value store the Stat call does not support last
+// modification time for directories (directories are an abstraction for key,
+// value stores).
+package swift
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/base"
+	"github.com/docker/distribution/registry/storage/driver/factory"
+	"github.com/docker/distribution/registry/storage/driver/internal/driverutil"
+)
+
+const driverName = "swift"
+
+// minChunkSize is the smallest segment size accepted for large objects.
+const minChunkSize = 1 << 20
+
+const defaultChunkSize = 20 * minChunkSize
+
+// listMax is the largest amount of objects you can request from Swift in a
+// list call
+const listMax = 10000
+
+// DriverParameters A struct that encapsulates all of the driver parameters after all values have been set
+type DriverParameters struct {
+	Username      string
+	Password      string
+	AuthURL       string
+	Tenant        string
+	Region        string
+	Container     string
+	TempURLKey    string
+	ChunkSize     int64
+	RootDirectory string
+}
+
+func init() {
+	factory.Register(driverName, &swiftDriverFactory{})
+}
+
+// swiftDriverFactory implements the factory.StorageDriverFactory interface
+type swiftDriverFactory struct{}
+
+func (factory *swiftDriverFactory) Create(parameters map[string]interface{}) (storagedriver.StorageDriver, error) {
+	return FromParameters(parameters)
+}
+
+type driver struct {
+	client            *http.Client
+	authURL           string
+	username          string
+	password          string
+	tenant            string
+	region            string
+	container         string
+	segmentsContainer string
+	tempURLKey        string
+	chunkSize         int64
+	rootDirectory     string
+
+	mu         sync.Mutex
+	storageURL string
+	token      string
+}
+
+type baseEmbed struct {
+	base.Base
+}
+
+// Driver is a storagedriver.StorageDriver implementation backed by OpenStack
+// Swift. Objects are stored at absolute keys in the provided container.
+type Driver struct {
+	baseEmbed
+}
+
+// FromParameters constructs a new Driver with a given parameters map
+// Required parameters:
+// - username
+// - password
+// - authurl
+// - container
+// Optional parameters:
+// - tenant
+// - region
+// - tempurlkey
+// - chunksize
+// - rootdirectory
+func FromParameters(parameters map[string]interface{}) (*Driver, error) {
+	var params DriverParameters
+
+	for _, required := range []struct {
+		name  string
+		value *string
+	}{
+		{"username", &params.Username},
+		{"password", &params.Password},
+		{"authurl", &params.AuthURL},
+		{"container", &params.Container},
+	} {
+		v, ok := parameters[required.name]
+		if !ok || fmt.Sprint(v) == "" {
+			return nil, fmt.Errorf("No %s parameter provided", required.name)
+		}
+		*required.value = fmt.Sprint(v)
+	}
+
+	for _, optional := range []struct {
+		name  string
+		value *string
+	}{
+		{"tenant", &params.Tenant},
+		{"region", &params.Region},
+		{"tempurlkey", &params.TempURLKey},
+		{"rootdirectory", &params.RootDirectory},
+	} {
+		if v, ok := parameters[optional.name]; ok {
+			*optional.value = fmt.Sprint(v)
+		}
+	}
+
+	params.ChunkSize = defaultChunkSize
+	chunkSizeParam, ok := parameters["chunksize"]
+	if ok {
+		switch v := chunkSizeParam.(type) {
+		case int:
+			params.ChunkSize = int64(v)
+		case int64:
+			params.ChunkSize = v
+		default:
+			return nil, fmt.Errorf("The chunksize parameter should be a number")
+		}
+
+		if params.ChunkSize < minChunkSize {
+			return nil, fmt.Errorf("The chunksize parameter should be a number that is larger than %d", minChunkSize)
+		}
+	}
+
+	return New(params)
+}
+
+// New constructs a new Driver with the given OpenStack credentials and
+// container, creating the containers if they do not exist.
+func New(params DriverParameters) (*Driver, error) {
+	if params.ChunkSize == 0 {
+		params.ChunkSize = defaultChunkSize
+	}
+
+	d := &driver{
+		client:            http.DefaultClient,
+		authURL:           params.AuthURL,
+		username:          params.Username,
+		password:          params.Password,
+		tenant:            params.Tenant,
+		region:            params.Region,
+		container:         params.Container,
+		segmentsContainer: params.Container + "_segments",
+		tempURLKey:        params.TempURLKey,
+		chunkSize:         params.ChunkSize,
+		rootDirectory:     params.RootDirectory,
+	}
+
+	for _, container := range []string{d.container, d.segmentsContainer} {
+		req, err := d.newRequest("PUT", container, "")
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := d.do(req, nil)
+		if err != nil {
+			return nil, err
+		}
+		driverutil.Drain(resp)
+	}
+
+	return &Driver{
+		baseEmbed: baseEmbed{
+			Base: base.Base{
+				StorageDriver: d,
+			},
+		},
+	}, nil
+}
+
+// Implement the storagedriver.StorageDriver interface
+
+func (d *driver) Name() string {
+	return driverName
+}
+
+// GetContent retrieves the content stored at "path" as a []byte.
+func (d *driver) GetContent(path string) ([]byte, error) {
+	rc, err := d.ReadStream(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
+}
+
+// PutContent stores the []byte content at a location designated by "path".
+func (d *driver) PutContent(path string, contents []byte) error {
+	name := d.objectName(path)
+
+	old, err := d.head(name)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	if err := d.putObject(d.container, name, contents, nil); err != nil {
+		return parseError(path, err)
+	}
+
+	if old != nil && old.manifest != "" {
+		d.deleteSegments(old.manifest)
+	}
+
+	return nil
+}
+
+// ReadStream retrieves an io.ReadCloser for the content stored at "path" with a
+// given byte offset.
+func (d *driver) ReadStream(path string, offset int64) (io.ReadCloser, error) {
+	rc, err := d.readObject(d.objectName(path), offset)
+	if err != nil {
+		return nil, parseError(path, err)
+	}
+
+	return rc, nil
+}
+
+// WriteStream stores the contents of the provided io.ReadCloser at a
+// location designated by the given path. The driver will know it has
+// received the full contents when the reader returns io.EOF. The number
+// of successfully READ bytes will be returned, even if an error is
+// returned. May be used to resume writing a stream by providing a nonzero
+// offset. Offsets past the current size will write from the position
+// beyond the end of the file, filling the gap with zeros.
+func (d *driver) WriteStream(path string, offset int64, reader io.Reader) (totalRead int64, err error) {
+	name := d.objectName(path)
+
+	obj, err := d.head(name)
+	if err != nil {
+		if !isNotFound(err) {
+			return 0, err
+		}
+		obj = &objectInfo{}
+	}
+
+	if offset == 0 {
+		nn, err := d.writeLargeObject(name, obj, reader)
+		return nn, parseError(path, err)
+	}
+
+	if obj.manifest != "" && offset >= obj.size {
+		return d.append(path, name, obj, offset, reader)
+	}
+
+	return d.rewrite(path, name, obj, offset, reader)
+}
+
+// append uploads the contents of reader as new segments of the large object
+// obj, after filling the gap between its end and offset with zeros.
+func (d *driver) append(path, name string, obj *objectInfo, offset int64, reader io.Reader) (int64, error) {
+	segments, err := d.listAll(d.segmentsContainer, segmentsPrefix(obj.manifest), "")
+	if err != nil {
+		return 0, err
+	}
+
+	counter := &driverutil.CountingReader{Reader: reader}
+	r := io.MultiReader(io.LimitReader(driverutil.ZeroReader{}, offset-obj.size), counter)
+
+	if _, err := d.uploadSegments(obj.manifest, len(segments), r); err != nil {
+		return counter.N, parseError(path, err)
+	}
+
+	// Writing the manifest again updates the modification time of the
+	// object.
+	if err := d.putManifest(name, obj.manifest); err != nil {
+		return counter.N, parseError(path, err)
+	}
+
+	return counter.N, nil
+}
+
+// rewrite writes obj again as a new large object with the contents of reader
+// written at offset, keeping the existing data before and after them. Any gap
+// between the end of obj and offset is filled with zeros.
+func (d *driver) rewrite(path, name string, obj *objectInfo, offset int64, reader io.Reader) (int64, error) {
+	var readers []io.Reader
+
+	if keep := driverutil.Min(offset, obj.size); keep > 0 {
+		head, err := d.readObject(name, 0)
+		if err != nil {
+			return 0, parseError(path, err)
+		}
+		defer head.Close()
+
+		readers = append(readers, io.LimitReader(head, keep))
+	}
+
+	if offset > obj.size {
+		readers = append(readers, io.LimitReader(driverutil.ZeroReader{}, offset-obj.size))
+	}
+
+	counter := &driverutil.CountingReader{Reader: reader}
+	readers = append(readers, counter)
+
+	// The tail of obj not overwritten by reader can only be located once
+	// reader is exhausted.
+	tail := &driverutil.LazyReader{Open: func() (io.ReadCloser, error) {
+		start := offset + counter.N
+		if start >= obj.size {
+			return ioutil.NopCloser(bytes.NewReader(nil)), nil
+		}
+		return d.readObject(name, start)
+	}}
+	defer tail.Close()
+	readers = append(readers, tail)
+
+	if _, err := d.writeLargeObject(name, obj, io.MultiReader(readers...)); err != nil {
+		return counter.N, parseError(path, err)
+	}
+
+	return counter.N, nil
+}
+
+// writeLargeObject uploads the contents of reader to a new set of segments
+// and points the manifest name at them, replacing obj. The segments of obj,
+// if any, are deleted afterwards.
+func (d *driver) writeLargeObject(name string, obj *objectInfo, reader io.Reader) (int64, error) {
+	manifest, err := d.newManifest()
+	if err != nil {
+		return 0, err
+	}
+
+	nn, err := d.uploadSegments(manifest, 0, reader)
+	if err == nil {
+		err = d.putManifest(name, manifest)
+	}
+
+	if err != nil {
+		d.deleteSegments(manifest)
+		return nn, err
+	}
+
+	if obj.manifest != "" {
+		d.deleteSegments(obj.manifest)
+	}
+
+	return nn, nil
+}
+
+// Stat retrieves the FileInfo for the given path, including the current size
+// in bytes and the creation time.
+func (d *driver) Stat(path string) (storagedriver.FileInfo, error) {
+	fi := storagedriver.FileInfoFields{
+		Path: path,
+	}
+
+	obj, err := d.head(d.objectName(path))
+	switch {
+	case err == nil:
+		fi.Size = obj.size
+		fi.ModTime = obj.modTime
+	case isNotFound(err):
+		objects, err := d.list(d.container, d.objectName(path)+"/", "", "", 1)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(objects) == 0 {
+			return nil, storagedriver.PathNotFoundError{Path: path}
+		}
+		fi.IsDir = true
+	default:
+		return nil, err
+	}
+
+	return storagedriver.FileInfoInternal{FileInfoFields: fi}, nil
+}
+
+// List returns a list of the objects that are direct descendants of the given path.
+func (d *driver) List(path string) ([]string, error) {
+	prefix := d.objectName(path)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	objects, err := d.listAll(d.container, prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	directories := []string{}
+	for _, obj := range objects {
+		if obj.Subdir != "" {
+			directories = append(directories, d.keyToPath(strings.TrimSuffix(obj.Subdir, "/")))
+		} else {
+			files = append(files, d.keyToPath(obj.Name))
+		}
+	}
+
+	if path != "/" && len(files) == 0 && len(directories) == 0 {
+		return nil, storagedriver.PathNotFoundError{Path: path}
+	}
+
+	return append(files, directories...), nil
+}
+
+// Move moves an object stored at sourcePath to destPath, removing the original
+// object. Large objects are moved by pointing a new manifest at their
+// segments.
+func (d *driver) Move(sourcePath string, destPath string) error {
+	source, dest := d.objectName(sourcePath), d.objectName(destPath)
+
+	src, err := d.head(source)
+	if err != nil {
+		return parseError(sourcePath, err)
+	}
+
+	old, err := d.head(dest)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	if src.manifest != "" {
+		err = d.putManifest(dest, src.manifest)
+	} else {
+		err = d.putObject(d.container, dest, nil, http.Header{
+			"X-Copy-From": {"/" + d.container + "/" + driverutil.EscapePath(source)},
+		})
+	}
+	if err != nil {
+		return parseError(sourcePath, err)
+	}
+
+	if err := d.deleteObject(d.container, source); err != nil {
+		return parseError(sourcePath, err)
+	}
+
+	if old != nil && old.manifest != "" && old.manifest != src.manifest {
+		d.deleteSegments(old.manifest)
+	}
+
+	return nil
+}
+
+// Delete recursively deletes all objects stored at "path" and its subpaths.
+func (d *driver) Delete(path string) error {
+	name := d.objectName(path)
+
+	objects, err := d.listAll(d.container, name+"/", "")
+	if err != nil {
+		return err
+	}
+
+	// manifests maps the names of the objects to delete to their manifest,
+	// so that the segments of large objects are deleted with them.
+	manifests := make(map[string]string, len(objects)+1)
+	if obj, err := d.head(name); err == nil {
+		manifests[name] = obj.manifest
+	} else if !isNotFound(err) {
+		return err
+	}
+
+	for _, obj := range objects {
+		manifests[obj.Name] = ""
+
+		// Only manifests, which are empty objects, can have segments.
+		if obj.Bytes == 0 {
+			if info, err := d.head(obj.Name); err == nil {
+				manifests[obj.Name] = info.manifest
+			}
+		}
+	}
+
+	if len(manifests) == 0 {
+		return storagedriver.PathNotFoundError{Path: path}
+	}
+
+	for name, manifest := range manifests {
+		if err := d.deleteObject(d.container, name); err != nil && !isNotFound(err) {
+			return err
+		}
+
+		if manifest != "" {
+			d.deleteSegments(manifest)
+		}
+	}
+
+	return nil
+}
+
+// URLFor returns a URL which may be used to retrieve the content stored at the given path.
+// May return an UnsupportedMethodErr in certain StorageDriver implementations.
+func (d *driver) URLFor(path string, options map[string]interface{}) (string, error) {
+	if d.tempURLKey == "" {
+		// Temporary URLs are signed with the key set on the account.
+		return "", storagedriver.ErrUnsupportedMethod
+	}
+
+	methodString := "GET"
+	method, ok := options["method"]
+	if ok {
+		methodString, ok = method.(string)
+		if !ok || (methodString != "GET" && methodString != "HEAD") {
+			return "", storagedriver.ErrUnsupportedMethod
+		}
+	}
+
+	expiresTime := time.Now().Add(20 * time.Minute)
+	expires, ok := options["expiry"]
+	if ok {
+		et, ok := expires.(time.Time)
+		if ok {
+			expiresTime = et
+		}
+	}
+
+	storageURL, _, err := d.credentials()
+	if err != nil {
+		return "", err
+	}
+
+	u, p, err := resolve(storageURL, "/"+driverutil.Escape(d.container)+"/"+driverutil.EscapePath(d.objectName(path)))
+	if err != nil {
+		return "", err
+	}
+
+	expiry := strconv.FormatInt(expiresTime.Unix(), 10)
+
+	mac := hmac.New(sha1.New, []byte(d.tempURLKey))
+	mac.Write([]byte(methodString + "\n" + expiry + "\n" + p))
+
+	u.RawQuery = url.Values{
+		"temp_url_sig":     {hex.EncodeToString(mac.Sum(nil))},
+		"temp_url_expires": {expiry},
+	}.Encode()
+
+	return u.String(), nil
+}
+
+func (d *driver) objectName(path string) string {
+	return strings.TrimLeft(strings.TrimRight(d.rootDirectory, "/")+path, "/")
+}
+
+// keyToPath returns the storage driver path of the object name.
+func (d *driver) keyToPath(name string) string {
+	return "/" + strings.TrimPrefix(name, d.objectName("/"))
+}
+
+// SwiftObjectName returns the object name in the container for the given
+// storage driver path.
+func (d *Driver) SwiftObjectName(path string) string {
+	return d.StorageDriver.(*driver).objectName(path)
+}
+
+// objectInfo is the metadata of an object, as returned by a HEAD request.
+type objectInfo struct {
+	size    int64
+	modTime time.Time
+
+	// manifest is the "<container>/<prefix>" of the segments of a large
+	// object, empty for regular objects.
+	manifest string
+}
+
+// listEntry is an entry of a container listing. Subdir is only set for
+// the pseudo-directories rolled up by a delimiter.
+type listEntry struct {
+	Name   string `json:"name"`
+	Bytes  int64  `json:"bytes"`
+	Subdir string `json:"subdir"`
+}
+
+// head returns the metadata of the object name.
+func (d *driver) head(name string) (*objectInfo, error) {
+	req, err := d.newRequest("HEAD", d.container, name)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := d.do(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	driverutil.Drain(resp)
+
+	size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("swift: invalid Content-Length for %q: %v", name, err)
+	}
+
+	modTime, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		return nil, fmt.Errorf("swift: invalid Last-Modified for %q: %v", name, err)
+	}
+
+	return &objectInfo{
+		size:     size,
+		modTime:  modTime,
+		manifest: resp.Header.Get("X-Object-Manifest"),
+	}, nil
+}
+
+// readObject returns the content of the object name, starting at offset.
+// Reading at or past the end of the object yields no data.
+func (d *driver) readObject(name string, offset int64) (io.ReadCloser, error) {
+	req, err := d.newRequest("GET", d.container, name)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+
+	resp, err := d.do(req, nil)
+	if err != nil {
+		if swiftErr, ok := err.(*swiftError); ok && swiftErr.Code == http.StatusRequestedRangeNotSatisfiable {
+			return ioutil.NopCloser(bytes.NewReader(nil)), nil
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusPartialContent && offset > 0 {
+		// The range was ignored, skip to the offset.
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, offset); err != nil && err != io.EOF {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+
+	return resp.Body, nil
+}
+
+// list returns a page of the objects of container whose name starts with
+// prefix, following marker. With a delimiter, objects below the next
+// delimiter are rolled up into pseudo-directories.
+func (d *driver) list(container, prefix, delimiter, marker string, limit int) ([]listEntry, error) {
+	query := url.Values{
+		"format": {"json"},
+		"prefix": {prefix},
+		"limit":  {strconv.Itoa(limit)},
+	}
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	if marker != "" {
+		query.Set("marker", marker)
+	}
+
+	req, err := d.newRequest("GET", container, "")
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := d.do(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer driverutil.Drain(resp)
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+
+	var entries []listEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// listAll returns all objects of container whose name starts with prefix,
+// paging through the listing.
+func (d *driver) listAll(container, prefix, delimiter string) ([]listEntry, error) {
+	var all []listEntry
+
+	marker := ""
+	for {
+		entries, err := d.list(container, prefix, delimiter, marker, listMax)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, entries...)
+
+		if len(entries) < listMax {
+			return all, nil
+		}
+
+		last := entries[len(entries)-1]
+		marker = last.Name
+		if last.Subdir != "" {
+			marker = last.Subdir
+		}
+	}
+}
+
+// putObject creates or replaces the object name in container with
+// contents.
+func (d *driver) putObject(container, name string, contents []byte, header http.Header) error {
+	req, err := d.newRequest("PUT", container, name)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := d.do(req, contents)
+	if err != nil {
+		return err
+	}
+	driverutil.Drain(resp)
+
+	return nil
+}
+
+func (d *driver) deleteObject(container, name string) error {
+	req, err := d.newRequest("DELETE", container, name)
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.do(req, nil)
+	if err != nil {
+		return err
+	}
+	driverutil.Drain(resp)
+
+	return nil
+}
+
+// newManifest returns the manifest of a new, unique set of segments.
+func (d *driver) newManifest() (string, error) {
+	p := make([]byte, 16)
+	if _, err := rand.Read(p); err != nil {
+		return "", err
+	}
+
+	return d.segmentsContainer + "/" + hex.EncodeToString(p) + "/", nil
+}
+
+// segmentsPrefix returns the prefix of the segment names of manifest, in the
+// segments container.
+func segmentsPrefix(manifest string) string {
+	return manifest[strings.Index(manifest, "/")+1:]
+}
+
+// putManifest points the large object name at the segments of manifest.
+func (d *driver) putManifest(name, manifest string) error {
+	return d.putObject(d.container, name, nil, http.Header{
+		"X-Object-Manifest": {manifest},
+		"Content-Type":      {"application/octet-stream"},
+	})
+}
+
+// uploadSegments writes the contents of reader as segments of manifest of the
+// configured size, numbered from start. The number of bytes read from reader
+// is returned.
+func (d *driver) uploadSegments(manifest string, start int, reader io.Reader) (int64, error) {
+	prefix := segmentsPrefix(manifest)
+	buf := make([]byte, d.chunkSize)
+
+	var total int64
+	for i := start; ; i++ {
+		n, err := io.ReadFull(reader, buf)
+		total += int64(n)
+
+		if n > 0 {
+			name := fmt.Sprintf("%s%016d", prefix, i)
+			if err := d.putObject(d.segmentsContainer, name, buf[:n], nil); err != nil {
+				return total, err
+			}
+		}
+
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			return total, nil
+		default:
+			return total, err
+		}
+	}
+}
+
+// deleteSegments deletes the segments of manifest. Errors are ignored, as the
+// manifest no longer references them.
+func (d *driver) deleteSegments(manifest string) {
+	segments, err := d.listAll(d.segmentsContainer, segmentsPrefix(manifest), "")
+	if err != nil {
+		return
+	}
+
+	for _, segment := range segments {
+		d.deleteObject(d.segmentsContainer, segment.Name)
+	}
+}
+
+// credentials returns the storage URL and token, authenticating first if
+// needed.
+func (d *driver) credentials() (string, string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.token == "" {
+		storageURL, token, err := d.authenticate()
+		if err != nil {
+			return "", "", err
+		}
+		d.storageURL, d.token = strings.TrimRight(storageURL, "/"), token
+	}
+
+	return d.storageURL, d.token, nil
+}
+
+// invalidate discards token, if still current, so that the next request
+// authenticates again.
+func (d *driver) invalidate(token string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.token == token {
+		d.token = ""
+	}
+}
+
+// newRequest returns a request for the object name in container, or for the
+// container itself if name is empty. The URL only holds the escaped path,
+// kept opaque, and is resolved against the storage URL of the account when
+// the request is sent.
+func (d *driver) newRequest(method, container, name string) (*http.Request, error) {
+	p := "/" + driverutil.Escape(container)
+	if name != "" {
+		p += "/" + driverutil.EscapePath(name)
+	}
+
+	req, err := http.NewRequest(method, p, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.Opaque = p
+
+	return req, nil
+}
+
+// resolve returns the URL of the escaped path p relative to the storage URL
+// of the account, along with its full escaped path. The path is kept opaque
+// so that it is sent, and signed, exactly as escaped.
+func resolve(storageURL, p string) (*url.URL, string, error) {
+	u, err := url.Parse(storageURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	p = driverutil.EscapePath(u.Path) + p
+	u.Opaque = "//" + u.Host + p
+
+	return u, p, nil
+}
+
+// do sends req to the account with body, if any, authenticating it with the
+// current token. If the token expired, the driver authenticates again and
+// retries the request once. Responses with an error status are returned as a
+// *swiftError.
+func (d *driver) do(req *http.Request, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		storageURL, token, err := d.credentials()
+		if err != nil {
+			return nil, err
+		}
+
+		u, _, err := resolve(storageURL, req.URL.Opaque)
+		if err != nil {
+			return nil, err
+		}
+		u.RawQuery = req.URL.RawQuery
+
+		r := *req
+		r.URL = u
+		r.Host = u.Host
+		r.Header = make(http.Header, len(req.Header)+1)
+		for k, v := range req.Header {
+			r.Header[k] = v
+		}
+		r.Header.Set("X-Auth-Token", token)
+
+		if len(body) > 0 {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+		}
+
+		resp, err := d.client.Do(&r)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			driverutil.Drain(resp)
+			d.invalidate(token)
+			continue
+		}
+
+		if resp.StatusCode >= 400 {
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+			return nil, &swiftError{Code: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+		}
+
+		return resp, nil
+	}
+}
+
+// swiftError is an error response of the Swift API.
+type swiftError struct {
+	Code    int
+	Message string
+}
+
+func (err *swiftError) Error() string {
+	return fmt.Sprintf("swift: %d %s: %s", err.Code, http.StatusText(err.Code), err.Message)
+}
+
+func isNotFound(err error) bool {
+	swiftErr, ok := err.(*swiftError)
+	return ok && swiftErr.Code == http.StatusNotFound
+}
+
+func parseError(path string, err error) error {
+	if isNotFound(err) {
+		return storagedriver.PathNotFoundError{Path: path}
+	}
+
+	return err
+}
@@ -0,0 +1,629 @@
+package swift
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/testsuites"
+
+	"gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { check.TestingT(t) }
+
+const (
+	testUsername   = "registry"
+	testPassword   = "secret"
+	testTenant     = "tenant"
+	testContainer  = "registry-test"
+	testTempURLKey = "tempurl-secret"
+)
+
+func init() {
+	dir, err := ioutil.TempDir("", "fake-swift-")
+	if err != nil {
+		panic(err)
+	}
+	server := httptest.NewServer(newFakeSwift(dir))
+
+	root, err := ioutil.TempDir("", "driver-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(root)
+
+	swiftDriverConstructor := func() (storagedriver.StorageDriver, error) {
+		return New(DriverParameters{
+			Username:      testUsername,
+			Password:      testPassword,
+			AuthURL:       server.URL + "/auth/v1.0",
+			Container:     testContainer,
+			TempURLKey:    testTempURLKey,
+			ChunkSize:     minChunkSize,
+			RootDirectory: root,
+		})
+	}
+
+	testsuites.RegisterInProcessSuite(swiftDriverConstructor, testsuites.NeverSkip)
+}
+
+func TestFromParameters(t *testing.T) {
+	valid := map[string]interface{}{
+		"username":  testUsername,
+		"password":  testPassword,
+		"authurl":   "http://127.0.0.1:1/auth/v1.0",
+		"container": testContainer,
+	}
+
+	for _, missing := range []string{"username", "password", "authurl", "container"} {
+		parameters := make(map[string]interface{})
+		for k, v := range valid {
+			if k != missing {
+				parameters[k] = v
+			}
+		}
+
+		if _, err := FromParameters(parameters); err == nil || !strings.Contains(err.Error(), missing) {
+			t.Fatalf("expected error for missing %s, got %v", missing, err)
+		}
+	}
+
+	valid["chunksize"] = 1024
+	if _, err := FromParameters(valid); err == nil {
+		t.Fatalf("expected error for small chunksize")
+	}
+}
+
+// TestKeystoneAuth ensures that the driver authenticates with Keystone and
+// uses the object store endpoint of the configured region.
+func TestKeystoneAuth(t *testing.T) {
+	fake, cleanup := newTestFakeSwift(t)
+	defer cleanup()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	d, err := New(DriverParameters{
+		Username:  testUsername,
+		Password:  testPassword,
+		Tenant:    testTenant,
+		Region:    "RegionTwo",
+		AuthURL:   server.URL + "/v2.0",
+		Container: testContainer,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	if err := d.PutContent("/a", []byte("content")); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if _, ok := fake.containers[testContainer]["a"]; !ok {
+		t.Fatalf("object not written")
+	}
+
+	if fake.lastAccount != "AUTH_RegionTwo" {
+		t.Fatalf("request sent to account %q of the wrong region", fake.lastAccount)
+	}
+}
+
+// TestAppendSegments ensures that appending to a large object uploads new
+// segments, and that deleting it removes them.
+func TestAppendSegments(t *testing.T) {
+	fake, cleanup := newTestFakeSwift(t)
+	defer cleanup()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	d, err := New(DriverParameters{
+		Username:  testUsername,
+		Password:  testPassword,
+		AuthURL:   server.URL + "/auth/v1.0",
+		Container: testContainer,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	if _, err := d.WriteStream("/a/b", 0, strings.NewReader("hello, ")); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+
+	// Expire the token, the driver must authenticate again.
+	fake.mu.Lock()
+	fake.tokens = make(map[string]string)
+	fake.mu.Unlock()
+
+	if _, err := d.WriteStream("/a/b", 7, strings.NewReader("world")); err != nil {
+		t.Fatalf("unexpected error appending: %v", err)
+	}
+
+	content, err := d.GetContent("/a/b")
+	if err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if string(content) != "hello, world" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+
+	fake.mu.Lock()
+	segments := len(fake.containers[testContainer+"_segments"])
+	fake.mu.Unlock()
+
+	if segments != 2 {
+		t.Fatalf("unexpected number of segments: %d != 2", segments)
+	}
+
+	if err := d.Delete("/a"); err != nil {
+		t.Fatalf("unexpected error deleting: %v", err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if n := len(fake.containers[testContainer+"_segments"]); n != 0 {
+		t.Fatalf("segments left after delete: %d", n)
+	}
+
+	if _, err := d.URLFor("/a/b", nil); err != storagedriver.ErrUnsupportedMethod {
+		t.Fatalf("expected unsupported URLFor without a temp url key, got %v", err)
+	}
+}
+
+// fakeSwift implements the subset of the Swift API used by the driver,
+// including v1.0 and Keystone v2.0 authentication, Dynamic Large Objects
+// and TempURL. The content of the objects is kept in files below dir, so
+// that the large objects of the driver test suite fit.
+type fakeSwift struct {
+	mu          sync.Mutex
+	dir         string
+	containers  map[string]map[string]*fakeObject
+	tokens      map[string]string // token to account
+	nextToken   int
+	lastAccount string
+}
+
+type fakeObject struct {
+	path     string // file holding the content
+	size     int64
+	modTime  time.Time
+	manifest string
+}
+
+func newFakeSwift(dir string) *fakeSwift {
+	return &fakeSwift{
+		dir:        dir,
+		containers: make(map[string]map[string]*fakeObject),
+		tokens:     make(map[string]string),
+	}
+}
+
+// newTestFakeSwift returns a fakeSwift keeping its objects in a temporary
+// directory, removed by cleanup.
+func newTestFakeSwift(t *testing.T) (fake *fakeSwift, cleanup func()) {
+	dir, err := ioutil.TempDir("", "fake-swift-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+
+	return newFakeSwift(dir), func() { os.RemoveAll(dir) }
+}
+
+func (f *fakeSwift) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/auth/v1.0":
+		f.authV1(w, r)
+		return
+	case r.URL.Path == "/v2.0/tokens":
+		f.authV2(w, r)
+		return
+	}
+
+	// Paths are /v1/<account>/<container>[/<object>]
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 4)
+	if len(parts) < 3 || parts[0] != "v1" {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	account, container := parts[1], parts[2]
+
+	if r.URL.Query().Get("temp_url_sig") != "" {
+		f.tempURL(w, r)
+		return
+	}
+
+	f.mu.Lock()
+	tokenAccount, ok := f.tokens[r.Header.Get("X-Auth-Token")]
+	f.lastAccount = account
+	f.mu.Unlock()
+
+	if !ok || tokenAccount != account {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if len(parts) == 3 {
+		f.container(w, r, container)
+		return
+	}
+
+	f.object(w, r, container, parts[3])
+}
+
+// issueToken returns a new token for account.
+func (f *fakeSwift) issueToken(account string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextToken++
+	token := "token-" + strconv.Itoa(f.nextToken)
+	f.tokens[token] = account
+
+	return token
+}
+
+func (f *fakeSwift) authV1(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Auth-User") != testUsername || r.Header.Get("X-Auth-Key") != testPassword {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("X-Storage-Url", "http://"+r.Host+"/v1/AUTH_test")
+	w.Header().Set("X-Auth-Token", f.issueToken("AUTH_test"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeSwift) authV2(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Auth struct {
+			PasswordCredentials struct {
+				Username string `json:"username"`
+				Password string `json:"password"`
+			} `json:"passwordCredentials"`
+			TenantName string `json:"tenantName"`
+		} `json:"auth"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil ||
+		request.Auth.PasswordCredentials.Username != testUsername ||
+		request.Auth.PasswordCredentials.Password != testPassword ||
+		request.Auth.TenantName != testTenant {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	endpoint := func(region string) map[string]string {
+		return map[string]string{
+			"region":    region,
+			"publicURL": "http://" + r.Host + "/v1/AUTH_" + region,
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access": map[string]interface{}{
+			"token": map[string]string{"id": f.issueToken("AUTH_RegionTwo")},
+			"serviceCatalog": []interface{}{
+				map[string]interface{}{
+					"type":      "compute",
+					"endpoints": []interface{}{endpoint("RegionTwo")},
+				},
+				map[string]interface{}{
+					"type":      "object-store",
+					"endpoints": []interface{}{endpoint("RegionOne"), endpoint("RegionTwo")},
+				},
+			},
+		},
+	})
+}
+
+func (f *fakeSwift) container(w http.ResponseWriter, r *http.Request, container string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	objects, ok := f.containers[container]
+
+	switch r.Method {
+	case "PUT":
+		if ok {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		f.containers[container] = make(map[string]*fakeObject)
+		w.WriteHeader(http.StatusCreated)
+	case "GET":
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		f.list(w, r, objects)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// list writes the JSON listing of objects. Must be called with mu held.
+func (f *fakeSwift) list(w http.ResponseWriter, r *http.Request, objects map[string]*fakeObject) {
+	query := r.URL.Query()
+	prefix, delimiter, marker := query.Get("prefix"), query.Get("delimiter"), query.Get("marker")
+
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = listMax
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for name := range objects {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		entry := name
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				entry = name[:len(prefix)+i+len(delimiter)]
+			}
+		}
+
+		if entry > marker && !seen[entry] {
+			seen[entry] = true
+			names = append(names, entry)
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) > limit {
+		names = names[:limit]
+	}
+
+	entries := []interface{}{}
+	for _, name := range names {
+		if obj, ok := objects[name]; ok {
+			entries = append(entries, map[string]interface{}{
+				"name":  name,
+				"bytes": obj.size,
+			})
+		} else {
+			entries = append(entries, map[string]string{"subdir": name})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (f *fakeSwift) object(w http.ResponseWriter, r *http.Request, container, name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	objects, ok := f.containers[container]
+	if !ok {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		obj := &fakeObject{modTime: time.Now(), manifest: r.Header.Get("X-Object-Manifest")}
+
+		var content io.Reader = r.Body
+		if source := r.Header.Get("X-Copy-From"); source != "" {
+			parts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+			src, ok := f.containers[parts[0]][parts[1]]
+			if !ok {
+				http.Error(w, "Not Found", http.StatusNotFound)
+				return
+			}
+
+			rc, _, err := f.open(src, 0)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer rc.Close()
+			content = rc
+		}
+
+		if err := f.store(obj, content); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if old, ok := objects[name]; ok {
+			os.Remove(old.path)
+		}
+		objects[name] = obj
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		obj, ok := objects[name]
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		os.Remove(obj.path)
+		delete(objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	case "GET", "HEAD":
+		obj, ok := objects[name]
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		f.serve(w, r, obj)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// store writes content to a new file holding the content of obj.
+func (f *fakeSwift) store(obj *fakeObject, content io.Reader) error {
+	file, err := ioutil.TempFile(f.dir, "object-")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	obj.path = file.Name()
+	obj.size, err = io.Copy(file, content)
+	if err != nil {
+		os.Remove(obj.path)
+	}
+	return err
+}
+
+// multiReadCloser reads the files of the segments of a large object in turn.
+type multiReadCloser struct {
+	io.Reader
+	files []*os.File
+}
+
+func (m *multiReadCloser) Close() error {
+	for _, file := range m.files {
+		file.Close()
+	}
+	return nil
+}
+
+// open returns the content of obj from offset on, streaming the segments of
+// large objects one after the other, and its full size. Must be called with
+// mu held.
+func (f *fakeSwift) open(obj *fakeObject, offset int64) (io.ReadCloser, int64, error) {
+	segments := []*fakeObject{obj}
+	if obj.manifest != "" {
+		parts := strings.SplitN(obj.manifest, "/", 2)
+		objects := f.containers[parts[0]]
+
+		var names []string
+		for name := range objects {
+			if strings.HasPrefix(name, parts[1]) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		segments = segments[:0]
+		for _, name := range names {
+			segments = append(segments, objects[name])
+		}
+	}
+
+	var (
+		m       multiReadCloser
+		readers []io.Reader
+		size    int64
+	)
+	for _, segment := range segments {
+		size += segment.size
+		if offset >= segment.size {
+			offset -= segment.size
+			continue
+		}
+
+		file, err := os.Open(segment.path)
+		if err != nil {
+			m.Close()
+			return nil, 0, err
+		}
+		m.files = append(m.files, file)
+
+		if _, err := file.Seek(offset, 0); err != nil {
+			m.Close()
+			return nil, 0, err
+		}
+		offset = 0
+
+		readers = append(readers, file)
+	}
+
+	m.Reader = io.MultiReader(readers...)
+	return &m, size, nil
+}
+
+// serve writes the content of obj, honoring the Range header. Must be called
+// with mu held, which is released before writing the body, as the client may
+// only read it after further requests.
+func (f *fakeSwift) serve(w http.ResponseWriter, r *http.Request, obj *fakeObject) {
+	var offset int64
+	rng := r.Header.Get("Range")
+	if rng != "" {
+		fmt.Sscanf(rng, "bytes=%d-", &offset)
+	}
+
+	rc, size, err := f.open(obj, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	f.mu.Unlock()
+	defer f.mu.Lock()
+
+	w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+	if obj.manifest != "" {
+		w.Header().Set("X-Object-Manifest", obj.manifest)
+	}
+
+	status := http.StatusOK
+	if rng != "" {
+		if offset >= size {
+			http.Error(w, "Requested Range Not Satisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, size-1, size))
+		status = http.StatusPartialContent
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(size-offset, 10))
+	w.WriteHeader(status)
+	if r.Method != "HEAD" {
+		io.Copy(w, rc)
+	}
+}
+
+func (f *fakeSwift) tempURL(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	expires, err := strconv.ParseInt(query.Get("temp_url_expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	mac := hmac.New(sha1.New, []byte(testTempURLKey))
+	mac.Write([]byte(r.Method + "\n" + query.Get("temp_url_expires") + "\n" + strings.SplitN(r.RequestURI, "?", 2)[0]))
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(query.Get("temp_url_sig"))) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 4)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	obj, ok := f.containers[parts[2]][parts[3]]
+	if !ok {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	f.serve(w, r, obj)
+}
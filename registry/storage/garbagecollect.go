@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"path"
+	"strings"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/digest"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"golang.org/x/net/context"
+)
+
+// MarkAndSweep performs an offline garbage collection of the blob store
+// backing driver. In the mark phase, every repository is walked and any blob
+// referenced by a manifest revision, a manifest signature or a layer link is
+// marked as in use. In the sweep phase, every blob that was not marked is
+// deleted from the driver. The digests of the swept blobs are returned.
+//
+// If dryRun is true, the blobs that would be deleted are reported but left in
+// place.
+//
+// The registry must not accept writes while the collection is running. A
+// blob uploaded or linked after the mark phase has visited its repository
+// may be removed.
+func MarkAndSweep(ctx context.Context, driver storagedriver.StorageDriver, dryRun bool) ([]digest.Digest, error) {
+	gc := &garbageCollector{
+		ctx:    ctx,
+		driver: driver,
+		pm:     defaultPathMapper,
+		marked: make(map[digest.Digest]struct{}),
+	}
+
+	if err := gc.mark(); err != nil {
+		return nil, err
+	}
+
+	return gc.sweep(dryRun)
+}
+
+// garbageCollector holds the state of a single mark and sweep pass.
+type garbageCollector struct {
+	ctx    context.Context
+	driver storagedriver.StorageDriver
+	pm     *pathMapper
+	marked map[digest.Digest]struct{}
+}
+
+// mark walks all repositories, marking every blob reachable from the
+// manifest revisions, their signatures and the layer links.
+func (gc *garbageCollector) mark() error {
+	return walkRepositories(gc.driver, gc.pm, func(name string) error {
+		ctxu.GetLogger(gc.ctx).Debugf("marking blobs of repository %s", name)
+
+		revisionsPath, err := gc.pm.path(manifestRevisionsPathSpec{name: name})
+		if err != nil {
+			return err
+		}
+
+		// The revisions tree holds the links of the manifest revisions and,
+		// below each of them, the links of the signatures.
+		if err := gc.markLinks(revisionsPath); err != nil {
+			return err
+		}
+
+		layersPath, err := gc.pm.path(layersPathSpec{name: name})
+		if err != nil {
+			return err
+		}
+
+		return gc.markLinks(layersPath)
+	})
+}
+
+// markLinks marks the target of every link file found below root.
+func (gc *garbageCollector) markLinks(root string) error {
+	err := walk(gc.driver, root, func(fileInfo storagedriver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+			return nil
+		}
+
+		content, err := gc.driver.GetContent(fileInfo.Path())
+		if err != nil {
+			return err
+		}
+
+		dgst, err := digest.ParseDigest(string(content))
+		if err != nil {
+			// Leave the link alone: an unreadable link is not a reason to
+			// abort, but it is worth knowing about.
+			ctxu.GetLogger(gc.ctx).Warnf("invalid link %q: %v", fileInfo.Path(), err)
+			return nil
+		}
+
+		gc.marked[dgst] = struct{}{}
+		return nil
+	})
+
+	if err != nil {
+		switch err.(type) {
+		case storagedriver.PathNotFoundError:
+			return nil // nothing to mark.
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sweep deletes, or reports if dryRun is set, every blob that was not marked.
+func (gc *garbageCollector) sweep(dryRun bool) ([]digest.Digest, error) {
+	root, err := gc.pm.path(blobsPathSpec{})
+	if err != nil {
+		return nil, err
+	}
+
+	var swept []digest.Digest
+	err = walk(gc.driver, root, func(fileInfo storagedriver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "data" {
+			return nil
+		}
+
+		dgst, err := gc.blobDigest(root, fileInfo.Path())
+		if err != nil {
+			ctxu.GetLogger(gc.ctx).Warnf("skipping unrecognized blob path %q: %v", fileInfo.Path(), err)
+			return nil
+		}
+
+		if _, ok := gc.marked[dgst]; ok {
+			return nil
+		}
+
+		swept = append(swept, dgst)
+
+		if dryRun {
+			ctxu.GetLogger(gc.ctx).Infof("blob eligible for deletion: %s", dgst)
+			return nil
+		}
+
+		ctxu.GetLogger(gc.ctx).Infof("deleting blob: %s", dgst)
+		return gc.driver.Delete(path.Dir(fileInfo.Path()))
+	})
+
+	if err != nil {
+		switch err.(type) {
+		case storagedriver.PathNotFoundError:
+			// empty blob store
+		default:
+			return swept, err
+		}
+	}
+
+	return swept, nil
+}
+
+// blobDigest recovers the digest of the blob stored at dataPath, the inverse
+// of the blobDataPathSpec mapping. The result is checked by mapping it back
+// to a path, so that no blob is ever deleted under a misread digest.
+func (gc *garbageCollector) blobDigest(root, dataPath string) (digest.Digest, error) {
+	components := strings.Split(strings.TrimPrefix(dataPath, root+"/"), "/")
+
+	var dgst digest.Digest
+	switch {
+	case len(components) == 6 && components[0] == "tarsum":
+		// tarsum/<version>/<algorithm>/<first two hex bytes>/<hex digest>/data
+		dgst = digest.Digest("tarsum." + components[1] + "+" + components[2] + ":" + components[4])
+	case len(components) == 4:
+		// <algorithm>/<first two hex bytes>/<hex digest>/data
+		dgst = digest.NewDigestFromHex(components[0], components[2])
+	default:
+		return "", digest.ErrDigestInvalidFormat
+	}
+
+	expected, err := gc.pm.path(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		return "", err
+	}
+
+	if expected != dataPath {
+		return "", digest.ErrDigestInvalidFormat
+	}
+
+	return dgst, nil
+}
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"io"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/digest"
+	"github.com/docker/distribution/manifest"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/testutil"
+	"github.com/docker/libtrust"
+	"golang.org/x/net/context"
+)
+
+// uploadTestImage pushes a random layer and a signed manifest referencing it
+// into repo, returning the layer and manifest digests.
+func uploadTestImage(t *testing.T, repo distribution.Repository, tag string) (digest.Digest, digest.Digest) {
+	rs, ds, err := testutil.CreateRandomTarFile()
+	if err != nil {
+		t.Fatalf("unexpected error generating test layer file: %v", err)
+	}
+	layerDigest := digest.Digest(ds)
+
+	upload, err := repo.Layers().Upload()
+	if err != nil {
+		t.Fatalf("unexpected error creating test upload: %v", err)
+	}
+
+	if _, err := io.Copy(upload, rs); err != nil {
+		t.Fatalf("unexpected error copying to upload: %v", err)
+	}
+
+	layer, err := upload.Finish(layerDigest)
+	if err != nil {
+		t.Fatalf("unexpected error finishing upload: %v", err)
+	}
+
+	m := manifest.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 1,
+		},
+		Name: repo.Name(),
+		Tag:  tag,
+		FSLayers: []manifest.FSLayer{
+			{
+				BlobSum: layerDigest,
+			},
+		},
+	}
+
+	pk, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating private key: %v", err)
+	}
+
+	sm, err := manifest.Sign(&m, pk)
+	if err != nil {
+		t.Fatalf("error signing manifest: %v", err)
+	}
+
+	if err := repo.Manifests().Put(sm); err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+
+	payload, err := sm.Payload()
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest payload: %v", err)
+	}
+
+	dgst, err := digest.FromBytes(payload)
+	if err != nil {
+		t.Fatalf("unexpected error digesting manifest: %v", err)
+	}
+
+	return layer.Digest(), dgst
+}
+
+func TestMarkAndSweep(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	reg := NewRegistryWithDriver(driver, nil)
+
+	repo, err := reg.Repository(ctx, "foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	keptLayer, keptManifest := uploadTestImage(t, repo, "kept")
+	deletedLayer, deletedManifest := uploadTestImage(t, repo, "deleted")
+
+	if err := repo.Manifests().Delete(deletedManifest); err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+
+	// Store a blob that is not referenced from any repository.
+	bs := reg.(*registry).blobStore
+	orphan, err := bs.put([]byte("orphaned content"))
+	if err != nil {
+		t.Fatalf("unexpected error putting orphan blob: %v", err)
+	}
+
+	// A dry run reports the unreferenced blobs, but leaves them in place.
+	candidates, err := MarkAndSweep(ctx, driver, true)
+	if err != nil {
+		t.Fatalf("unexpected error during dry run: %v", err)
+	}
+
+	eligible := make(map[digest.Digest]struct{})
+	for _, dgst := range candidates {
+		eligible[dgst] = struct{}{}
+	}
+
+	for _, dgst := range []digest.Digest{orphan, deletedManifest} {
+		if _, ok := eligible[dgst]; !ok {
+			t.Fatalf("expected %s to be eligible for deletion: %v", dgst, candidates)
+		}
+
+		checkBlobExists(t, bs, dgst, true)
+	}
+
+	// The signature of the deleted manifest is the only other candidate.
+	if len(candidates) != 3 {
+		t.Fatalf("unexpected blobs eligible for deletion: %v", candidates)
+	}
+
+	swept, err := MarkAndSweep(ctx, driver, false)
+	if err != nil {
+		t.Fatalf("unexpected error sweeping: %v", err)
+	}
+
+	if len(swept) != len(candidates) {
+		t.Fatalf("dry run and sweep disagree: %v != %v", candidates, swept)
+	}
+
+	for _, dgst := range swept {
+		checkBlobExists(t, bs, dgst, false)
+	}
+
+	// Everything still referenced from the repository must survive,
+	// including the layer of the deleted manifest, which is still linked.
+	for _, dgst := range []digest.Digest{keptLayer, keptManifest, deletedLayer} {
+		checkBlobExists(t, bs, dgst, true)
+	}
+
+	sm, err := repo.Manifests().GetByTag("kept")
+	if err != nil {
+		t.Fatalf("unexpected error fetching kept manifest after sweep: %v", err)
+	}
+
+	if _, err := manifest.Verify(sm); err != nil {
+		t.Fatalf("kept manifest signatures lost after sweep: %v", err)
+	}
+
+	// A second pass has nothing left to do.
+	swept, err = MarkAndSweep(ctx, driver, false)
+	if err != nil {
+		t.Fatalf("unexpected error sweeping: %v", err)
+	}
+
+	if len(swept) != 0 {
+		t.Fatalf("unexpected blobs swept on second pass: %v", swept)
+	}
+}
+
+func TestMarkAndSweepEmpty(t *testing.T) {
+	swept, err := MarkAndSweep(context.Background(), inmemory.New(), false)
+	if err != nil {
+		t.Fatalf("unexpected error sweeping empty registry: %v", err)
+	}
+
+	if len(swept) != 0 {
+		t.Fatalf("unexpected blobs swept: %v", swept)
+	}
+}
+
+func checkBlobExists(t *testing.T, bs *blobStore, dgst digest.Digest, expected bool) {
+	exists, err := bs.exists(dgst)
+	if err != nil {
+		t.Fatalf("unexpected error checking blob existence: %v", err)
+	}
+
+	if exists != expected {
+		t.Fatalf("unexpected existence of blob %s: %v != %v", dgst, exists, expected)
+	}
+}
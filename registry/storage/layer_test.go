@@ -287,6 +287,89 @@ func TestLayerUploadZeroLength(t *testing.T) {
 	}
 }
 
+// TestLayerMount covers linking a layer from one repository into another.
+func TestLayerMount(t *testing.T) {
+	randomDataReader, tarSumStr, err := testutil.CreateRandomTarFile()
+	if err != nil {
+		t.Fatalf("error creating random reader: %v", err)
+	}
+	tarSum := digest.Digest(tarSumStr)
+
+	ctx := context.Background()
+	registry := NewRegistryWithDriver(inmemory.New(), cache.NewInMemoryLayerInfoCache())
+
+	source, err := registry.Repository(ctx, "foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	target, err := registry.Repository(ctx, "foo/baz")
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	upload, err := source.Layers().Upload()
+	if err != nil {
+		t.Fatalf("unexpected error starting layer upload: %v", err)
+	}
+
+	if _, err := io.Copy(upload, randomDataReader); err != nil {
+		t.Fatalf("unexpected error uploading layer data: %v", err)
+	}
+
+	layer, err := upload.Finish(tarSum)
+	if err != nil {
+		t.Fatalf("unexpected error finishing layer upload: %v", err)
+	}
+
+	// Mounting from a repository without the layer fails.
+	if _, err := source.Layers().Mount("foo/baz", tarSum); err == nil {
+		t.Fatalf("expected error mounting unknown layer")
+	} else if _, ok := err.(distribution.ErrUnknownLayer); !ok {
+		t.Fatalf("unexpected error mounting unknown layer: %v", err)
+	}
+
+	if exists, err := target.Layers().Exists(tarSum); err != nil {
+		t.Fatalf("unexpected error checking layer existence: %v", err)
+	} else if exists {
+		t.Fatalf("layer should not exist in target before mount")
+	}
+
+	mounted, err := target.Layers().Mount("foo/bar", tarSum)
+	if err != nil {
+		t.Fatalf("unexpected error mounting layer: %v", err)
+	}
+	defer mounted.Close()
+
+	if mounted.Digest() != tarSum || mounted.Length() != layer.Length() {
+		t.Fatalf("unexpected mounted layer: %v (%d bytes) != %v (%d bytes)", mounted.Digest(), mounted.Length(), tarSum, layer.Length())
+	}
+
+	if exists, err := target.Layers().Exists(tarSum); err != nil {
+		t.Fatalf("unexpected error checking layer existence: %v", err)
+	} else if !exists {
+		t.Fatalf("layer should exist in target after mount")
+	}
+
+	if _, err := randomDataReader.Seek(0, os.SEEK_SET); err != nil {
+		t.Fatalf("error seeking random data: %v", err)
+	}
+
+	expected, err := ioutil.ReadAll(randomDataReader)
+	if err != nil {
+		t.Fatalf("error reading random data: %v", err)
+	}
+
+	p, err := ioutil.ReadAll(mounted)
+	if err != nil {
+		t.Fatalf("unexpected error reading mounted layer: %v", err)
+	}
+
+	if !bytes.Equal(p, expected) {
+		t.Fatalf("mounted layer content does not match uploaded content")
+	}
+}
+
 // writeRandomLayer creates a random layer under name and tarSum using driver
 // and pathMapper. An io.ReadSeeker with the data is returned, along with the
 // sha256 hex digest.
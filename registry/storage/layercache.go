@@ -45,11 +45,13 @@ func (lc *cachedLayerService) Exists(dgst digest.Digest) (bool, error) {
 
 	if available {
 		atomic.AddUint64(&layerInfoCacheMetrics.Exists.Hits, 1)
+		layerInfoCacheRequests.Inc("exists", "hit")
 		return true, nil
 	}
 
 fallback:
 	atomic.AddUint64(&layerInfoCacheMetrics.Exists.Misses, 1)
+	layerInfoCacheRequests.Inc("exists", "miss")
 	exists, err := lc.LayerService.Exists(dgst)
 	if err != nil {
 		return exists, err
@@ -93,6 +95,7 @@ func (lc *cachedLayerService) Fetch(dgst digest.Digest) (distribution.Layer, err
 		}
 
 		atomic.AddUint64(&layerInfoCacheMetrics.Fetch.Hits, 1)
+		layerInfoCacheRequests.Inc("fetch", "hit")
 		return newLayerReader(lc.driver, dgst, meta.Path, meta.Length)
 	}
 
@@ -102,6 +105,7 @@ func (lc *cachedLayerService) Fetch(dgst digest.Digest) (distribution.Layer, err
 
 fallback:
 	atomic.AddUint64(&layerInfoCacheMetrics.Fetch.Misses, 1)
+	layerInfoCacheRequests.Inc("fetch", "miss")
 	layer, err := lc.LayerService.Fetch(dgst)
 	if err != nil {
 		return nil, err
@@ -131,6 +131,38 @@ func (ls *layerStore) Resume(uuid string) (distribution.LayerUpload, error) {
 	return ls.newLayerUpload(uuid, path, startedAt)
 }
 
+// Mount links the layer identified by dgst from the repository named
+// sourceRepo into this repository. The blob itself is shared, so no data is
+// copied. ErrUnknownLayer is returned if sourceRepo does not have the layer.
+func (ls *layerStore) Mount(sourceRepo string, dgst digest.Digest) (distribution.Layer, error) {
+	ctxu.GetLogger(ls.repository.ctx).Debug("(*layerStore).Mount")
+
+	// Going through the link of the source repository enforces that the
+	// layer was pushed there, rather than to any repository.
+	sourceLinkPath, err := ls.repository.registry.pm.path(layerLinkPathSpec{name: sourceRepo, digest: dgst})
+	if err != nil {
+		return nil, err
+	}
+
+	canonical, err := ls.repository.blobStore.readlink(sourceLinkPath)
+	if err != nil {
+		switch err := err.(type) {
+		case storagedriver.PathNotFoundError:
+			return nil, distribution.ErrUnknownLayer{
+				FSLayer: manifest.FSLayer{BlobSum: dgst},
+			}
+		default:
+			return nil, err
+		}
+	}
+
+	if err := ls.linkLayer(canonical, dgst); err != nil {
+		return nil, err
+	}
+
+	return ls.Fetch(dgst)
+}
+
 // newLayerUpload allocates a new upload controller with the given state.
 func (ls *layerStore) newLayerUpload(uuid, path string, startedAt time.Time) (distribution.LayerUpload, error) {
 	fw, err := newFileWriter(ls.repository.driver, path)
@@ -169,3 +201,34 @@ func (ls *layerStore) path(dgst digest.Digest) (string, error) {
 
 	return blobPath, nil
 }
+
+// linkLayer links a valid, written layer blob into the registry under the
+// named repository of the layer store.
+func (ls *layerStore) linkLayer(canonical digest.Digest, aliases ...digest.Digest) error {
+	dgsts := append([]digest.Digest{canonical}, aliases...)
+
+	// Don't make duplicate links.
+	seenDigests := make(map[digest.Digest]struct{}, len(dgsts))
+
+	for _, dgst := range dgsts {
+		if _, seen := seenDigests[dgst]; seen {
+			continue
+		}
+		seenDigests[dgst] = struct{}{}
+
+		layerLinkPath, err := ls.repository.registry.pm.path(layerLinkPathSpec{
+			name:   ls.repository.Name(),
+			digest: dgst,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if err := ls.repository.registry.driver.PutContent(layerLinkPath, []byte(canonical)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
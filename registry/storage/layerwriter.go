@@ -64,7 +64,7 @@ func (lw *layerWriter) Finish(digest digest.Digest) (distribution.Layer, error)
 	}
 
 	// Link the layer blob into the repository.
-	if err := lw.linkLayer(canonical, digest); err != nil {
+	if err := lw.layerStore.linkLayer(canonical, digest); err != nil {
 		return nil, err
 	}
 
@@ -94,7 +94,9 @@ func (lw *layerWriter) Write(p []byte) (int, error) {
 		return 0, err
 	}
 
-	return io.MultiWriter(&lw.bufferedFileWriter, lw.resumableDigester).Write(p)
+	n, err := io.MultiWriter(&lw.bufferedFileWriter, lw.resumableDigester).Write(p)
+	uploadedBytes.Add(float64(n))
+	return n, err
 }
 
 func (lw *layerWriter) ReadFrom(r io.Reader) (n int64, err error) {
@@ -105,7 +107,9 @@ func (lw *layerWriter) ReadFrom(r io.Reader) (n int64, err error) {
 		return 0, err
 	}
 
-	return lw.bufferedFileWriter.ReadFrom(io.TeeReader(r, lw.resumableDigester))
+	n, err = lw.bufferedFileWriter.ReadFrom(io.TeeReader(r, lw.resumableDigester))
+	uploadedBytes.Add(float64(n))
+	return n, err
 }
 
 func (lw *layerWriter) Close() error {
@@ -361,37 +365,6 @@ func (lw *layerWriter) moveLayer(dgst digest.Digest) error {
 	return lw.driver.Move(lw.path, blobPath)
 }
 
-// linkLayer links a valid, written layer blob into the registry under the
-// named repository for the upload controller.
-func (lw *layerWriter) linkLayer(canonical digest.Digest, aliases ...digest.Digest) error {
-	dgsts := append([]digest.Digest{canonical}, aliases...)
-
-	// Don't make duplicate links.
-	seenDigests := make(map[digest.Digest]struct{}, len(dgsts))
-
-	for _, dgst := range dgsts {
-		if _, seen := seenDigests[dgst]; seen {
-			continue
-		}
-		seenDigests[dgst] = struct{}{}
-
-		layerLinkPath, err := lw.layerStore.repository.registry.pm.path(layerLinkPathSpec{
-			name:   lw.layerStore.repository.Name(),
-			digest: dgst,
-		})
-
-		if err != nil {
-			return err
-		}
-
-		if err := lw.layerStore.repository.registry.driver.PutContent(layerLinkPath, []byte(canonical)); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
 // removeResources should clean up all resources associated with the upload
 // instance. An error will be returned if the clean up cannot proceed. If the
 // resources are already not present, no error will be returned.
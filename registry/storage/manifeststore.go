@@ -2,11 +2,13 @@ package storage
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/docker/distribution"
 	ctxu "github.com/docker/distribution/context"
 	"github.com/docker/distribution/digest"
 	"github.com/docker/distribution/manifest"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/libtrust"
 )
 
@@ -52,15 +54,48 @@ func (ms *manifestStore) Put(manifest *manifest.SignedManifest) error {
 	return ms.tagStore.tag(manifest.Tag, revision)
 }
 
-// Delete removes the revision of the specified manfiest.
+// Delete removes the revision of the specified manifest. Any tags currently
+// pointing at the revision are removed and the revision is dropped from the
+// index of every other tag. The underlying blobs are left in place to be
+// reclaimed by garbage collection.
 func (ms *manifestStore) Delete(dgst digest.Digest) error {
-	ctxu.GetLogger(ms.repository.ctx).Debug("(*manifestStore).Delete - unsupported")
-	return fmt.Errorf("deletion of manifests not supported")
+	ctxu.GetLogger(ms.repository.ctx).Debug("(*manifestStore).Delete")
+
+	if exists, err := ms.revisionStore.exists(dgst); err != nil {
+		return err
+	} else if !exists {
+		return distribution.ErrUnknownManifestRevision{
+			Name:     ms.repository.Name(),
+			Revision: dgst,
+		}
+	}
+
+	if err := ms.tagStore.untagRevision(dgst); err != nil {
+		return err
+	}
+
+	return ms.revisionStore.delete(dgst)
 }
 
-func (ms *manifestStore) Tags() ([]string, error) {
+func (ms *manifestStore) Tags(n int, last string) ([]string, error) {
 	ctxu.GetLogger(ms.repository.ctx).Debug("(*manifestStore).Tags")
-	return ms.tagStore.tags()
+	tags, err := ms.tagStore.tags()
+	if err != nil {
+		return nil, err
+	}
+
+	// tags are sorted, so the page starts at the first tag after last.
+	start := sort.SearchStrings(tags, last)
+	if start < len(tags) && tags[start] == last {
+		start++
+	}
+	tags = tags[start:]
+
+	if n > 0 && n < len(tags) {
+		tags = tags[:n]
+	}
+
+	return tags, nil
 }
 
 func (ms *manifestStore) ExistsByTag(tag string) (bool, error) {
@@ -78,6 +113,22 @@ func (ms *manifestStore) GetByTag(tag string) (*manifest.SignedManifest, error)
 	return ms.revisionStore.get(dgst)
 }
 
+// DeleteTag removes the tag and its index of revisions. The revisions remain
+// in the repository until deleted by digest.
+func (ms *manifestStore) DeleteTag(tag string) error {
+	ctxu.GetLogger(ms.repository.ctx).Debug("(*manifestStore).DeleteTag")
+	if err := ms.tagStore.delete(tag); err != nil {
+		switch err.(type) {
+		case storagedriver.PathNotFoundError:
+			return distribution.ErrManifestUnknown{Name: ms.repository.Name(), Tag: tag}
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
 // verifyManifest ensures that the manifest content is valid from the
 // perspective of the registry. It ensures that the signature is valid for the
 // enclosed payload. As a policy, the registry only tries to store valid
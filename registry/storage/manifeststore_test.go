@@ -193,7 +193,7 @@ func TestManifestStorage(t *testing.T) {
 	}
 
 	// Grabs the tags and check that this tagged manifest is present
-	tags, err := ms.Tags()
+	tags, err := ms.Tags(0, "")
 	if err != nil {
 		t.Fatalf("unexpected error fetching tags: %v", err)
 	}
@@ -280,11 +280,137 @@ func TestManifestStorage(t *testing.T) {
 		}
 	}
 
-	// TODO(stevvooe): Currently, deletes are not supported due to some
-	// complexity around managing tag indexes. We'll add this support back in
-	// when the manifest format has settled. For now, we expect an error for
-	// all deletes.
-	if err := ms.Delete(dgst); err == nil {
-		t.Fatalf("unexpected an error deleting manifest by digest: %v", err)
+	// Delete the revision and ensure that it, along with the tag pointing at
+	// it, is no longer available.
+	if err := ms.Delete(dgst); err != nil {
+		t.Fatalf("unexpected error deleting manifest by digest: %v", err)
+	}
+
+	exists, err = ms.Exists(dgst)
+	if err != nil {
+		t.Fatalf("unexpected error checking manifest existence: %v", err)
+	}
+
+	if exists {
+		t.Fatalf("deleted manifest %s should not exist", dgst)
+	}
+
+	if _, err := ms.Get(dgst); true {
+		switch err.(type) {
+		case distribution.ErrUnknownManifestRevision:
+			break
+		default:
+			t.Fatalf("expected manifest unknown revision error: %#v", err)
+		}
+	}
+
+	exists, err = ms.ExistsByTag(env.tag)
+	if err != nil {
+		t.Fatalf("unexpected error checking manifest existence: %v", err)
+	}
+
+	if exists {
+		t.Fatalf("tag %q should have been removed with its revision", env.tag)
+	}
+
+	tags, err = ms.Tags(0, "")
+	if err != nil {
+		t.Fatalf("unexpected error fetching tags: %v", err)
+	}
+
+	if len(tags) != 0 {
+		t.Fatalf("unexpected tags after delete: %v", tags)
+	}
+
+	// The manifest payload remains in the blob store until collected.
+	if exists, err := env.registry.(*registry).blobStore.exists(dgst); err != nil {
+		t.Fatalf("unexpected error checking blob existence: %v", err)
+	} else if !exists {
+		t.Fatalf("manifest blob should remain after revision delete")
+	}
+
+	// Deleting again should report the revision as unknown.
+	if err := ms.Delete(dgst); true {
+		switch err.(type) {
+		case distribution.ErrUnknownManifestRevision:
+			break
+		default:
+			t.Fatalf("expected manifest unknown revision error: %#v", err)
+		}
+	}
+}
+
+func TestManifestStorageTagsPagination(t *testing.T) {
+	env := newManifestStoreTestEnv(t, "foo/bar", "thetag")
+	ms := env.repository.Manifests()
+
+	// Tags are written directly; listing does not resolve their targets.
+	for _, tag := range []string{"v10", "latest", "v2", "v1"} {
+		p, err := defaultPathMapper.path(manifestTagCurrentPathSpec{name: env.name, tag: tag})
+		if err != nil {
+			t.Fatalf("unexpected error mapping tag path: %v", err)
+		}
+
+		if err := env.driver.PutContent(p, []byte("sha256:abc")); err != nil {
+			t.Fatalf("unexpected error writing tag: %v", err)
+		}
+	}
+
+	for _, testcase := range []struct {
+		n        int
+		last     string
+		expected []string
+	}{
+		{0, "", []string{"latest", "v1", "v10", "v2"}},
+		{2, "", []string{"latest", "v1"}},
+		{2, "v1", []string{"v10", "v2"}},
+		{2, "v10", []string{"v2"}},
+		{0, "v0", []string{"v1", "v10", "v2"}},
+		{10, "v2", []string{}},
+	} {
+		tags, err := ms.Tags(testcase.n, testcase.last)
+		if err != nil {
+			t.Fatalf("unexpected error listing tags: %v", err)
+		}
+
+		if len(tags) != len(testcase.expected) || (len(tags) > 0 && !reflect.DeepEqual(tags, testcase.expected)) {
+			t.Fatalf("unexpected tags for n=%d last=%q: %v != %v", testcase.n, testcase.last, tags, testcase.expected)
+		}
+	}
+}
+
+func TestManifestStorageDeleteTag(t *testing.T) {
+	env := newManifestStoreTestEnv(t, "foo/bar", "thetag")
+	ms := env.repository.Manifests()
+
+	_, dgst := uploadTestImage(t, env.repository, env.tag)
+
+	if err := ms.DeleteTag(env.tag); err != nil {
+		t.Fatalf("unexpected error deleting tag: %v", err)
+	}
+
+	exists, err := ms.ExistsByTag(env.tag)
+	if err != nil {
+		t.Fatalf("unexpected error checking tag existence: %v", err)
+	}
+
+	if exists {
+		t.Fatalf("tag %q should have been deleted", env.tag)
+	}
+
+	// Depending on the driver, the emptied tags directory may remain.
+	if tags, err := ms.Tags(0, ""); err == nil && len(tags) != 0 {
+		t.Fatalf("unexpected tags after delete: %v", tags)
+	}
+
+	// The revision survives the tag.
+	if _, err := ms.Get(dgst); err != nil {
+		t.Fatalf("unexpected error fetching untagged revision: %v", err)
+	}
+
+	switch err := ms.DeleteTag(env.tag).(type) {
+	case distribution.ErrManifestUnknown:
+	default:
+		t.Fatalf("expected unknown manifest error deleting missing tag: %v", err)
 	}
 }
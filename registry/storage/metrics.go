@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"github.com/docker/distribution/metrics"
+)
+
+var (
+	// layerInfoCacheRequests counts the lookups of the layer info cache, by
+	// operation and result.
+	layerInfoCacheRequests = metrics.NewCounter("registry_storage_cache_requests_total",
+		"The number of layer info cache lookups.", "operation", "result")
+
+	// uploadedBytes counts the layer data written by uploads.
+	uploadedBytes = metrics.NewCounter("registry_storage_upload_bytes_total",
+		"The number of bytes of layer data uploaded.")
+)
+
+func init() {
+	metrics.Register(layerInfoCacheRequests)
+	metrics.Register(uploadedBytes)
+}
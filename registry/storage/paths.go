@@ -64,8 +64,13 @@ const storagePathVersion = "v2"
 //
 // We cover the path formats implemented by this path mapper below.
 //
+//	Repositories:
+//
+// 	repositoriesRootPathSpec:      <root>/v2/repositories/
+//
 //	Manifests:
 //
+// 	manifestRevisionsPathSpec:     <root>/v2/repositories/<name>/_manifests/revisions/
 // 	manifestRevisionPathSpec:      <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/
 // 	manifestRevisionLinkPathSpec:  <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/link
 // 	manifestSignaturesPathSpec:    <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/signatures/
@@ -82,16 +87,19 @@ const storagePathVersion = "v2"
 //
 // 	Layers:
 //
+// 	layersPathSpec:                <root>/v2/repositories/<name>/_layers/
 // 	layerLinkPathSpec:             <root>/v2/repositories/<name>/_layers/tarsum/<tarsum version>/<tarsum hash alg>/<tarsum hash>/link
 //
 //	Uploads:
 //
+// 	uploadsPathSpec:                <root>/v2/repositories/<name>/_uploads/
 // 	uploadDataPathSpec:             <root>/v2/repositories/<name>/_uploads/<uuid>/data
 // 	uploadStartedAtPathSpec:        <root>/v2/repositories/<name>/_uploads/<uuid>/startedat
 // 	uploadHashStatePathSpec:        <root>/v2/repositories/<name>/_uploads/<uuid>/hashstates/<algorithm>/<offset>
 //
 //	Blob Store:
 //
+// 	blobsPathSpec:                  <root>/v2/blobs/
 // 	blobPathSpec:                   <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>
 // 	blobDataPathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
 //
@@ -127,6 +135,10 @@ func (pm *pathMapper) path(spec pathSpec) (string, error) {
 
 	switch v := spec.(type) {
 
+	case repositoriesRootPathSpec:
+		return path.Join(repoPrefix...), nil
+	case manifestRevisionsPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_manifests", "revisions")...), nil
 	case manifestRevisionPathSpec:
 		components, err := digestPathComponents(v.revision, false)
 		if err != nil {
@@ -228,6 +240,8 @@ func (pm *pathMapper) path(spec pathSpec) (string, error) {
 		}
 
 		return path.Join(root, path.Join(components...)), nil
+	case layersPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_layers")...), nil
 	case layerLinkPathSpec:
 		components, err := digestPathComponents(v.digest, false)
 		if err != nil {
@@ -237,6 +251,8 @@ func (pm *pathMapper) path(spec pathSpec) (string, error) {
 		layerLinkPathComponents := append(repoPrefix, v.name, "_layers")
 
 		return path.Join(path.Join(append(layerLinkPathComponents, components...)...), "link"), nil
+	case blobsPathSpec:
+		return path.Join(append(rootPrefix, "blobs")...), nil
 	case blobDataPathSpec:
 		components, err := digestPathComponents(v.digest, true)
 		if err != nil {
@@ -247,6 +263,8 @@ func (pm *pathMapper) path(spec pathSpec) (string, error) {
 		blobPathPrefix := append(rootPrefix, "blobs")
 		return path.Join(append(blobPathPrefix, components...)...), nil
 
+	case uploadsPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_uploads")...), nil
 	case uploadDataPathSpec:
 		return path.Join(append(repoPrefix, v.name, "_uploads", v.uuid, "data")...), nil
 	case uploadStartedAtPathSpec:
@@ -270,6 +288,20 @@ type pathSpec interface {
 	pathSpec()
 }
 
+// repositoriesRootPathSpec describes the root directory under which all
+// repositories are stored.
+type repositoriesRootPathSpec struct{}
+
+func (repositoriesRootPathSpec) pathSpec() {}
+
+// manifestRevisionsPathSpec describes the directory path containing all
+// manifest revisions of a repository.
+type manifestRevisionsPathSpec struct {
+	name string
+}
+
+func (manifestRevisionsPathSpec) pathSpec() {}
+
 // manifestRevisionPathSpec describes the components of the directory path for
 // a manifest revision.
 type manifestRevisionPathSpec struct {
@@ -365,6 +397,14 @@ type manifestTagIndexEntryLinkPathSpec struct {
 
 func (manifestTagIndexEntryLinkPathSpec) pathSpec() {}
 
+// layersPathSpec describes the directory containing all the layer links of a
+// repository.
+type layersPathSpec struct {
+	name string
+}
+
+func (layersPathSpec) pathSpec() {}
+
 // layerLink specifies a path for a layer link, which is a file with a blob
 // id. The layer link will contain a content addressable blob id reference
 // into the blob store. The format of the contents is as follows:
@@ -394,6 +434,11 @@ var blobAlgorithmReplacer = strings.NewReplacer(
 	";", "/",
 )
 
+// blobsPathSpec contains the root path of the registry global blob store.
+type blobsPathSpec struct{}
+
+func (blobsPathSpec) pathSpec() {}
+
 // // blobPathSpec contains the path for the registry global blob store.
 // type blobPathSpec struct {
 // 	digest digest.Digest
@@ -409,6 +454,14 @@ type blobDataPathSpec struct {
 
 func (blobDataPathSpec) pathSpec() {}
 
+// uploadsPathSpec describes the directory containing the uploads of a
+// repository, keyed by upload uuid.
+type uploadsPathSpec struct {
+	name string
+}
+
+func (uploadsPathSpec) pathSpec() {}
+
 // uploadDataPathSpec defines the path parameters of the data file for
 // uploads.
 type uploadDataPathSpec struct {
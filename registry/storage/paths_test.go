@@ -16,6 +16,16 @@ func TestPathMapper(t *testing.T) {
 		expected string
 		err      error
 	}{
+		{
+			spec:     repositoriesRootPathSpec{},
+			expected: "/pathmapper-test/repositories",
+		},
+		{
+			spec: manifestRevisionsPathSpec{
+				name: "foo/bar",
+			},
+			expected: "/pathmapper-test/repositories/foo/bar/_manifests/revisions",
+		},
 		{
 			spec: manifestRevisionPathSpec{
 				name:     "foo/bar",
@@ -88,6 +98,12 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/pathmapper-test/repositories/foo/bar/_manifests/tags/thetag/index/sha256/abcdef0123456789/link",
 		},
+		{
+			spec: layersPathSpec{
+				name: "foo/bar",
+			},
+			expected: "/pathmapper-test/repositories/foo/bar/_layers",
+		},
 		{
 			spec: layerLinkPathSpec{
 				name:   "foo/bar",
@@ -95,6 +111,10 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/pathmapper-test/repositories/foo/bar/_layers/tarsum/v1/test/abcdef/link",
 		},
+		{
+			spec:     blobsPathSpec{},
+			expected: "/pathmapper-test/blobs",
+		},
 		{
 			spec: blobDataPathSpec{
 				digest: digest.Digest("tarsum.dev+sha512:abcdefabcdefabcdef908909909"),
@@ -108,6 +128,12 @@ func TestPathMapper(t *testing.T) {
 			expected: "/pathmapper-test/blobs/tarsum/v1/sha256/ab/abcdefabcdefabcdef908909909/data",
 		},
 
+		{
+			spec: uploadsPathSpec{
+				name: "foo/bar",
+			},
+			expected: "/pathmapper-test/repositories/foo/bar/_uploads",
+		},
 		{
 			spec: uploadDataPathSpec{
 				name: "foo/bar",
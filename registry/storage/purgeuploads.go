@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"path"
+	"time"
+
+	ctxu "github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"golang.org/x/net/context"
+)
+
+// errPurgeReadOnly stops a purge when the registry turns read-only.
+var errPurgeReadOnly = errors.New("registry is read-only")
+
+// PurgeUploads deletes the uploads of every repository in the backend that
+// were started before olderThan, as recorded in their startedat file. Uploads
+// without a readable startedat file, such as those interrupted right after
+// they were created, are dated by the modification time of their directory.
+// The paths of the purged upload directories are returned.
+//
+// If dryRun is true, the uploads that would be deleted are reported but left
+// in place. Uploads that cannot be inspected or deleted are logged and
+// skipped, so that a single broken upload does not stop the purge.
+func PurgeUploads(ctx context.Context, driver storagedriver.StorageDriver, olderThan time.Time, dryRun bool) ([]string, error) {
+	return purgeUploads(ctx, driver, olderThan, dryRun, nil)
+}
+
+// purgeUploads implements PurgeUploads. If readOnly is not nil, it is checked
+// before each deletion and the purge stops while it returns true.
+func purgeUploads(ctx context.Context, driver storagedriver.StorageDriver, olderThan time.Time, dryRun bool, readOnly func() bool) ([]string, error) {
+	pm := defaultPathMapper
+
+	var purged []string
+	err := walkRepositories(driver, pm, func(name string) error {
+		uploadsPath, err := pm.path(uploadsPathSpec{name: name})
+		if err != nil {
+			return err
+		}
+
+		uploads, err := driver.List(uploadsPath)
+		if err != nil {
+			if _, ok := err.(storagedriver.PathNotFoundError); ok {
+				return nil // no uploads in this repository.
+			}
+			return err
+		}
+
+		for _, uploadPath := range uploads {
+			uuid := path.Base(uploadPath)
+
+			startedAt, err := readStartedAt(driver, pm, name, uuid)
+			if err != nil {
+				modTime, modErr := uploadModTime(driver, uploadPath, err)
+				if modErr != nil {
+					ctxu.GetLogger(ctx).Warnf("skipping upload %s of %s: %v", uuid, name, modErr)
+					continue
+				}
+
+				ctxu.GetLogger(ctx).Warnf("dating upload %s of %s by its modification time: %v", uuid, name, err)
+				startedAt = modTime
+			}
+
+			if !startedAt.Before(olderThan) {
+				continue
+			}
+
+			if dryRun {
+				ctxu.GetLogger(ctx).Infof("upload %s of %s, started at %v, eligible for purging", uuid, name, startedAt)
+				purged = append(purged, uploadPath)
+				continue
+			}
+
+			if readOnly != nil && readOnly() {
+				return errPurgeReadOnly
+			}
+
+			if err := driver.Delete(uploadPath); err != nil {
+				ctxu.GetLogger(ctx).Errorf("error deleting upload %s of %s: %v", uuid, name, err)
+				continue
+			}
+
+			ctxu.GetLogger(ctx).Infof("purged upload %s of %s, started at %v", uuid, name, startedAt)
+			purged = append(purged, uploadPath)
+		}
+
+		return nil
+	})
+
+	if err == errPurgeReadOnly {
+		ctxu.GetLogger(ctx).Infof("stopping upload purge: %v", err)
+		err = nil
+	}
+
+	return purged, err
+}
+
+// readStartedAt returns the time the upload identified by name and uuid was
+// started.
+func readStartedAt(driver storagedriver.StorageDriver, pm *pathMapper, name, uuid string) (time.Time, error) {
+	startedAtPath, err := pm.path(uploadStartedAtPathSpec{name: name, uuid: uuid})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	startedAtBytes, err := driver.GetContent(startedAtPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Parse(time.RFC3339, string(startedAtBytes))
+}
+
+// uploadModTime returns the modification time of the upload directory at
+// uploadPath, to date an upload whose startedat file could not be read
+// because of readErr. Only a missing or garbled startedat file is worked
+// around: any other error may be transient, and backends without
+// modification times for directories, such as s3, would have every such
+// upload purged.
+func uploadModTime(driver storagedriver.StorageDriver, uploadPath string, readErr error) (time.Time, error) {
+	switch readErr.(type) {
+	case storagedriver.PathNotFoundError, *time.ParseError:
+	default:
+		return time.Time{}, readErr
+	}
+
+	fileInfo, err := driver.Stat(uploadPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if fileInfo.ModTime().IsZero() {
+		return time.Time{}, fmt.Errorf("%v, and no modification time for %s", readErr, uploadPath)
+	}
+
+	return fileInfo.ModTime(), nil
+}
+
+// StartUploadPurger purges the uploads older than age from the backend in the
+// background, once per interval until ctx is done. Each wait is extended by a
+// random jitter of up to a tenth of the interval, so that registry instances
+// sharing a backend do not purge at the same time. Nothing is deleted while
+// readOnly returns true.
+func StartUploadPurger(ctx context.Context, driver storagedriver.StorageDriver, age, interval time.Duration, dryRun bool, readOnly func() bool) {
+	ctxu.GetLogger(ctx).Infof("starting upload purger: age=%v, interval=%v, dryrun=%v", age, interval, dryRun)
+
+	go func() {
+		for {
+			jitter := time.Duration(rand.Int63n(int64(interval/10) + 1))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval + jitter):
+			}
+
+			purged, err := purgeUploads(ctx, driver, time.Now().Add(-age), dryRun, readOnly)
+			if err != nil {
+				ctxu.GetLogger(ctx).Errorf("error purging uploads: %v", err)
+			}
+
+			verb := "purged"
+			if dryRun {
+				verb = "found eligible for purging"
+			}
+			ctxu.GetLogger(ctx).Infof("%s %d uploads", verb, len(purged))
+		}
+	}()
+}
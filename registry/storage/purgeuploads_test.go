@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"errors"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"golang.org/x/net/context"
+)
+
+func TestPurgeUploads(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	reg := NewRegistryWithDriver(driver, nil)
+
+	repo, err := reg.Repository(ctx, "foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	// A repository with a finished push, but no uploads left.
+	other, err := reg.Repository(ctx, "foo/other")
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	uploadTestImage(t, other, "latest")
+
+	stale, err := repo.Layers().Upload()
+	if err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+
+	fresh, err := repo.Layers().Upload()
+	if err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+
+	// Backdate the stale upload.
+	startedAtPath, err := defaultPathMapper.path(uploadStartedAtPathSpec{name: repo.Name(), uuid: stale.UUID()})
+	if err != nil {
+		t.Fatalf("unexpected error getting startedat path: %v", err)
+	}
+
+	oneWeekAgo := time.Now().Add(-7 * 24 * time.Hour)
+	if err := driver.PutContent(startedAtPath, []byte(oneWeekAgo.Format(time.RFC3339))); err != nil {
+		t.Fatalf("unexpected error backdating upload: %v", err)
+	}
+
+	olderThan := time.Now().Add(-24 * time.Hour)
+
+	purged, err := PurgeUploads(ctx, driver, olderThan, true)
+	if err != nil {
+		t.Fatalf("unexpected error during dry run: %v", err)
+	}
+
+	if len(purged) != 1 {
+		t.Fatalf("unexpected uploads eligible for purging: %v", purged)
+	}
+
+	if _, err := repo.Layers().Resume(stale.UUID()); err != nil {
+		t.Fatalf("stale upload removed during dry run: %v", err)
+	}
+
+	purged, err = PurgeUploads(ctx, driver, olderThan, false)
+	if err != nil {
+		t.Fatalf("unexpected error purging uploads: %v", err)
+	}
+
+	if len(purged) != 1 {
+		t.Fatalf("unexpected purged uploads: %v", purged)
+	}
+
+	if _, err := repo.Layers().Resume(stale.UUID()); err != distribution.ErrLayerUploadUnknown {
+		t.Fatalf("expected stale upload to be purged, got %v", err)
+	}
+
+	if _, err := repo.Layers().Resume(fresh.UUID()); err != nil {
+		t.Fatalf("unexpected error resuming fresh upload: %v", err)
+	}
+}
+
+func TestPurgeUploadsWithoutStartedAt(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	reg := NewRegistryWithDriver(driver, nil)
+
+	repo, err := reg.Repository(ctx, "foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	upload, err := repo.Layers().Upload()
+	if err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+
+	startedAtPath, err := defaultPathMapper.path(uploadStartedAtPathSpec{name: repo.Name(), uuid: upload.UUID()})
+	if err != nil {
+		t.Fatalf("unexpected error getting startedat path: %v", err)
+	}
+
+	if err := driver.PutContent(startedAtPath, []byte("garbage")); err != nil {
+		t.Fatalf("unexpected error corrupting startedat: %v", err)
+	}
+
+	// The upload is dated by its directory, modified just now.
+	purged, err := PurgeUploads(ctx, driver, time.Now().Add(-time.Hour), false)
+	if err != nil {
+		t.Fatalf("unexpected error purging uploads: %v", err)
+	}
+
+	if len(purged) != 0 {
+		t.Fatalf("unexpected purged uploads: %v", purged)
+	}
+
+	// Nothing is deleted while the registry is read-only.
+	readOnly := true
+	purged, err = purgeUploads(ctx, driver, time.Now().Add(time.Hour), false, func() bool { return readOnly })
+	if err != nil {
+		t.Fatalf("unexpected error purging uploads: %v", err)
+	}
+
+	if len(purged) != 0 {
+		t.Fatalf("unexpected uploads purged while read-only: %v", purged)
+	}
+
+	readOnly = false
+	purged, err = purgeUploads(ctx, driver, time.Now().Add(time.Hour), false, func() bool { return readOnly })
+	if err != nil {
+		t.Fatalf("unexpected error purging uploads: %v", err)
+	}
+
+	if len(purged) != 1 {
+		t.Fatalf("unexpected purged uploads: %v", purged)
+	}
+
+	if _, err := repo.Layers().Resume(upload.UUID()); err != distribution.ErrLayerUploadUnknown {
+		t.Fatalf("expected upload to be purged, got %v", err)
+	}
+}
+
+// dirlessDriver reports directories without a modification time, as the
+// object store drivers do, and fails to read the startedat files of uploads.
+type dirlessDriver struct {
+	storagedriver.StorageDriver
+}
+
+func (d dirlessDriver) GetContent(p string) ([]byte, error) {
+	if path.Base(p) == "startedat" {
+		return nil, errors.New("transient failure")
+	}
+	return d.StorageDriver.GetContent(p)
+}
+
+func (d dirlessDriver) Stat(p string) (storagedriver.FileInfo, error) {
+	fi, err := d.StorageDriver.Stat(p)
+	if err != nil || !fi.IsDir() {
+		return fi, err
+	}
+
+	return storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
+		Path:  fi.Path(),
+		IsDir: true,
+	}}, nil
+}
+
+func TestPurgeUploadsUnreadableStartedAt(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	reg := NewRegistryWithDriver(driver, nil)
+
+	repo, err := reg.Repository(ctx, "foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	upload, err := repo.Layers().Upload()
+	if err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+
+	startedAtPath, err := defaultPathMapper.path(uploadStartedAtPathSpec{name: repo.Name(), uuid: upload.UUID()})
+	if err != nil {
+		t.Fatalf("unexpected error getting startedat path: %v", err)
+	}
+
+	// Neither a failed read nor a garbled startedat file may date the
+	// upload by a missing modification time.
+	for _, startedAt := range []string{"", "garbage"} {
+		if startedAt != "" {
+			if err := driver.PutContent(startedAtPath, []byte(startedAt)); err != nil {
+				t.Fatalf("unexpected error corrupting startedat: %v", err)
+			}
+		}
+
+		purged, err := PurgeUploads(ctx, dirlessDriver{driver}, time.Now().Add(time.Hour), false)
+		if err != nil {
+			t.Fatalf("unexpected error purging uploads: %v", err)
+		}
+
+		if len(purged) != 0 {
+			t.Fatalf("unexpected purged uploads: %v", purged)
+		}
+	}
+
+	if _, err := driver.Stat(startedAtPath); err != nil {
+		t.Fatalf("upload removed: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"path"
+	"sort"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/digest"
@@ -13,7 +14,8 @@ type tagStore struct {
 	*repository
 }
 
-// tags lists the manifest tags for the specified repository.
+// tags lists the manifest tags for the specified repository, sorted
+// lexically.
 func (ts *tagStore) tags() ([]string, error) {
 	p, err := ts.pm.path(manifestTagPathSpec{
 		name: ts.name,
@@ -39,6 +41,8 @@ func (ts *tagStore) tags() ([]string, error) {
 		tags = append(tags, filename)
 	}
 
+	sort.Strings(tags)
+
 	return tags, nil
 }
 
@@ -156,3 +160,63 @@ func (ts *tagStore) delete(tag string) error {
 
 	return ts.driver.Delete(tagPath)
 }
+
+// untagRevision removes all references to revision from the tag store. Tags
+// whose current link resolves to the revision are deleted entirely, while
+// other tags only lose the revision's entry in their index.
+func (ts *tagStore) untagRevision(revision digest.Digest) error {
+	tags, err := ts.tags()
+	if err != nil {
+		switch err.(type) {
+		case distribution.ErrRepositoryUnknown:
+			return nil // no tags, nothing to do
+		default:
+			return err
+		}
+	}
+
+	for _, tag := range tags {
+		currentPath, err := ts.pm.path(manifestTagCurrentPathSpec{
+			name: ts.Name(),
+			tag:  tag,
+		})
+		if err != nil {
+			return err
+		}
+
+		current, err := ts.driver.GetContent(currentPath)
+		if err != nil {
+			switch err.(type) {
+			case storagedriver.PathNotFoundError:
+				// tag without a current link, only clean up the index.
+			default:
+				return err
+			}
+		} else if digest.Digest(current) == revision {
+			if err := ts.delete(tag); err != nil {
+				return err
+			}
+			continue
+		}
+
+		indexEntryPath, err := ts.pm.path(manifestTagIndexEntryPathSpec{
+			name:     ts.Name(),
+			tag:      tag,
+			revision: revision,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := ts.driver.Delete(indexEntryPath); err != nil {
+			switch err.(type) {
+			case storagedriver.PathNotFoundError:
+				// revision was never tagged with this tag.
+			default:
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"errors"
+	"path"
+	"sort"
+	"strings"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// errSkipDir is used as a return value from walkFn to indicate that the
+// directory named in the call is to be skipped. It is not returned as an
+// error by any function.
+var errSkipDir = errors.New("skip this directory")
+
+// walkFn is called once per file by walk. If the returned error is
+// errSkipDir and fileInfo refers to a directory, the directory will not be
+// entered and its contents will not be visited. Any other error terminates
+// the walk.
+type walkFn func(fileInfo storagedriver.FileInfo) error
+
+// walk traverses the filesystem in the driver, starting at from, calling f on
+// each file and directory below it. Entries are visited in lexical order. The
+// root of the walk is not passed to f.
+func walk(driver storagedriver.StorageDriver, from string, f walkFn) error {
+	children, err := driver.List(from)
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(children)
+
+	for _, child := range children {
+		fileInfo, err := driver.Stat(child)
+		if err != nil {
+			return err
+		}
+
+		err = f(fileInfo)
+		if err == errSkipDir {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if fileInfo.IsDir() {
+			if err := walk(driver, child, f); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// walkRepositories calls f with the name of every repository in the backend,
+// in lexical order. A directory is considered a repository if it contains one
+// of the reserved, underscore-prefixed directories, such as "_manifests". Any
+// error returned by f terminates the walk and is returned.
+func walkRepositories(driver storagedriver.StorageDriver, pm *pathMapper, f func(name string) error) error {
+	return walkRepositoriesAfter(driver, pm, "", f)
+}
+
+// walkRepositoriesAfter is like walkRepositories, but only calls f with the
+// names lexically after last. Directories holding no such repository are not
+// entered.
+func walkRepositoriesAfter(driver storagedriver.StorageDriver, pm *pathMapper, last string, f func(name string) error) error {
+	root, err := pm.path(repositoriesRootPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	subdirs, _, err := readRepositoryDir(driver, root)
+	if err != nil {
+		switch err.(type) {
+		case storagedriver.PathNotFoundError:
+			return nil // no repositories yet.
+		default:
+			return err
+		}
+	}
+
+	return walkRepositoriesFrom(driver, root, subdirs, last, f)
+}
+
+// readRepositoryDir lists the directory dir, returning its subdirectories and
+// whether it is a repository.
+func readRepositoryDir(driver storagedriver.StorageDriver, dir string) (subdirs []string, isRepository bool, err error) {
+	children, err := driver.List(dir)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, child := range children {
+		if strings.HasPrefix(path.Base(child), "_") {
+			isRepository = true
+			continue
+		}
+
+		fileInfo, err := driver.Stat(child)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if fileInfo.IsDir() {
+			subdirs = append(subdirs, child)
+		}
+	}
+
+	return subdirs, isRepository, nil
+}
+
+// repositoryEntry is either a repository or the repositories nested below
+// it, keyed by the lexical position of their names.
+type repositoryEntry struct {
+	key     string
+	subdirs []string // set for the nested repositories
+}
+
+type repositoryEntriesByKey []repositoryEntry
+
+func (s repositoryEntriesByKey) Len() int           { return len(s) }
+func (s repositoryEntriesByKey) Less(i, j int) bool { return s[i].key < s[j].key }
+func (s repositoryEntriesByKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// walkRepositoriesFrom implements walkRepositoriesAfter for the directories
+// subdirs below root.
+//
+// A repository sorts before those nested below it, but not necessarily right
+// before them: "a-b" sorts between "a" and "a/b", since "-" sorts before the
+// path separator. Each directory is thus ordered both by its name, for the
+// repository it may be, and by its name followed by the separator, for the
+// repositories nested below it.
+func walkRepositoriesFrom(driver storagedriver.StorageDriver, root string, subdirs []string, last string, f func(name string) error) error {
+	var entries []repositoryEntry
+	for _, subdir := range subdirs {
+		name := strings.TrimPrefix(subdir, root+"/")
+
+		// Every name below subdir starts with prefix, so they all sort
+		// before last when prefix does and last is not below subdir.
+		prefix := name + "/"
+		if prefix < last && !strings.HasPrefix(last, prefix) {
+			continue
+		}
+
+		nested, isRepository, err := readRepositoryDir(driver, subdir)
+		if err != nil {
+			return err
+		}
+
+		if isRepository && name > last {
+			entries = append(entries, repositoryEntry{key: name})
+		}
+
+		if len(nested) > 0 {
+			entries = append(entries, repositoryEntry{key: prefix, subdirs: nested})
+		}
+	}
+
+	sort.Sort(repositoryEntriesByKey(entries))
+
+	for _, entry := range entries {
+		if entry.subdirs == nil {
+			if err := f(entry.key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := walkRepositoriesFrom(driver, root, entry.subdirs, last, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}